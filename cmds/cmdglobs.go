@@ -30,7 +30,7 @@ import (
 // for the dvln cmds pkg... "globals" so to speak.  These are currently
 // stashed in the 'globs' (viper) package at the default level (lowest
 // priority essentially) and can be overriden via config file, CLI
-// flags, and codebase, package and devline level overrides (in time).
+// flags, and codebase and devline level settings (see defsettings.go).
 // - Any non-generic package can use globs to store "globals" which are then
 //   effectively visible across all dvln commands and non-generic packages
 // - Generic packages (eg: lib/dvln/out, or: github.com/dvln/out) should *NOT*
@@ -57,7 +57,8 @@ func doPkgCmdGlobsInit() {
 	// globs.SetDefault("Taxonomies", map[string]string{"tag": "tags", "category": "categories"})
 	// globs.RegisterAlias("indexes", "taxonomies")
 	// NewSubCommand: if you have a new subcommand with new CLI options you'll
-	// want to add a variable for it here and set up default settings,
+	// want to add a variable for it here and set up default settings (via
+	// setGlobDefault() so the default is recorded, see globsreport.go),
 	// description and additional data such as user level that will use
 	// the option/variable and how the variable can be set.
 
@@ -69,15 +70,26 @@ func doPkgCmdGlobsInit() {
 
 	// Section: ConstGlobal variables to store data (default value only, no overrides)
 	// - please add them alphabetically and don't reuse existing opts/vars
-	globs.SetDefault("wkspcMetaDir", ".dvln")
+	setGlobDefault("wkspcMetaDir", ".dvln")
 	globs.SetDesc("wkspcMetaDir", "where dvln config info exists in a workspace", globs.InternalUse, globs.ConstGlobal)
 
 	// Section: BasicGlobal variables to store data (env, config file, default)
 	// - please add them alphabetically and don't reuse existing opts/vars
-	globs.SetDefault("logfilelevel", fmt.Sprintf("%s", out.LevelInfo)) // default log lvl (if activate)
+	cbDir := filepath.Join("~", ".dvlncfg", "codebase")
+	setGlobDefault("codebasedir", cbDir) // defaults to ~/.dvlncfg/codebase
+	globs.SetDesc("codebasedir", "where named codebase definitions live", globs.ExpertUser, globs.BasicGlobal)
+
+	dlDir := filepath.Join("~", ".dvlncfg", "devline")
+	setGlobDefault("devlinedir", dlDir) // defaults to ~/.dvlncfg/devline
+	globs.SetDesc("devlinedir", "where named devline definitions live", globs.ExpertUser, globs.BasicGlobal)
+
+	setGlobDefault("dvlnminver", "") // no required dvln version by default
+	globs.SetDesc("dvlnminver", "min dvln version required (eg: by a codebase)", globs.ExpertUser, globs.BasicGlobal)
+
+	setGlobDefault("logfilelevel", fmt.Sprintf("%s", out.LevelInfo)) // default log lvl (if activate)
 	globs.SetDesc("logfilelevel", "log file output level (used if logging on)", globs.ExpertUser, globs.BasicGlobal)
 
-	globs.SetDefault("screenlevel", fmt.Sprintf("%s", out.LevelInfo)) // default print lvl
+	setGlobDefault("screenlevel", fmt.Sprintf("%s", out.LevelInfo)) // default print lvl
 	globs.SetDesc("screenlevel", "screen output level", globs.ExpertUser, globs.BasicGlobal)
 
 	// Section: CLIGlobal class options, vars that can come in from the CLI
@@ -92,68 +104,80 @@ func doPkgCmdGlobsInit() {
 	// something special like that you might need another block to put em in).
 	// Please add things alphabetically within the appropriate section.
 	// - note: currently this contains CLIGlobal and CLIOnlyGlobal type flags
-	globs.SetDefault("analysis", false)
+	setGlobDefault("analysis", false)
 	globs.SetDesc("analysis", "memory and timing analytics", globs.ExpertUser, globs.CLIGlobal)
 
-	globs.SetDefault("codebase", "") // no default code base to start with
+	setGlobDefault("codebase", "") // no default code base to start with
 	globs.SetDesc("codebase", "codebase name or URL", globs.NoviceUser, globs.CLIGlobal)
 
 	cfgDir := filepath.Join("~", ".dvlncfg")
-	globs.SetDefault("config", cfgDir) // defaults to ~/.dvlncfg
+	setGlobDefault("config", cfgDir) // defaults to ~/.dvlncfg
 	globs.SetDesc("config", "tool config dir|file", globs.ExpertUser, globs.CLIGlobal)
 
-	globs.SetDefault("debug", false)
+	setGlobDefault("debug", false)
 	globs.SetDesc("debug", "control debug output", globs.StandardUser, globs.CLIGlobal)
 
-	globs.SetDefault("devline", "") // no default devline to start with
+	setGlobDefault("devline", "") // no default devline to start with
 	globs.SetDesc("devline", "development line name", globs.NoviceUser, globs.CLIGlobal)
 
-	globs.SetDefault("fatalon", 1) // exits on 1st VCS error
+	setGlobDefault("fatalon", 1) // exits on 1st VCS error (0: never exit)
 	globs.SetDesc("fatalon", "# of VCS errs needed to cause exit", globs.ExpertUser, globs.CLIGlobal)
 
-	globs.SetDefault("force", false) // fail on dangerous ops
-	globs.SetDesc("force", "force bypass of protections", globs.ExpertUser, globs.CLIGlobal)
+	setGlobDefault("force", false) // fail on dangerous ops
+	globs.SetDesc("force", "bypass protections (listed in 'dvln help')", globs.ExpertUser, globs.CLIGlobal)
 
-	globs.SetDefault("globs", "") // show available cfg|env settings to user
-	globs.SetDesc("globs", "show settings available, cfg|env", globs.ExpertUser, globs.CLIOnlyGlobal)
+	setGlobDefault("globs", "") // show available cfg|env settings to user
+	globs.SetDesc("globs", "show settings available, cfg|env, or where set, src[:<level>]", globs.ExpertUser, globs.CLIOnlyGlobal)
 
-	globs.SetDefault("help", false)
+	setGlobDefault("help", false)
 	globs.SetDesc("help", "display tool usage", globs.StandardUser, globs.CLIOnlyGlobal)
 
-	globs.SetDefault("interact", false) // the default is no user prompting
-	globs.SetDesc("interact", "prompting control", globs.StandardUser, globs.CLIGlobal)
+	setGlobDefault("interact", false) // the default is no user prompting
+	globs.SetDesc("interact", "prompt for what to do if local work could be lost", globs.StandardUser, globs.CLIGlobal)
 
-	globs.SetDefault("jobs", "all") // default: use all CPU's
-	globs.SetDesc("jobs", "# of CPU's to use for jobs", globs.ExpertUser, globs.CLIGlobal)
+	setGlobDefault("jobs", "all") // default: use all CPU's
+	globs.SetDesc("jobs", "# of parallel jobs/CPU's to use", globs.ExpertUser, globs.CLIGlobal)
 
-	globs.SetDefault("look", "text") // text or json
-	globs.SetDesc("look", "output look, text|json", globs.ExpertUser, globs.CLIGlobal)
+	setGlobDefault("look", "text") // text, json, ndjson, yaml or table
+	globs.SetDesc("look", "output look, text|json|ndjson|yaml|table", globs.ExpertUser, globs.CLIGlobal)
 
-	globs.SetDefault("pkg", "") // no default package(s) to start with
-	globs.SetDesc("pkg", "package selector, comma separated", globs.NoviceUser, globs.CLIOnlyGlobal)
+	setGlobDefault("pkg", "") // no default package(s) to start with
+	globs.SetDesc("pkg", "package selector, eg: net/*,!net/test,modified,mygroup,dependents-of:pkg", globs.NoviceUser, globs.CLIOnlyGlobal)
 
-	globs.SetDefault("port", 3856) // port when serving
+	setGlobDefault("port", 3856) // port when serving
 	globs.SetDesc("port", "port # for --serve mode", globs.ExpertUser, globs.CLIGlobal)
 
-	globs.SetDefault("quiet", false) // normal output to start
+	setGlobDefault("prune", false) // orphan pkgs dropped from a devline
+	globs.SetDesc("prune", "remove pkgs dropped from the devline", globs.StandardUser, globs.CLIGlobal)
+
+	setGlobDefault("quiet", false) // normal output to start
 	globs.SetDesc("quiet", "silent running", globs.StandardUser, globs.CLIGlobal)
 
-	globs.SetDefault("record", "off") // no output record/log to start
+	setGlobDefault("record", "off") // no output record/log to start
 	globs.SetDesc("record", "to file|'tmp'", globs.NoviceUser, globs.CLIGlobal)
 
-	globs.SetDefault("serve", false) // serve defaults off
+	setGlobDefault("scope", "") // config file scope, see 'dvln config'
+	globs.SetDesc("scope", "config file scope, user|workspace", globs.StandardUser, globs.CLIOnlyGlobal)
+
+	setGlobDefault("serve", false) // serve defaults off
 	globs.SetDesc("serve", "activate REST serve mode", globs.ExpertUser, globs.CLIGlobal)
 
-	globs.SetDefault("terse", false) // regular non-terse mode
+	setGlobDefault("servehost", "127.0.0.1") // local clients only by default
+	globs.SetDesc("servehost", "host|IP --serve mode listens on (\"\": all)", globs.ExpertUser, globs.CLIGlobal)
+
+	setGlobDefault("serveroot", "") // default: the dir the server started in
+	globs.SetDesc("serveroot", "dir --serve mode workspaces must be within", globs.ExpertUser, globs.CLIGlobal)
+
+	setGlobDefault("terse", false) // regular non-terse mode
 	globs.SetDesc("terse", "output reduction", globs.StandardUser, globs.CLIGlobal)
 
-	globs.SetDefault("verbose", false) // not verbose to start
+	setGlobDefault("verbose", false) // not verbose to start
 	globs.SetDesc("verbose", "output verbosity, extends debug", globs.StandardUser, globs.CLIGlobal)
 
-	globs.SetDefault("version", false)
+	setGlobDefault("version", false)
 	globs.SetDesc("version", "show tool version details", globs.StandardUser, globs.CLIOnlyGlobal)
 
-	globs.SetDefault("wkspcdir", ".") // assume current dir is where workspace is
+	setGlobDefault("wkspcdir", ".") // assume current dir is where workspace is
 	globs.SetDesc("wkspcdir", "workspace directory", globs.StandardUser, globs.CLIOnlyGlobal)
 
 	// Section: <add more sections as needed>
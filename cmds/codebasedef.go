@@ -0,0 +1,233 @@
+// Copyright © 2015 Erik Brady <brady@dvln.org>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package cmds codebasedef.go module deals with locating and loading the
+// codebase definition (the set of packages that make up a codebase and
+// where they can be cloned from) for the dvln subcommands that need it.
+package cmds
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/dvln/out"
+	"github.com/dvln/util/path"
+	globs "github.com/dvln/viper"
+)
+
+// codebaseFormat is the latest codebase definition file format version
+// this dvln understands, files with no version are assumed to be version 1
+const codebaseFormat = 1
+
+// codebaseDef is the in-memory form of a codebase definition file, it
+// identifies the packages that make up the codebase and how to get them.
+// The file can be TOML, YAML or JSON (see deffile.go), eg in TOML:
+//
+//	version = 1
+//	name = "mycodebase"
+//	owners = ["jdoe@example.com"]
+//	[[packages]]
+//	name = "netlib"
+//	path = "lib/net"
+//	vcs = "git"
+//	remote = "https://example.com/netlib.git"
+//	branch = "main"
+//	groups = ["core"]
+//	deps = ["utils"]
+//	[settings]
+//	fatalon = 0
+type codebaseDef struct {
+	Version     int       `json:"version" toml:"version" yaml:"version"`
+	Name        string    `json:"name" toml:"name" yaml:"name"`
+	Description string    `json:"description,omitempty" toml:"description" yaml:"description,omitempty"`
+	Owners      []string  `json:"owners,omitempty" toml:"owners" yaml:"owners,omitempty"`
+	Packages    []*pkgDef `json:"packages" toml:"packages" yaml:"packages"`
+	Settings    settings  `json:"settings,omitempty" toml:"settings" yaml:"settings,omitempty"` // see defsettings.go
+	file        string    // where the definition was loaded from
+}
+
+// pkgDef describes a single package within a codebase
+type pkgDef struct {
+	Name   string   `json:"name" toml:"name" yaml:"name"`
+	Path   string   `json:"path,omitempty" toml:"path" yaml:"path,omitempty"`       // wkspc relative path, default: Name
+	VCS    string   `json:"vcs,omitempty" toml:"vcs" yaml:"vcs,omitempty"`          // git|hg|svn|bzr, default: git
+	Remote string   `json:"remote" toml:"remote" yaml:"remote"`                     // URL/path to clone from
+	Branch string   `json:"branch,omitempty" toml:"branch" yaml:"branch,omitempty"` // default branch, default: VCS's
+	Groups []string `json:"groups,omitempty" toml:"groups" yaml:"groups,omitempty"` // groups the package belongs to
+	Deps   []string `json:"deps,omitempty" toml:"deps" yaml:"deps,omitempty"`       // packages this package depends on
+	Owners []string `json:"owners,omitempty" toml:"owners" yaml:"owners,omitempty"` // who to talk to about the package
+}
+
+// pkg returns the package definition for the given package name, nil if the
+// codebase has no such package
+func (cb *codebaseDef) pkg(name string) *pkgDef {
+	for _, p := range cb.Packages {
+		if p.Name == name {
+			return p
+		}
+	}
+	return nil
+}
+
+// isURL returns true if the given codebase or devline reference looks like
+// a URL that we would need to fetch rather than a local name or path
+func isURL(ref string) bool {
+	return strings.HasPrefix(ref, "http://") || strings.HasPrefix(ref, "https://")
+}
+
+// defHTTPClient fetches codebase and devline definitions given as URLs, the
+// timeout keeps an unresponsive server from hanging dvln
+var defHTTPClient = &http.Client{Timeout: 30 * time.Second}
+
+// readDefFile reads in the contents of a codebase or devline definition that
+// is either a local file or a http(s) URL
+func readDefFile(ref string) ([]byte, error) {
+	if !isURL(ref) {
+		return ioutil.ReadFile(strings.TrimPrefix(ref, "file://"))
+	}
+	resp, err := defHTTPClient.Get(ref)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetch of %s failed: %s", ref, resp.Status)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+// findDefFile takes a codebase or devline reference (a name, a path or a URL)
+// and returns where to read it from, names are looked up in the given dir
+func findDefFile(ref string, dir string) string {
+	if isURL(ref) || strings.HasPrefix(ref, "file://") {
+		return ref
+	}
+	if _, err := os.Stat(ref); err == nil {
+		return ref
+	}
+	if filepath.IsAbs(ref) {
+		return defFileWithExt(ref)
+	}
+	return defFileWithExt(filepath.Join(path.AbsPathify(dir), ref))
+}
+
+// defFileWithExt returns the definition file for the given path without an
+// extension, ie: the first of path.json, path.toml, .. that exists, if none
+// exist then path.json
+func defFileWithExt(base string) string {
+	for _, ext := range defExts {
+		if _, err := os.Stat(base + ext); err == nil {
+			return base + ext
+		}
+	}
+	return base + defExts[0]
+}
+
+// loadCodebase locates and reads in the given codebase (name, path or URL),
+// named codebases are found in the cfgfile:codebasedir directory.
+func loadCodebase(codebase string) (*codebaseDef, error) {
+	if codebase == "" {
+		return nil, out.NewErr("No codebase given, use --codebase|-c (or set cfgfile:codebase|env:DVLN_CODEBASE)", 2008)
+	}
+	file := findDefFile(codebase, globs.GetString("codebasedir"))
+	out.Debugln("Reading codebase definition:", file)
+	data, err := readDefFile(file)
+	if err != nil {
+		return nil, out.WrapErr(err, fmt.Sprintf("Unable to read codebase \"%s\"", codebase), 2009)
+	}
+	cb := &codebaseDef{file: file}
+	if err = decodeDef(file, data, cb); err != nil {
+		return nil, out.WrapErr(err, fmt.Sprintf("Unable to parse codebase definition: %s", file), 2009)
+	}
+	if cb.Name == "" {
+		cb.Name = codebase
+	}
+	if err = validateCodebase(cb, data); err != nil {
+		return nil, err
+	}
+	return cb, nil
+}
+
+// validateCodebase checks a freshly parsed codebase definition (and fills in
+// package defaults), all problems found are reported in one error along
+// with the line # each problem is on in the given file data
+func validateCodebase(cb *codebaseDef, data []byte) error {
+	if cb.Version == 0 {
+		cb.Version = 1
+	}
+	if cb.Version > codebaseFormat {
+		return out.NewErr(fmt.Sprintf("Codebase %s is format version %d, this dvln only understands up to version %d (upgrade dvln): %s", cb.Name, cb.Version, codebaseFormat, cb.file), 2028)
+	}
+	de := newDefErrs(cb.file, data)
+	names := make(map[string]bool, len(cb.Packages))
+	var pathPkgs []*pkgDef // packages with usable paths
+	for i, p := range cb.Packages {
+		line := de.lines.line("packages", i, "name")
+		if p.Name == "" {
+			de.add(line, "package #%d has no name", i+1)
+			continue
+		}
+		if names[p.Name] {
+			de.add(line, "package %s is defined more than once", p.Name)
+		}
+		names[p.Name] = true
+		if p.Remote == "" {
+			de.add(line, "package %s has no remote", p.Name)
+		}
+		if err := checkVCSArg(p.Remote); err != nil {
+			de.add(de.lines.line("packages", i, "remote"), "package %s: %s", p.Name, err)
+		}
+		if err := checkVCSArg(p.Branch); err != nil {
+			de.add(de.lines.line("packages", i, "branch"), "package %s: %s", p.Name, err)
+		}
+		if p.Path == "" {
+			p.Path = p.Name
+		}
+		if err := checkPkgPath(p.Path); err != nil {
+			de.add(de.lines.line("packages", i, "path"), "package %s path \"%s\" can't be used: %s", p.Name, p.Path, err)
+		} else {
+			p.Path = filepath.ToSlash(filepath.Clean(filepath.FromSlash(p.Path)))
+			for _, other := range pathPkgs {
+				if other.Path == p.Path || strings.HasPrefix(p.Path, other.Path+"/") || strings.HasPrefix(other.Path, p.Path+"/") {
+					de.add(de.lines.line("packages", i, "path"), "packages %s and %s overlap (paths %s and %s)", other.Name, p.Name, other.Path, p.Path)
+				}
+			}
+			pathPkgs = append(pathPkgs, p)
+		}
+		if p.VCS == "" {
+			p.VCS = "git"
+		}
+		if _, ok := vcsDrivers[p.VCS]; !ok {
+			de.add(de.lines.line("packages", i, "vcs"), "package %s has an unsupported VCS type \"%s\" (supported: %s)", p.Name, p.VCS, strings.Join(vcsTypes(), ", "))
+		}
+		for j, group := range p.Groups {
+			if group == "" || cb.pkg(group) != nil {
+				de.add(de.lines.line("packages", i, "groups", j), "package %s group \"%s\" is empty or the same as a package name", p.Name, group)
+			}
+		}
+	}
+	for i, p := range cb.Packages {
+		for j, dep := range p.Deps {
+			if cb.pkg(dep) == nil {
+				de.add(de.lines.line("packages", i, "deps", j), "package %s depends on unknown package %s", p.Name, dep)
+			}
+		}
+	}
+	validateSettings(cb.Settings, de)
+	return de.err(fmt.Sprintf("Codebase %s definition is invalid", cb.Name), 2027)
+}
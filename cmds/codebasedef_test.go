@@ -0,0 +1,307 @@
+// Copyright © 2015 Erik Brady <brady@dvln.org>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmds
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testDefs is the same codebase definition in each format, the values looked
+// up by TestDefLines are on the same lines in each
+var testDefs = map[string]string{
+	".json": `{
+  "name": "cb",
+  "packages": [
+    {
+      "name": "net", "remote": "https://example.com/net.git",
+      "deps": ["util",
+        "xyz"]
+    },
+    {
+      "name": "util",
+      "remote": "https://example.com/util.git", "path": "lib/util"
+    }
+  ],
+  "settings": {
+    "jobs": 4
+  }
+}
+`,
+	".toml": `name = "cb"   # the name: "cb"
+version = 1
+
+[[packages]]
+
+name = "net" # remote = "x"
+deps = ["util",
+  "xyz"]
+
+[[packages]]
+name = "util"
+remote = "https://example.com/util.git" # path = "x"
+path = "lib/util"
+
+[settings]
+jobs = 4
+`,
+	".yaml": `name: cb
+packages:
+# the packages
+
+- name: net
+  remote: https://example.com/net.git
+  deps:
+  - util
+  - xyz
+- name: util
+  remote: "https://example.com/util.git"
+  path: lib/util
+
+settings:
+  jobs: 4
+`,
+}
+
+func TestDefLines(t *testing.T) {
+	want := map[string]map[string]int{
+		".json": {"name": 2, "packages.0": 4, "packages.0.name": 5, "packages.0.deps.0": 6, "packages.0.deps.1": 7,
+			"packages.1.name": 10, "packages.1.remote": 11, "packages.1.path": 11, "settings.jobs": 15},
+		".toml": {"name": 1, "packages.0": 4, "packages.0.name": 6, "packages.0.deps.0": 7, "packages.0.deps.1": 8,
+			"packages.1.name": 11, "packages.1.remote": 12, "packages.1.path": 13, "settings.jobs": 16},
+		".yaml": {"name": 1, "packages.0": 5, "packages.0.name": 5, "packages.0.deps.0": 8, "packages.0.deps.1": 9,
+			"packages.1.name": 10, "packages.1.remote": 11, "packages.1.path": 12, "settings.jobs": 15},
+	}
+	for ext, def := range testDefs {
+		lines := scanDefLines("cb"+ext, []byte(def))
+		for path, line := range want[ext] {
+			if lines[path] != line {
+				t.Errorf("%s: %s is on line %d, want %d", ext, path, lines[path], line)
+			}
+		}
+		// values not in the file fall back to what they would be within
+		if line := lines.line("packages", 0, "path"); line != want[ext]["packages.0"] {
+			t.Errorf("%s: missing packages.0.path gave line %d, want the package line %d", ext, line, want[ext]["packages.0"])
+		}
+		if line := lines.line("nosuch", 0); line != 0 {
+			t.Errorf("%s: missing nosuch.0 gave line %d, want 0", ext, line)
+		}
+	}
+}
+
+// TestDefLinesTricky checks the line scans for quoted '#', escaped quotes,
+// multi-line strings and inline tables (or flow collections), each file
+// is also parsed to be sure it's valid
+func TestDefLinesTricky(t *testing.T) {
+	tests := []struct {
+		file    string
+		def     string
+		lines   map[string]int
+		missing []string
+	}{
+		{"cb.toml", `name = "cb"
+description = """
+[not_a_table]
+name = "not a key"
+"""
+remote = "https://example.com/a#b" # a comment with a "quote
+note = "say \"hi\" # still the note"
+settings = { jobs = 4, fatalon = 2 }
+packages = [
+  { name = "net", deps = ["a", "b,c"] },
+  { name = "util" },
+]
+owners = ["x"]
+`, map[string]int{"name": 1, "description": 2, "remote": 6, "note": 7, "settings.jobs": 8, "settings.fatalon": 8,
+			"packages": 9, "packages.0.name": 10, "packages.0.deps.1": 10, "packages.1.name": 11, "owners.0": 13},
+			[]string{"not_a_table", "not_a_table.name", "packages.0.deps.2", "packages.2"}},
+		{"cb.yaml", `name: cb
+description: |
+  name: not a key
+  - not an item
+remote: https://example.com/a#b
+note: don't # a comment
+packages: [{name: net, deps: [a, "b, c"]}, {name: util}]
+settings:
+  jobs: 4
+`, map[string]int{"name": 1, "description": 2, "remote": 5, "note": 6, "packages.0.name": 7,
+			"packages.0.deps.1": 7, "packages.1.name": 7, "settings": 8, "settings.jobs": 9},
+			[]string{"description.name", "description.0", "packages.0.deps.2", "packages.2"}},
+	}
+	for _, test := range tests {
+		var def map[string]interface{}
+		if err := decodeDef(test.file, []byte(test.def), &def); err != nil {
+			t.Errorf("%s: invalid test definition: %s", test.file, err)
+		}
+		lines := scanDefLines(test.file, []byte(test.def))
+		for path, line := range test.lines {
+			if lines[path] != line {
+				t.Errorf("%s: %s is on line %d, want %d", test.file, path, lines[path], line)
+			}
+		}
+		for _, path := range test.missing {
+			if line, ok := lines[path]; ok {
+				t.Errorf("%s: %s found on line %d, it's not in the file", test.file, path, line)
+			}
+		}
+	}
+	comments := []struct {
+		line, format, want string
+	}{
+		{`devline = "a#b"`, "toml", `devline = "a#b"`},
+		{`jobs = 4#comment`, "toml", `jobs = 4`},
+		{`note: 'it''s' # x`, "yaml", `note: 'it''s' `},
+		{`url: http://host/#anchor`, "yaml", `url: http://host/#anchor`},
+		{`note: don't # x`, "yaml", `note: don't `},
+	}
+	for _, test := range comments {
+		if got := stripDefComment(test.line, test.format); got != test.want {
+			t.Errorf("%s line %q: comment stripped to %q, want %q", test.format, test.line, got, test.want)
+		}
+	}
+}
+
+func TestValidateCodebase(t *testing.T) {
+	tests := []struct {
+		paths []string // package paths, the package names are p0, p1, ..
+		probs []string // problems expected, "" if none
+	}{
+		{[]string{"net", "lib/util", "lib/net"}, nil},
+		{[]string{"/abs/net"}, []string{"line 5: package p0 path \"/abs/net\" can't be used: it's absolute"}},
+		{[]string{"net/../../x"}, []string{"line 5: package p0 path \"net/../../x\" can't be used: it has \"..\""}},
+		{[]string{".dvln/x"}, []string{"line 5: package p0 path \".dvln/x\" can't be used: it's in the workspace metadata dir"}},
+		{[]string{"./"}, []string{"line 5: package p0 path \"./\" can't be used: it's the workspace root"}},
+		{[]string{"lib", "lib/net"}, []string{"line 7: packages p0 and p1 overlap (paths lib and lib/net)"}},
+		{[]string{"lib/net", "lib/./net/"}, []string{"line 7: packages p0 and p1 overlap (paths lib/net and lib/net)"}},
+	}
+	for _, test := range tests {
+		// the packages start on line 4, each takes two lines (path on the 2nd)
+		cb := &codebaseDef{Name: "cb", file: "cb.json"}
+		var pkgs []string
+		for i, path := range test.paths {
+			name := fmt.Sprintf("p%d", i)
+			cb.Packages = append(cb.Packages, &pkgDef{Name: name, Path: path, Remote: "x"})
+			pkgs = append(pkgs, fmt.Sprintf("{\"name\": \"%s\", \"remote\": \"x\",\n \"path\": \"%s\"}", name, path))
+		}
+		data := "{\n\"name\": \"cb\",\n\"packages\": [\n" + strings.Join(pkgs, ",\n") + "\n]}\n"
+		err := validateCodebase(cb, []byte(data))
+		if test.probs == nil {
+			if err != nil {
+				t.Errorf("paths %v refused: %s", test.paths, err)
+			}
+			continue
+		}
+		if err == nil {
+			t.Errorf("paths %v accepted", test.paths)
+			continue
+		}
+		for _, prob := range test.probs {
+			if !strings.Contains(err.Error(), prob) {
+				t.Errorf("paths %v: problem %q not found in: %s", test.paths, prob, err)
+			}
+		}
+	}
+	// paths are stored cleaned, with defaults filled in
+	cb := &codebaseDef{Name: "cb", file: "cb.json", Packages: []*pkgDef{
+		{Name: "net", Remote: "x"},
+		{Name: "util", Path: "lib//util/", Remote: "y"},
+	}}
+	if err := validateCodebase(cb, []byte(`{}`)); err != nil {
+		t.Fatalf("valid codebase refused: %s", err)
+	}
+	if cb.Packages[0].Path != "net" || cb.Packages[0].VCS != "git" || cb.Packages[1].Path != "lib/util" {
+		t.Errorf("package defaults or cleaned path wrong: %+v %+v", cb.Packages[0], cb.Packages[1])
+	}
+}
+
+func TestDefFormatVersion(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dvlnfmt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defs := map[string][2]string{ // format: codebase, devline (version %s)
+		"json": {`{"version": %s, "name": "cb", "packages": [{"name": "net", "remote": "x"}]}`,
+			`{"version": %s, "name": "dl", "packages": [{"name": "net", "tag": "v1"}]}`},
+		"toml": {"version = %s\nname = \"cb\"\n[[packages]]\nname = \"net\"\nremote = \"x\"\n",
+			"version = %s\nname = \"dl\"\n[[packages]]\nname = \"net\"\ntag = \"v1\"\n"},
+		"yaml": {"version: %s\nname: cb\npackages:\n- name: net\n  remote: x\n",
+			"version: %s\nname: dl\npackages:\n- name: net\n  tag: v1\n"},
+	}
+	for format, def := range defs {
+		t.Run(format, func(t *testing.T) {
+			for _, version := range []string{"1", "2"} {
+				cbFile := filepath.Join(dir, "cb"+version+"."+format)
+				dlFile := filepath.Join(dir, "dl"+version+"."+format)
+				if err := ioutil.WriteFile(cbFile, []byte(strings.Replace(def[0], "%s", version, 1)), 0644); err != nil {
+					t.Fatal(err)
+				}
+				if err := ioutil.WriteFile(dlFile, []byte(strings.Replace(def[1], "%s", version, 1)), 0644); err != nil {
+					t.Fatal(err)
+				}
+				cb, cbErr := loadCodebase(cbFile)
+				_, dlErr := loadDevline(dlFile)
+				if version == "1" {
+					if cbErr != nil || dlErr != nil {
+						t.Errorf("version 1 refused: %v, %v", cbErr, dlErr)
+					} else if cb.Name != "cb" || len(cb.Packages) != 1 || cb.Packages[0].Remote != "x" {
+						t.Errorf("codebase not decoded: %+v", cb)
+					}
+					continue
+				}
+				for _, err := range []error{cbErr, dlErr} {
+					if err == nil || !strings.Contains(err.Error(), "format version 2") {
+						t.Errorf("version 2 not refused as too new: %v", err)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestReadDefFileURL(t *testing.T) {
+	block := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/cb.json":
+			fmt.Fprint(w, `{"name": "cb"}`)
+		case "/slow.json":
+			<-block
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	defer close(block)
+	saved := defHTTPClient.Timeout
+	defHTTPClient.Timeout = 100 * time.Millisecond
+	defer func() { defHTTPClient.Timeout = saved }()
+
+	if data, err := readDefFile(srv.URL + "/cb.json"); err != nil || string(data) != `{"name": "cb"}` {
+		t.Errorf("Got %q (err: %v) for a served definition", data, err)
+	}
+	if _, err := readDefFile(srv.URL + "/nosuch.json"); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("Got error %v for a missing definition, want the 404", err)
+	}
+	if _, err := readDefFile(srv.URL + "/slow.json"); err == nil {
+		t.Errorf("Fetch from an unresponsive server didn't time out")
+	}
+}
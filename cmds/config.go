@@ -0,0 +1,505 @@
+// Copyright © 2015 Erik Brady <brady@dvln.org>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package cmds config.go module implements the 'dvln config' subcommands
+// which get, set, unset and list the settings in the users config file (eg:
+// ~/.dvlncfg/cfg.toml) or the workspace config file (see wkspccfg.go).  Only
+// known settings that can be set in a config file are accepted and the file
+// is rewritten in the format (TOML, YAML or JSON) it is already in, note that
+// rewriting it drops any comments and sorts the settings by name.
+package cmds
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	cli "github.com/dvln/cobra"
+	"github.com/dvln/out"
+	"github.com/dvln/util/path"
+	globs "github.com/dvln/viper"
+)
+
+var configCmd = &cli.Command{
+	Use:   "config",
+	Short: "get, set, unset or list config file settings",
+	Long: `Get, set, unset or list the settings in the users config file (the
+default) or the workspace config file (--scope=workspace), eg:
+  % dvln config get jobs                     (effective value and source)
+  % dvln config set jobs 4
+  % dvln config set --scope=workspace fatalon 0
+  % dvln config unset jobs
+  % dvln config list
+Use 'dvln --globs=cfg' to see the settings available`,
+}
+
+var configGetCmd = &cli.Command{
+	Use:   "get",
+	Short: "get a setting",
+	Long: `Get the effective value of a setting and where it came from, or with
+--scope the value set in the users or workspace config file, eg:
+  % dvln config get jobs
+  % dvln config get --scope=workspace jobs`,
+	Run: configGet,
+}
+
+var configSetCmd = &cli.Command{
+	Use:   "set",
+	Short: "set a setting in a config file",
+	Long: `Set a setting in the users config file (the default) or the workspace
+config file, the config file is created if needed (as cfg.json), eg:
+  % dvln config set jobs 4
+  % dvln config set --scope=workspace devline proj_x
+Note: the config file is rewritten, comments in it are not kept and the
+settings are sorted by name`,
+	Run: configSet,
+}
+
+var configUnsetCmd = &cli.Command{
+	Use:   "unset",
+	Short: "remove a setting from a config file",
+	Long: `Remove a setting from the users config file (the default) or the
+workspace config file, any setting in the file can be removed (even one
+dvln doesn't know), eg:
+  % dvln config unset jobs
+  % dvln config unset --scope=workspace jobs
+Note: the config file is rewritten, comments in it are not kept and the
+settings are sorted by name`,
+	Run: configUnset,
+}
+
+var configListCmd = &cli.Command{
+	Use:   "list",
+	Short: "list the settings in the config files",
+	Long: `List the settings in the users and workspace config files, or just
+those in the config file of the given scope, eg:
+  % dvln config list
+  % dvln config list --scope=workspace`,
+	Run: configList,
+}
+
+// configScopes are the valid --scope settings
+var configScopes = []string{"user", "workspace"}
+
+// init bootstraps the options used for the config subcommands and
+// descriptions and initial defaults for those options and such.
+func init() {
+	reloadCLIFlags := false
+	configCmd.AddCommand(configGetCmd)
+	configCmd.AddCommand(configSetCmd)
+	configCmd.AddCommand(configUnsetCmd)
+	configCmd.AddCommand(configListCmd)
+	setupConfigCmdCLIArgs(configCmd, reloadCLIFlags)
+}
+
+// setupConfigCmdCLIArgs is used from init() to set up the 'globs' (viper) pkg
+// CLI options available to this subcommand (other options were already set up
+// in the "parent" dvln subcommand in a like-named method). Every subcommand
+// has a like named method "setup<subcmd>CmdCLIArgs()", called in init() above
+// and called from dvln.go, this one also sets up the 'config' subcommands.
+func setupConfigCmdCLIArgs(c *cli.Command, reloadCLIFlags bool) {
+	subCmds := []*cli.Command{configGetCmd, configSetCmd, configUnsetCmd, configListCmd}
+	for _, subCmd := range subCmds {
+		if reloadCLIFlags {
+			subCmd.Flags().SetDefValueReparseOK(true)
+		}
+		desc, _, _ := globs.Desc("scope")
+		subCmd.Flags().StringP("scope", "s", globs.GetString("scope"), desc)
+	}
+	configGetCmd.Run = configGet
+	configSetCmd.Run = configSet
+	configUnsetCmd.Run = configUnset
+	configListCmd.Run = configList
+	// NewCLIOpts: if there were opts for the subcmd set them here and note that
+	// "persistent" opts are set in cmds/dvln.go, only opts specific to the
+	// 'dvln config' subcommands are set here
+	// Note that you'll need to modify cmds/global.go as well otherwise your
+	// globs.Desc() call and globs.GetBool("myopt") will not work.
+	if reloadCLIFlags {
+		for _, subCmd := range subCmds {
+			subCmd.Flags().SetDefValueReparseOK(false)
+		}
+	}
+}
+
+// cfgSetting is a setting in a config file (or, for 'get', in effect)
+type cfgSetting struct {
+	Name   string      `json:"name"`
+	Value  interface{} `json:"value"`
+	Scope  string      `json:"scope,omitempty"`
+	Source string      `json:"source,omitempty"`
+	File   string      `json:"file,omitempty"`
+}
+
+// cfgFile is a users or workspace config file and the settings in it
+type cfgFile struct {
+	scope    string
+	file     string
+	settings settings
+	comments bool // the file has comments (which a rewrite drops)
+}
+
+// configScope returns the --scope given, def if none given, validating it
+func configScope(def string) (string, error) {
+	scope := globs.GetString("scope")
+	if scope == "" {
+		return def, nil
+	}
+	if !stringInSlice(scope, configScopes) {
+		return "", out.NewErr(fmt.Sprintf("The --scope option can only be set to '%s', found: '%s'", strings.Join(configScopes, "' or '"), scope), 2018)
+	}
+	return scope, nil
+}
+
+// userCfgFile returns the users config file, if there isn't one yet then
+// where it would be created (cfg.json in the config dir)
+func userCfgFile() string {
+	if file := globs.ConfigFileUsed(); file != "" {
+		return file
+	}
+	configPath := path.AbsPathify(globs.GetString("config"))
+	if fileInfo, err := os.Stat(configPath); err == nil && !fileInfo.IsDir() {
+		return configPath
+	}
+	for _, ext := range defExts {
+		file := filepath.Join(configPath, "cfg"+ext)
+		if _, err := os.Stat(file); err == nil {
+			return file
+		}
+	}
+	return filepath.Join(configPath, "cfg"+defExts[0])
+}
+
+// readCfgFile reads in the config file for the given scope, if the file
+// doesn't exist yet then it has no settings (and will be created if set)
+func readCfgFile(scope string) (*cfgFile, error) {
+	cf := &cfgFile{scope: scope, settings: make(settings)}
+	code := 2002
+	if scope == "user" {
+		cf.file = userCfgFile()
+	} else {
+		code = 2036
+		rootDir, err := findWkspcRootDir()
+		if err != nil {
+			return nil, out.WrapErr(err, "Unexpected problem scanning for a workspace", 2006)
+		}
+		if rootDir == "" {
+			return nil, out.NewErr("No workspace found for the workspace config, run from within a workspace", 2016)
+		}
+		if cf.file = wkspcCfgFile(rootDir); cf.file == "" {
+			cf.file = filepath.Join(wkspcMetaDirPath(rootDir), "cfg"+defExts[0])
+		}
+	}
+	data, err := ioutil.ReadFile(cf.file)
+	if os.IsNotExist(err) {
+		return cf, nil
+	}
+	if err != nil {
+		return nil, out.WrapErr(err, fmt.Sprintf("Unable to read the %s config file", scope), code)
+	}
+	if err = decodeDef(cf.file, data, &cf.settings); err != nil {
+		return nil, out.WrapErr(err, fmt.Sprintf("Unable to parse the %s config file: %s", scope, cf.file), code)
+	}
+	cf.comments = cfgHasComments(cf.file, data)
+	return cf, nil
+}
+
+// cfgHasComments returns true if the given TOML or YAML config file data has
+// any '#' comments, a '#' within a (quoted or TOML multi-line) string or a
+// YAML plain value (eg: "devline: a#b") isn't a comment
+func cfgHasComments(file string, data []byte) bool {
+	format := defFormat(file)
+	if format == "json" {
+		return false
+	}
+	mlDelim := "" // set while in a TOML multi-line string
+	for _, line := range strings.Split(string(data), "\n") {
+		if mlDelim != "" {
+			if strings.Contains(line, mlDelim) {
+				mlDelim = ""
+			}
+			continue
+		}
+		for _, delim := range []string{`"""`, "'''"} {
+			if i := strings.Index(line, delim); format == "toml" && i >= 0 && !strings.Contains(line[i+len(delim):], delim) {
+				mlDelim = delim
+				line = line[:i] // the rest of the line is in the string
+			}
+		}
+		if stripDefComment(line, format) != line {
+			return true
+		}
+	}
+	return false
+}
+
+// key returns the name the given setting has in the config file (settings
+// are case independent), "" if it's not in the file
+func (cf *cfgFile) key(name string) string {
+	for key := range cf.settings {
+		if strings.ToLower(key) == name {
+			return key
+		}
+	}
+	return ""
+}
+
+// write writes the config file back out in the format it's in, the file is
+// encoded from the settings so any comments are lost (the user is told) and
+// the settings end up sorted by name
+func (cf *cfgFile) write() error {
+	data, err := encodeDef(cf.file, cf.settings)
+	if err == nil {
+		if err = os.MkdirAll(filepath.Dir(cf.file), 0755); err == nil {
+			err = ioutil.WriteFile(cf.file, data, 0644)
+		}
+	}
+	if err != nil {
+		return out.WrapErr(err, fmt.Sprintf("Unable to write the %s config file: %s", cf.scope, cf.file), 2039)
+	}
+	if cf.comments && !lookIsStructured() {
+		out.Noteln("The comments in the", cf.scope, "config file were not kept:", cf.file)
+	}
+	return nil
+}
+
+// configName validates the setting name given to a 'dvln config' subcommand,
+// returning it in lower case (as 'globs' uses)
+func configName(name string) (string, error) {
+	name = strings.ToLower(name)
+	if err := fileSettable(name); err != nil {
+		return "", out.NewErr(fmt.Sprintf("Unable to use setting %s: %s", name, err), 2038)
+	}
+	return name, nil
+}
+
+// fileSettingKey returns the name the given setting has in the config file,
+// for commands that work on what is in the file (get --scope, unset) so
+// any setting there can be used, even one that isn't valid there.  If it's
+// not in the file the problem with the name, if any, is reported.
+func (cf *cfgFile) fileSettingKey(name string) (string, error) {
+	if key := cf.key(name); key != "" {
+		return key, nil
+	}
+	if _, err := configName(name); err != nil {
+		return "", err
+	}
+	return "", out.NewErr(fmt.Sprintf("Setting %s is not set in the %s config file (%s)", name, cf.scope, cf.file), 2040)
+}
+
+// configValue converts a value given on the CLI to the type of the setting
+// (based on it's default), eg: "false" for a bool setting becomes false.
+// Settings without a default recorded by setGlobDefault() go by the current
+// value.
+func configValue(name string, value string) (interface{}, error) {
+	var v interface{}
+	var err error
+	def, ok := globDefaults[name]
+	if !ok {
+		def = globs.Get(name)
+	}
+	switch def.(type) {
+	case bool:
+		v, err = strconv.ParseBool(value)
+	case int:
+		v, err = strconv.Atoi(value)
+	default:
+		v = value
+	}
+	if err != nil {
+		return nil, out.NewErr(fmt.Sprintf("Setting %s can't be set to \"%s\": %s", name, value, err), 2038)
+	}
+	return v, nil
+}
+
+// showCfgSettings dumps the given settings in text form as columns (or in
+// the --look given), the fields shown depend on the verbosity
+func showCfgSettings(apiContext string, fields []string, list []*cfgSetting) {
+	items := make([]interface{}, 0, len(list))
+	for _, setting := range list {
+		items = append(items, setting)
+	}
+	verbosity := lookVerbosity()
+	if verbosity == "terse" {
+		fields = fields[:2]
+	}
+	var output string
+	var fatalProblem bool
+	if lookIsStructured() {
+		output, fatalProblem = renderItems(apiContext, "settings", verbosity, fields, items)
+	} else {
+		output, fatalProblem = renderTable(fields, items)
+	}
+	out.Print(output)
+	if fatalProblem {
+		out.Exit(-1)
+	}
+}
+
+// configGet defines the 'dvln config get' sub-command, it shows the value of
+// a setting in effect (and where it came from) or set in a config file
+func configGet(cmd *cli.Command, args []string) {
+	out.Debugln("Initialization done, firing up configGet()")
+	errExit := int(out.ErrorExitVal())
+	if len(args) != 1 {
+		out.IssueExit(errExit, out.NewErr("Please give the setting to get, run 'dvln help config get' for usage", 2018))
+		return
+	}
+	scope, err := configScope("")
+	if err != nil {
+		out.IssueExit(errExit, err)
+		return
+	}
+	name := strings.ToLower(args[0])
+	if scope == "" {
+		if name, err = configName(name); err != nil {
+			out.IssueExit(errExit, err)
+			return
+		}
+		showCfgSettings("dvlnConfigGet", []string{"name", "value", "source"}, []*cfgSetting{{Name: name, Value: globs.Get(name), Source: settingSource(name)}})
+		return
+	}
+	cf, err := readCfgFile(scope)
+	if err != nil {
+		out.ErrorExit(errExit, err)
+		return
+	}
+	key, err := cf.fileSettingKey(name)
+	if err != nil {
+		out.IssueExit(errExit, err)
+		return
+	}
+	showCfgSettings("dvlnConfigGet", []string{"name", "value", "scope", "file"}, []*cfgSetting{{Name: name, Value: cf.settings[key], Scope: scope, File: cf.file}})
+}
+
+// configSet defines the 'dvln config set' sub-command, it sets a setting in
+// the users (or workspace) config file
+func configSet(cmd *cli.Command, args []string) {
+	out.Debugln("Initialization done, firing up configSet()")
+	errExit := int(out.ErrorExitVal())
+	if len(args) != 2 {
+		out.IssueExit(errExit, out.NewErr("Please give the setting and the value to set it to, run 'dvln help config set' for usage", 2018))
+		return
+	}
+	scope, err := configScope("user")
+	var name string
+	var value interface{}
+	if err == nil {
+		name, err = configName(args[0])
+	}
+	if err == nil {
+		value, err = configValue(name, args[1])
+	}
+	if err != nil {
+		out.IssueExit(errExit, err)
+		return
+	}
+	cf, err := readCfgFile(scope)
+	if err != nil {
+		out.ErrorExit(errExit, err)
+		return
+	}
+	if key := cf.key(name); key != "" {
+		delete(cf.settings, key)
+	}
+	cf.settings[name] = value
+	if err = cf.write(); err != nil {
+		out.ErrorExit(errExit, err)
+		return
+	}
+	if lookIsStructured() {
+		showCfgSettings("dvlnConfigSet", []string{"name", "value", "scope", "file"}, []*cfgSetting{{Name: name, Value: value, Scope: scope, File: cf.file}})
+		return
+	}
+	out.Printf("Set %s to %v in the %s config file (%s)\n", name, value, scope, cf.file)
+}
+
+// configUnset defines the 'dvln config unset' sub-command, it removes a
+// setting from the users (or workspace) config file
+func configUnset(cmd *cli.Command, args []string) {
+	out.Debugln("Initialization done, firing up configUnset()")
+	errExit := int(out.ErrorExitVal())
+	if len(args) != 1 {
+		out.IssueExit(errExit, out.NewErr("Please give the setting to unset, run 'dvln help config unset' for usage", 2018))
+		return
+	}
+	scope, err := configScope("user")
+	if err != nil {
+		out.IssueExit(errExit, err)
+		return
+	}
+	name := strings.ToLower(args[0])
+	cf, err := readCfgFile(scope)
+	if err != nil {
+		out.ErrorExit(errExit, err)
+		return
+	}
+	key, err := cf.fileSettingKey(name)
+	if err != nil {
+		out.IssueExit(errExit, err)
+		return
+	}
+	value := cf.settings[key]
+	delete(cf.settings, key)
+	if err = cf.write(); err != nil {
+		out.ErrorExit(errExit, err)
+		return
+	}
+	if lookIsStructured() {
+		showCfgSettings("dvlnConfigUnset", []string{"name", "value", "scope", "file"}, []*cfgSetting{{Name: name, Value: value, Scope: scope, File: cf.file}})
+		return
+	}
+	out.Printf("Removed %s from the %s config file (%s)\n", name, scope, cf.file)
+}
+
+// configList defines the 'dvln config list' sub-command, it lists the
+// settings in the users and workspace config files (or just one of them)
+func configList(cmd *cli.Command, args []string) {
+	out.Debugln("Initialization done, firing up configList()")
+	errExit := int(out.ErrorExitVal())
+	if len(args) != 0 {
+		out.IssueExit(errExit, out.NewErr("No arguments expected, run 'dvln help config list' for usage", 2018))
+		return
+	}
+	scope, err := configScope("")
+	if err != nil {
+		out.IssueExit(errExit, err)
+		return
+	}
+	scopes := []string{scope}
+	if scope == "" {
+		scopes = configScopes
+		if rootDir, err := findWkspcRootDir(); err != nil || rootDir == "" {
+			scopes = scopes[:1] // not in a workspace, just the users config
+		}
+	}
+	var list []*cfgSetting
+	for _, scope := range scopes {
+		cf, err := readCfgFile(scope)
+		if err != nil {
+			out.ErrorExit(errExit, err)
+			return
+		}
+		for _, key := range cf.settings.keys() {
+			list = append(list, &cfgSetting{Name: strings.ToLower(key), Value: cf.settings[key], Scope: scope, File: cf.file})
+		}
+	}
+	fields := []string{"name", "value", "scope"}
+	if globs.GetBool("verbose") {
+		fields = append(fields, "file")
+	}
+	showCfgSettings("dvlnConfigList", fields, list)
+}
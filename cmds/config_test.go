@@ -0,0 +1,127 @@
+// Copyright © 2015 Erik Brady <brady@dvln.org>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmds
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestConfigValue(t *testing.T) {
+	snap := snapshotGlobs()
+	defer snap.restore()
+	// the current values are strings (as if from env) but the defaults
+	// say what type the settings are
+	setGlob("fatalon", "7", "test")
+	setGlob("interact", "true", "test")
+	tests := []struct {
+		name, value string
+		want        interface{}
+	}{
+		{"fatalon", "3", 3},
+		{"interact", "false", false},
+		{"jobs", "4", "4"},
+		{"devline", "proj_x", "proj_x"},
+		{"fatalon", "x", nil},
+		{"interact", "maybe", nil},
+	}
+	for _, test := range tests {
+		got, err := configValue(test.name, test.value)
+		if test.want == nil {
+			if err == nil {
+				t.Errorf("%s value %q: got %#v, want an error", test.name, test.value, got)
+			}
+		} else if err != nil || got != test.want {
+			t.Errorf("%s value %q: got %#v (err: %v), want %#v", test.name, test.value, got, err, test.want)
+		}
+	}
+}
+
+// TestConfigSetUnset runs set and unset on config files in each format,
+// a setting dvln doesn't know can be unset and the settings are read back
+func TestConfigSetUnset(t *testing.T) {
+	os.Setenv("PKG_OUT_NO_EXIT", "1")
+	defer os.Setenv("PKG_OUT_NO_EXIT", "0")
+	root, err := ioutil.TempDir("", "dvlncfg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	tests := []struct {
+		scope, file, data string
+		comments          bool
+	}{
+		{"user", "json/cfg.json", `{"jobs": 2, "oldsetting": "x"}`, false},
+		{"user", "toml/cfg.toml", "# team settings\njobs = \"2\"\noldsetting = \"x\" # gone\n", true},
+		{"user", "yaml/cfg.yaml", "# team settings\njobs: \"2\"\noldsetting: x\n", true},
+		{"workspace", "wkspc/.dvln/cfg.toml", "jobs = \"2\"\noldsetting = \"x\"\n", false},
+	}
+	for _, test := range tests {
+		file := filepath.Join(root, filepath.FromSlash(test.file))
+		if err = os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err = ioutil.WriteFile(file, []byte(test.data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		snap := snapshotGlobs()
+		setGlob("scope", test.scope, "test")
+		setGlob("config", filepath.Dir(file), "test")
+		setGlob("wkspcdir", filepath.Join(root, "wkspc"), "test")
+
+		cf, err := readCfgFile(test.scope)
+		if err != nil || cf.file != file || cf.comments != test.comments {
+			t.Errorf("%s: read %+v (err: %v), want file %s, comments: %v", test.file, cf, err, file, test.comments)
+		}
+		configSet(nil, []string{"fatalon", "3"})
+		configSet(nil, []string{"interact", "true"})
+		configUnset(nil, []string{"oldsetting"})
+		configUnset(nil, []string{"JOBS"})
+		configSet(nil, []string{"bogus", "1"}) // refused
+
+		if cf, err = readCfgFile(test.scope); err != nil {
+			t.Errorf("%s: unable to read it back: %s", test.file, err)
+		} else if got := fmt.Sprint(cf.settings); got != "map[fatalon:3 interact:true]" {
+			t.Errorf("%s: settings %s after set/unset, want fatalon 3 and interact true", test.file, got)
+		}
+		snap.restore()
+	}
+}
+
+func TestCfgHasComments(t *testing.T) {
+	tests := []struct {
+		file, data string
+		comments   bool
+	}{
+		{"cfg.toml", "devline = \"a#b\"\njobs = \"2\"\n", false},
+		{"cfg.toml", "devline = \"say \\\"#1\\\"\"\n", false},
+		{"cfg.toml", "devline = 'a#b'\n", false},
+		{"cfg.toml", "note = \"\"\"\nnot # a comment\n\"\"\"\njobs = \"2\"\n", false},
+		{"cfg.toml", "note = \"\"\"\nno comment\n\"\"\"\njobs = \"2\" # a comment\n", true},
+		{"cfg.toml", "# settings\njobs = \"2\"\n", true},
+		{"cfg.toml", "jobs = \"2\"#2 cpus\n", true},
+		{"cfg.yaml", "devline: a#b\nnote: don't\n", false},
+		{"cfg.yaml", "devline: \"a #b\"\n", false},
+		{"cfg.yaml", "devline: a # b\n", true},
+		{"cfg.json", "{\"devline\": \"a # b\"}", false},
+	}
+	for _, test := range tests {
+		if got := cfgHasComments(test.file, []byte(test.data)); got != test.comments {
+			t.Errorf("%s %q: comments %v, want %v", test.file, test.data, got, test.comments)
+		}
+	}
+}
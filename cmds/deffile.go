@@ -0,0 +1,493 @@
+// Copyright © 2015 Erik Brady <brady@dvln.org>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package cmds deffile.go module handles the file formats codebase and
+// devline definitions can be written in (TOML, YAML or JSON, based on the
+// file extension with JSON the default) and reporting problems in those
+// files with the line number they're on.
+package cmds
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/dvln/out"
+	"github.com/dvln/toml"
+	"github.com/dvln/yaml"
+)
+
+// defExts are the definition file extensions we look for (in this order)
+// when given a codebase or devline name rather than a file
+var defExts = []string{".json", ".toml", ".yaml", ".yml"}
+
+// defFormat returns the format (json, toml or yaml) of the given definition
+// file (or URL) based on it's extension, JSON if no known extension
+func defFormat(file string) string {
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".toml":
+		return "toml"
+	case ".yaml", ".yml":
+		return "yaml"
+	}
+	return "json"
+}
+
+// decodeDef parses the given definition file data into the given struct
+// based on the format of the file, the error (if any) includes the line
+// number where the problem was found if we can determine it
+func decodeDef(file string, data []byte, v interface{}) error {
+	var err error
+	switch defFormat(file) {
+	case "toml":
+		_, err = toml.Decode(string(data), v) // errors include the line #
+	case "yaml":
+		err = yaml.Unmarshal(data, v) // errors include the line #
+	default:
+		err = json.Unmarshal(data, v)
+		switch jsonErr := err.(type) {
+		case *json.SyntaxError:
+			err = fmt.Errorf("line %d: %s", defOffsetLine(data, jsonErr.Offset), jsonErr)
+		case *json.UnmarshalTypeError:
+			err = fmt.Errorf("line %d: %s", defOffsetLine(data, jsonErr.Offset), jsonErr)
+		}
+	}
+	return err
+}
+
+// encodeDef returns the given definition in the format of the given file
+func encodeDef(file string, v interface{}) ([]byte, error) {
+	switch defFormat(file) {
+	case "toml":
+		var buf bytes.Buffer
+		err := toml.NewEncoder(&buf).Encode(v)
+		return buf.Bytes(), err
+	case "yaml":
+		return yaml.Marshal(v)
+	}
+	data, err := json.MarshalIndent(v, "", "  ")
+	return append(data, '\n'), err
+}
+
+// defOffsetLine returns the line number a byte offset into a file is on
+func defOffsetLine(data []byte, offset int64) int {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	return bytes.Count(data[:offset], []byte("\n")) + 1
+}
+
+// defLines maps the values set in a definition file to the line # they are
+// set on, values are identified by their path within the file structure, eg:
+// "packages.2.name" (the name of the 3rd package), "remove.0" or
+// "settings.jobs".  This is used to point at the right spot in the file for
+// problems found after the file has been parsed.
+type defLines map[string]int
+
+// defPath joins the given path elements (keys and list indexes), eg:
+// defPath("packages", 2, "name") is "packages.2.name"
+func defPath(elems ...interface{}) string {
+	strs := make([]string, 0, len(elems))
+	for _, elem := range elems {
+		if str := fmt.Sprint(elem); str != "" {
+			strs = append(strs, str)
+		}
+	}
+	return strings.Join(strs, ".")
+}
+
+// line returns the line # the value at the given path is set on, if it isn't
+// set in the file (eg: a package with no name) the line of the closest value
+// it would be within is used (eg: the package), 0 if none of them are known
+func (dl defLines) line(elems ...interface{}) int {
+	for n := len(elems); n > 0; n-- {
+		if line, ok := dl[defPath(elems[:n]...)]; ok {
+			return line
+		}
+	}
+	return 0
+}
+
+// scanDefLines scans a definition file (that has already been parsed so it
+// is known to be valid) for the line # each value is set on
+func scanDefLines(file string, data []byte) defLines {
+	switch defFormat(file) {
+	case "toml":
+		return scanTOMLLines(data)
+	case "yaml":
+		return scanYAMLLines(data)
+	}
+	return scanJSONLines(data)
+}
+
+// scanJSONLines is scanDefLines() for JSON, object values are on the line
+// of their key and list items on their own line
+func scanJSONLines(data []byte) defLines {
+	dl := make(defLines)
+	dec := json.NewDecoder(bytes.NewReader(data))
+	var scan func(path string) bool
+	scan = func(path string) bool {
+		tok, err := dec.Token()
+		if err != nil {
+			return false
+		}
+		if _, ok := dl[path]; !ok && path != "" {
+			dl[path] = defOffsetLine(data, dec.InputOffset())
+		}
+		switch tok {
+		case json.Delim('{'):
+			for dec.More() {
+				key, err := dec.Token()
+				if err != nil {
+					return false
+				}
+				keyPath := defPath(path, key)
+				dl[keyPath] = defOffsetLine(data, dec.InputOffset())
+				if !scan(keyPath) {
+					return false
+				}
+			}
+			_, err = dec.Token()
+		case json.Delim('['):
+			for i := 0; dec.More(); i++ {
+				if !scan(defPath(path, i)) {
+					return false
+				}
+			}
+			_, err = dec.Token()
+		}
+		return err == nil
+	}
+	scan("")
+	return dl
+}
+
+// scanTOMLLines is scanDefLines() for TOML, tables ([name]), arrays of
+// tables ([[name]]), keys, the items of (possibly multi-line) arrays and the
+// keys of inline tables are mapped to their line.  Multi-line strings are
+// skipped over, their lines are part of the value of their key.
+func scanTOMLLines(data []byte) defLines {
+	dl := make(defLines)
+	tableCnt := make(map[string]int) // # of each array of tables seen
+	table := ""
+	arrayPath := "" // set while in a multi-line array
+	arrayIdx := 0
+	arrayDepth := 0 // bracket depth within the multi-line array
+	mlDelim := ""   // set while in a multi-line string
+	for i, line := range strings.Split(string(data), "\n") {
+		if mlDelim != "" {
+			if strings.Contains(line, mlDelim) {
+				mlDelim = ""
+			}
+			continue
+		}
+		line = strings.TrimSpace(stripDefComment(line, "toml"))
+		switch {
+		case line == "":
+		case arrayPath != "":
+			depth := arrayDepth + defDepth(line)
+			items := line
+			if depth <= 0 {
+				items = strings.TrimSuffix(line, "]")
+			}
+			if arrayDepth == 1 {
+				// items of nested arrays spanning lines aren't mapped
+				for _, item := range splitDefValues(items) {
+					dl[defPath(arrayPath, arrayIdx)] = i + 1
+					dl.addInline(defPath(arrayPath, arrayIdx), item, "=", i+1)
+					arrayIdx++
+				}
+			}
+			if arrayDepth = depth; depth <= 0 {
+				arrayPath = ""
+			}
+		case strings.HasPrefix(line, "[["):
+			name := strings.TrimSpace(strings.Trim(line, "[]"))
+			table = defPath(name, tableCnt[name])
+			tableCnt[name]++
+			dl[table] = i + 1
+		case strings.HasPrefix(line, "["):
+			table = strings.TrimSpace(strings.Trim(line, "[]"))
+			dl[table] = i + 1
+		default:
+			key, value, ok := splitDefKey(line, "=")
+			if !ok {
+				continue
+			}
+			path := defPath(table, key)
+			dl[path] = i + 1
+			for _, delim := range []string{`"""`, "'''"} {
+				if strings.HasPrefix(value, delim) && !strings.Contains(value[len(delim):], delim) {
+					mlDelim = delim
+				}
+			}
+			if !strings.HasPrefix(value, "[") {
+				dl.addInline(path, value, "=", i+1)
+				continue
+			}
+			if depth := defDepth(value); depth > 0 {
+				arrayPath, arrayIdx, arrayDepth = path, 0, depth
+				for _, item := range splitDefValues(value[1:]) {
+					dl[defPath(path, arrayIdx)] = i + 1
+					dl.addInline(defPath(path, arrayIdx), item, "=", i+1)
+					arrayIdx++
+				}
+				continue
+			}
+			dl.addInline(path, value, "=", i+1)
+		}
+	}
+	return dl
+}
+
+// yamlFrame is a mapping key or sequence item being scanned, it's the
+// parent of the lines indented below it
+type yamlFrame struct {
+	col   int    // column the key or sequence item ('-') is in
+	path  string // path of the key or item
+	item  bool   // true if a sequence item
+	items int    // # of sequence items seen below the key
+}
+
+// scanYAMLLines is scanDefLines() for (block style) YAML, keys, sequence
+// items and the items (and keys) of flow collections ([a, b] or {a: b}) are
+// mapped to their line.  Lines indented below a key that has a value on
+// it's line (eg: a block scalar, "key: |") are part of that value.
+func scanYAMLLines(data []byte) defLines {
+	dl := make(defLines)
+	var stack []*yamlFrame
+	parent := func() *yamlFrame {
+		if len(stack) == 0 {
+			return &yamlFrame{col: -1}
+		}
+		return stack[len(stack)-1]
+	}
+	valueCol := -1 // set to the key column while in a multi-line value
+	for i, line := range strings.Split(string(data), "\n") {
+		content := strings.TrimSpace(stripDefComment(line, "yaml"))
+		if content == "" || content == "---" {
+			continue
+		}
+		col := len(line) - len(strings.TrimLeft(line, " "))
+		if col > valueCol && valueCol >= 0 {
+			continue
+		}
+		valueCol = -1
+		for strings.HasPrefix(content, "-") && (len(content) == 1 || content[1] == ' ') {
+			// a sequence item, of the key above (which can be at the same
+			// column) or of an enclosing item, any items before it are done
+			for len(stack) != 0 && (parent().col > col || parent().col == col && parent().item) {
+				stack = stack[:len(stack)-1]
+			}
+			p := parent()
+			frame := &yamlFrame{col: col, path: defPath(p.path, p.items), item: true}
+			p.items++
+			dl[frame.path] = i + 1
+			stack = append(stack, frame)
+			rest := strings.TrimLeft(content[1:], " ")
+			col += len(content) - len(rest)
+			content = rest
+		}
+		for len(stack) != 0 && parent().col >= col {
+			stack = stack[:len(stack)-1]
+		}
+		key, value, ok := splitDefKey(content, ":")
+		if !ok {
+			continue // a scalar sequence item
+		}
+		frame := &yamlFrame{col: col, path: defPath(parent().path, key)}
+		dl[frame.path] = i + 1
+		stack = append(stack, frame)
+		// a value that's only an anchor or tag (eg: "key: &base") is
+		// followed by the real value on the lines below
+		if value != "" && (!strings.ContainsAny(value[:1], "&!") || strings.ContainsRune(value, ' ')) {
+			valueCol = col
+			dl.addInline(frame.path, value, ":", i+1)
+		}
+	}
+	return dl
+}
+
+// addInline maps the items of an inline array or flow sequence ([a, b]) and
+// the keys of an inline table or flow mapping ({a = b} or {a: b}), given as
+// the value at the given path, to the given line (nested ones too)
+func (dl defLines) addInline(path string, value string, sep string, line int) {
+	value = strings.TrimSpace(value)
+	var items []string
+	switch {
+	case strings.HasPrefix(value, "["):
+		items = splitDefValues(strings.TrimSuffix(value[1:], "]"))
+	case strings.HasPrefix(value, "{"):
+		items = splitDefValues(strings.TrimSuffix(value[1:], "}"))
+	default:
+		return
+	}
+	for idx, item := range items {
+		itemPath := defPath(path, idx)
+		if value[0] == '{' {
+			key, itemValue, ok := splitDefKey(item, sep)
+			if !ok {
+				continue
+			}
+			itemPath, item = defPath(path, key), itemValue
+		}
+		dl[itemPath] = line
+		dl.addInline(itemPath, item, sep, line)
+	}
+}
+
+// scanDefLine calls fn for each rune (and it's index) of the given TOML or
+// YAML line that isn't within a quoted string, stopping if fn returns false.
+// A quote only starts a string at the start of a key or value (so the
+// apostrophe in a YAML plain scalar like don't doesn't), backslash escapes
+// are honored in double quoted strings.
+func scanDefLine(line string, fn func(i int, c rune) bool) {
+	quote := rune(0)
+	escaped := false
+	prev := ' '
+	for i, c := range line {
+		switch {
+		case escaped:
+			escaped = false
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				escaped = true
+			} else if c == quote {
+				quote = 0
+			}
+		case (c == '"' || c == '\'') && strings.ContainsRune(" \t[{,=:", prev):
+			quote = c
+		default:
+			if !fn(i, c) {
+				return
+			}
+		}
+		prev = c
+	}
+}
+
+// defDepth returns how many more arrays and inline tables are opened than
+// closed on the given line (sans comment), quoted brackets aren't counted
+func defDepth(line string) int {
+	depth := 0
+	scanDefLine(line, func(i int, c rune) bool {
+		switch c {
+		case '[', '{':
+			depth++
+		case ']', '}':
+			depth--
+		}
+		return true
+	})
+	return depth
+}
+
+// stripDefComment removes any '#' comment from a line of a TOML or YAML
+// (format "toml" or "yaml") file, in YAML a comment must follow a space
+// (eg: the '#' in "url: http://host/#anchor" is part of the value)
+func stripDefComment(line string, format string) string {
+	end := len(line)
+	scanDefLine(line, func(i int, c rune) bool {
+		if c == '#' && (format != "yaml" || i == 0 || line[i-1] == ' ' || line[i-1] == '\t') {
+			end = i
+			return false
+		}
+		return true
+	})
+	return line[:end]
+}
+
+// splitDefKey splits a TOML (sep "=") or YAML (sep ":") line into the key
+// (unquoted) and the value, ok is false if the line doesn't set a key
+func splitDefKey(line string, sep string) (string, string, bool) {
+	key, value := "", ""
+	scanDefLine(line, func(i int, c rune) bool {
+		if string(c) != sep {
+			return true
+		}
+		rest := line[i+1:]
+		if sep == ":" && rest != "" && rest[0] != ' ' {
+			return true // eg: a URL, not a key
+		}
+		key = strings.Trim(strings.TrimSpace(line[:i]), `"'`)
+		value = strings.TrimSpace(rest)
+		return false
+	})
+	return key, value, key != ""
+}
+
+// splitDefValues splits the comma separated values of an inline array (or a
+// line of a multi-line array), commas within nested arrays, inline tables
+// or strings don't split, empty values (eg: after a trailing comma) are
+// dropped
+func splitDefValues(list string) []string {
+	var values []string
+	start := 0
+	depth := 0
+	add := func(end int) {
+		if value := strings.TrimSpace(list[start:end]); value != "" {
+			values = append(values, value)
+		}
+		start = end + 1
+	}
+	scanDefLine(list, func(i int, c rune) bool {
+		switch c {
+		case '[', '{':
+			depth++
+		case ']', '}':
+			depth--
+		case ',':
+			if depth == 0 {
+				add(i)
+			}
+		}
+		return true
+	})
+	add(len(list))
+	return values
+}
+
+// defErrs gathers up the problems found while validating a definition file
+// so they can all be reported at once (with line numbers)
+type defErrs struct {
+	file  string
+	lines defLines
+	msgs  []string
+}
+
+// newDefErrs returns the problem list for the given definition file, the
+// file data is scanned so problems can be reported with line numbers
+func newDefErrs(file string, data []byte) *defErrs {
+	return &defErrs{file: file, lines: scanDefLines(file, data)}
+}
+
+// add records a problem found on the given line (0 if not known) of the
+// definition file, see defLines.line() to look the line up
+func (de *defErrs) add(line int, format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	if line != 0 {
+		msg = fmt.Sprintf("line %d: %s", line, msg)
+	}
+	de.msgs = append(de.msgs, msg)
+}
+
+// err returns nil if no problems were found, else an error with the given
+// summary and issue code listing the problems
+func (de *defErrs) err(summary string, code int) error {
+	if len(de.msgs) == 0 {
+		return nil
+	}
+	return out.NewErr(fmt.Sprintf("%s: %s\n  %s", summary, de.file, strings.Join(de.msgs, "\n  ")), code)
+}
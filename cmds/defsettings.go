@@ -0,0 +1,130 @@
+// Copyright © 2015 Erik Brady <brady@dvln.org>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package cmds defsettings.go module handles the settings a codebase or a
+// devline definition can carry for the team working on them, eg: a default
+// fatalon or jobs setting or the dvln version required, eg in TOML:
+//
+//	[settings]
+//	fatalon = 0
+//	jobs = 4
+//	dvlnminver = "0.3.0"
+//
+// Only the settings in defSettable can be given.  These act as team defaults
+// so the codebase settings override the dvln defaults, devline settings
+// override the codebase settings (and those of any devline inherited from)
+// while the users config, the workspace config, env and CLI settings all
+// override them.  Settings are merged as the devline is resolved (see
+// resolveDevlineChain()), after which the setting values are checked again
+// and the dvlnminver setting, however it is set, is checked.
+package cmds
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/dvln/out"
+	globs "github.com/dvln/viper"
+)
+
+// defSettable are the settings a codebase or devline can give
+var defSettable = []string{"dvlnminver", "fatalon", "jobs", "logfilelevel"}
+
+// settings are the 'globs' (viper) settings given in a codebase or devline
+type settings map[string]interface{}
+
+// keys returns the settings names (lower case, as 'globs' uses) in order
+func (s settings) keys() []string {
+	keys := make([]string, 0, len(s))
+	for key := range s {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// validateSettings checks the settings in a codebase or devline definition,
+// any problems are added to the given definition errors
+func validateSettings(s settings, de *defErrs) {
+	for _, key := range s.keys() {
+		if !stringInSlice(strings.ToLower(key), defSettable) {
+			de.add(de.lines.line("settings", key), "setting \"%s\" can't be set in a definition (only %s can)", key, strings.Join(defSettable, ", "))
+		}
+	}
+}
+
+// mergeSettings merges the settings of the given codebase and devline chain
+// (see loadDevlineChain()) into 'globs' (viper), a setting is only set if it
+// still has it's default value or was set by a codebase or an earlier devline
+// in the chain.  Once merged the setting values are checked as they are at
+// startup (see checkSettingValues()) and the dvln version required (if any)
+// is checked.
+func mergeSettings(cb *codebaseDef, chain []*devlineDef) error {
+	mergeDefSettings(cb.Settings, "codebase:"+cb.Name)
+	for _, dl := range chain {
+		mergeDefSettings(dl.Settings, "devline:"+dl.Name)
+	}
+	if err := checkSettingValues(); err != nil {
+		return err
+	}
+	// The log file level is only set at startup when logging is turned on,
+	// a definition may change it
+	if isDefSource(settingSource("logfilelevel")) && out.Threshold(out.ForLogfile) != out.LevelDiscard {
+		out.SetThreshold(out.LevelString2Level(globs.GetString("logfilelevel")), out.ForLogfile)
+	}
+	return checkDvlnMinVer()
+}
+
+// isDefSource returns true if the given setting source (see globSource())
+// is a codebase or devline definition
+func isDefSource(source string) bool {
+	return strings.HasPrefix(source, "codebase:") || strings.HasPrefix(source, "devline:")
+}
+
+// mergeDefSettings merges a single codebase or devline's settings into globs
+// - source: where the settings come from, eg: "codebase:<name>"
+func mergeDefSettings(s settings, source string) {
+	for _, key := range s.keys() {
+		lkey := strings.ToLower(key)
+		if !stringInSlice(lkey, defSettable) {
+			continue // refused when the definition was loaded
+		}
+		current := settingSource(lkey)
+		if current != "default" && !isDefSource(current) {
+			out.Debugf("Setting %s from %s overridden by %s\n", lkey, source, current)
+			continue
+		}
+		out.Debugf("Setting %s to %v from %s\n", lkey, s[key], source)
+		setGlob(lkey, s[key], source)
+	}
+}
+
+// checkDvlnMinVer makes sure this dvln is at least the version required by
+// the dvlnminver setting (if set), the running version comes from the
+// 'dvlnver' setting the dvln/lib pkg sets up.  If the running version isn't
+// known the requirement can't be shown to be met so that's an error too.
+func checkDvlnMinVer() error {
+	minVer := globs.GetString("dvlnminver")
+	if minVer == "" {
+		return nil
+	}
+	ver := globs.GetString("dvlnver")
+	if ver == "" {
+		return out.NewErr(fmt.Sprintf("Unable to determine the dvln version, version %s or later is required (set by %s)", minVer, settingSource("dvlnminver")), 2037)
+	}
+	if versionLess(ver, minVer) {
+		return out.NewErr(fmt.Sprintf("This dvln is version %s but version %s or later is required (set by %s)", ver, minVer, settingSource("dvlnminver")), 2037)
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+// Copyright © 2015 Erik Brady <brady@dvln.org>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmds
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	globs "github.com/dvln/viper"
+)
+
+func TestValidateSettings(t *testing.T) {
+	data := []byte("{\n  \"settings\": {\n    \"jobs\": 4,\n    \"look\": \"json\"\n  }\n}\n")
+	de := newDefErrs("cb.json", data)
+	validateSettings(settings{"jobs": 4, "look": "json"}, de)
+	if len(de.msgs) != 1 || !strings.HasPrefix(de.msgs[0], "line 4: setting \"look\" can't be set in a definition") {
+		t.Errorf("Got problems %q, want just the look setting refused on line 4", de.msgs)
+	}
+}
+
+func TestMergeSettings(t *testing.T) {
+	snap := snapshotGlobs()
+	defer snap.restore()
+	setGlob("dvlnver", "1.0", "test")
+	setGlob("logfilelevel", "trace", "config:user") // stands in for the users config
+	os.Setenv(globsEnvVar("fatalon"), "5")
+	defer os.Unsetenv(globsEnvVar("fatalon"))
+
+	cb := &codebaseDef{Name: "cb", Settings: settings{"jobs": "2", "logfilelevel": "debug", "dvlnminver": "0.9"}}
+	chain := []*devlineDef{
+		{Name: "base", Settings: settings{"jobs": "3", "fatalon": 3}},
+		{Name: "fix", Settings: settings{"jobs": "4"}},
+	}
+	if err := mergeSettings(cb, chain); err != nil {
+		t.Fatalf("Unexpected merge failure: %s", err)
+	}
+	for key, want := range map[string][2]string{
+		"jobs":         {"4", "devline:fix"},
+		"dvlnminver":   {"0.9", "codebase:cb"},
+		"logfilelevel": {"trace", "config:user"},
+	} {
+		if value, source := globs.GetString(key), settingSource(key); value != want[0] || source != want[1] {
+			t.Errorf("Setting %s: got %s from %s, want %s from %s", key, value, source, want[0], want[1])
+		}
+	}
+	if source := settingSource("fatalon"); source != "env:DVLN_FATALON" {
+		t.Errorf("Setting fatalon: source %s, want the env var", source)
+	}
+
+	// merged values are checked like those given at startup
+	for key, value := range map[string]interface{}{"jobs": "lots", "fatalon": "x"} {
+		bad := &codebaseDef{Name: "bad", Settings: settings{key: value}}
+		os.Unsetenv(globsEnvVar("fatalon"))
+		badSnap := snapshotGlobs()
+		err := mergeSettings(bad, nil)
+		badSnap.restore()
+		if err == nil || !strings.Contains(err.Error(), fmt.Sprintf("found: %v (from codebase:bad)", value)) {
+			t.Errorf("Bad %s value %v from a codebase: got error %v", key, value, err)
+		}
+	}
+}
+
+func TestDvlnMinVer(t *testing.T) {
+	snap := snapshotGlobs()
+	defer snap.restore()
+	tests := []struct {
+		ver, minVer string
+		ok          bool
+	}{
+		{"0.3.0", "", true},
+		{"", "", true},
+		{"0.3.0", "0.2.9", true},
+		{"0.3.0", "0.3.0", true},
+		{"0.3.0", "0.10.0", false},
+		{"0.3.0", "1.0", false},
+		{"", "0.1.0", false},
+	}
+	for _, test := range tests {
+		setGlob("dvlnver", test.ver, "test")
+		setGlob("dvlnminver", test.minVer, "test")
+		if err := checkDvlnMinVer(); (err == nil) != test.ok {
+			t.Errorf("dvln version %q, dvlnminver %q: got error %v, want ok: %v", test.ver, test.minVer, err, test.ok)
+		}
+	}
+}
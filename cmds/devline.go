@@ -0,0 +1,454 @@
+// Copyright © 2015 Erik Brady <brady@dvln.org>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package cmds devline.go module implements the 'dvln devline' subcommand
+// (and it's own subcommands, eg: 'dvln devline diff') framework for the
+// 'cli' (aka: cobra) package.
+package cmds
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	cli "github.com/dvln/cobra"
+	"github.com/dvln/out"
+	globs "github.com/dvln/viper"
+	"github.com/dvln/wkspc"
+)
+
+var devlineCmd = &cli.Command{
+	Use:   "devline",
+	Short: "examine devlines",
+	Long: `Examine devlines (and how they relate to the workspace), eg:
+  % dvln devline diff proj_x proj_y
+  % dvln devline resolve proj_x
+  % dvln help devline diff`,
+}
+
+var devlineDiffCmd = &cli.Command{
+	Use:   "diff",
+	Short: "compare two devlines or a devline and the workspace",
+	Long: `Show the packages added, removed and changed (version, remote, etc) going
+from one devline to another, or from a devline to the workspace, eg:
+  % dvln devline diff proj_x proj_y
+  % dvln devline diff proj_x           (compare proj_x to the workspace)
+  % dvln devline diff -p net/* proj_x proj_y
+Each devline is resolved (with it's parents) against it's own codebase,
+use --codebase|-c to resolve both against a given codebase instead`,
+	Run: devlineDiff,
+}
+
+var devlineResolveCmd = &cli.Command{
+	Use:   "resolve",
+	Short: "show (or freeze) the package versions a devline resolves to",
+	Long: `Resolve a devline, including it's parents and any rules it has (eg: the
+latest tag matching v2.*), into package versions and show them, or freeze
+them as exact revisions into a new static devline, eg:
+  % dvln devline resolve proj_x
+  % dvln devline resolve proj_x proj_x_rc1           (freeze into proj_x_rc1)
+  % dvln devline resolve --force proj_x proj_x_rc1   (overwrite proj_x_rc1)
+Note: freezing needs the VCS to list remote revisions (git), for other
+VCS types use 'dvln get' and then 'dvln freeze' on the workspace.  Versions
+that aren't a remote tag or branch must be revisions in the workspace.`,
+	Run: devlineResolve,
+}
+
+// init bootstraps the options used for the devline subcommands and
+// descriptions and initial defaults for those options and such.
+func init() {
+	reloadCLIFlags := false
+	devlineCmd.AddCommand(devlineDiffCmd)
+	devlineCmd.AddCommand(devlineResolveCmd)
+	setupDevlineCmdCLIArgs(devlineCmd, reloadCLIFlags)
+}
+
+// setupDevlineCmdCLIArgs is used from init() to set up the 'globs' (viper) pkg
+// CLI options available to this subcommand (other options were already set up
+// in the "parent" dvln subcommand in a like-named method). Every subcommand
+// has a like named method "setup<subcmd>CmdCLIArgs()", called in init() above
+// and called from dvln.go, this one also sets up the 'devline' subcommands.
+func setupDevlineCmdCLIArgs(c *cli.Command, reloadCLIFlags bool) {
+	var desc string
+	if reloadCLIFlags {
+		devlineDiffCmd.Flags().SetDefValueReparseOK(true)
+		devlineResolveCmd.Flags().SetDefValueReparseOK(true)
+	}
+	desc, _, _ = globs.Desc("codebase")
+	devlineDiffCmd.Flags().StringP("codebase", "c", globs.GetString("codebase"), desc)
+	desc, _, _ = globs.Desc("pkg")
+	devlineDiffCmd.Flags().StringP("pkg", "p", globs.GetString("pkg"), desc)
+	devlineDiffCmd.Run = devlineDiff
+	desc, _, _ = globs.Desc("codebase")
+	devlineResolveCmd.Flags().StringP("codebase", "c", globs.GetString("codebase"), desc)
+	desc, _, _ = globs.Desc("pkg")
+	devlineResolveCmd.Flags().StringP("pkg", "p", globs.GetString("pkg"), desc)
+	devlineResolveCmd.Run = devlineResolve
+	// NewCLIOpts: if there were opts for the subcmd set them here and note that
+	// "persistent" opts are set in cmds/dvln.go, only opts specific to the
+	// 'dvln devline' subcommands are set here
+	// Note that you'll need to modify cmds/global.go as well otherwise your
+	// globs.Desc() call and globs.GetBool("myopt") will not work.
+	if reloadCLIFlags {
+		devlineDiffCmd.Flags().SetDefValueReparseOK(false)
+		devlineResolveCmd.Flags().SetDefValueReparseOK(false)
+	}
+}
+
+// devlineDiff defines the 'dvln devline diff' sub-command, it resolves the
+// devlines (or devline and workspace) being compared into package sets and
+// shows the differences
+func devlineDiff(cmd *cli.Command, args []string) {
+	out.Debugln("Initialization done, firing up devlineDiff()")
+	errExit := int(out.ErrorExitVal())
+	if len(args) < 1 || len(args) > 2 {
+		out.IssueExit(errExit, out.NewErr("Please give one or two devlines to compare, run 'dvln help devline diff' for usage", 2018))
+		return
+	}
+	wkspcRootDir, err := wkspc.RootDir()
+	if err != nil {
+		out.ErrorExit(errExit, out.WrapErr(err, "Unexpected problem scanning for a workspace", 2006))
+		return
+	}
+	var info *wkspcInfo
+	if wkspcRootDir != "" {
+		if info, err = readWkspcInfo(wkspcRootDir); err != nil {
+			out.Debugln("Unable to read workspace info, ignoring:", err)
+			info = nil
+		}
+	}
+	from, err := resolveDiffDevline(args[0], info, wkspcRootDir)
+	if err != nil {
+		out.ErrorExit(errExit, err)
+		return
+	}
+	toName := "workspace"
+	var to []*resolvedPkg
+	if len(args) == 2 {
+		toName = args[1]
+		to, err = resolveDiffDevline(toName, info, wkspcRootDir)
+	} else if wkspcRootDir == "" {
+		err = out.NewErr("No workspace found to compare to, give a 2nd devline or use 'dvln get' to create one", 2016)
+	} else {
+		_, to, err = wkspcRecordedPkgs(wkspcRootDir)
+		if err == nil {
+			to, err = selectWkspcPkgs(wkspcRootDir, info, to, globs.GetString("pkg"))
+		}
+	}
+	if err != nil {
+		out.ErrorExit(errExit, err)
+		return
+	}
+	out.Debugf("Comparing %s (%d packages) to %s (%d packages)\n", args[0], len(from), toName, len(to))
+	showPkgDiff(args[0], toName, diffPkgs(from, to))
+}
+
+// resolveDiffDevline resolves a devline being compared into it's packages,
+// see resolveNamedDevline()
+func resolveDiffDevline(devline string, info *wkspcInfo, wkspcRootDir string) ([]*resolvedPkg, error) {
+	pkgs, _, _, err := resolveNamedDevline(devline, info, wkspcRootDir)
+	return pkgs, err
+}
+
+// resolveNamedDevline resolves a devline into it's packages (and what set
+// each package version), the codebase comes from --codebase, the devline or
+// the workspace (in that order), the package selector (if any) is applied
+// to the packages
+func resolveNamedDevline(devline string, info *wkspcInfo, wkspcRootDir string) ([]*resolvedPkg, map[string]string, *codebaseDef, error) {
+	codebase := globs.GetString("codebase")
+	if codebase == "" {
+		dlCodebase, err := devlineCodebase(devline)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		codebase = dlCodebase
+	}
+	if codebase == "" && info != nil {
+		codebase = info.Codebase
+	}
+	cb, err := loadCodebase(codebase)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	pkgs, origins, err := resolveDevlineChain(cb, devline)
+	if err == nil {
+		pkgs, err = selectPkgs(pkgs, globs.GetString("pkg"), cb, wkspcRootDir)
+	}
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return pkgs, origins, cb, nil
+}
+
+// pkgDiffItem is the JSON form of a package difference
+type pkgDiffItem struct {
+	Name        string `json:"name"`
+	Change      string `json:"change"`
+	FromVersion string `json:"fromVersion,omitempty"`
+	ToVersion   string `json:"toVersion,omitempty"`
+	FromRemote  string `json:"fromRemote,omitempty"`
+	ToRemote    string `json:"toRemote,omitempty"`
+}
+
+// showPkgDiff reports the differences between the two package sets based on
+// the terse/verbose and text/json output settings, unchanged packages are
+// only shown in verbose mode
+func showPkgDiff(fromName string, toName string, d *pkgDiff) {
+	verbosity := lookVerbosity()
+	items := pkgDiffItems(d, verbosity)
+	if lookIsStructured() {
+		fields := []string{"name", "change"}
+		if verbosity != "terse" {
+			fields = append(fields, "fromVersion", "toVersion")
+		}
+		if verbosity == "verbose" {
+			fields = append(fields, "fromRemote", "toRemote")
+		}
+		jsonItems := make([]interface{}, 0, len(items))
+		for _, item := range items {
+			jsonItems = append(jsonItems, item)
+		}
+		output, fatalProblem := renderItems("dvlnDevlineDiff", "devlineDiff", verbosity, fields, jsonItems)
+		out.Print(output)
+		if fatalProblem {
+			out.Exit(-1)
+		}
+		return
+	}
+	if verbosity != "terse" {
+		out.Printf("Comparing %s to %s: %d added, %d removed, %d changed, %d same\n", fromName, toName, len(d.Added), len(d.Removed), len(d.Changed), len(d.Same))
+	}
+	for _, item := range items {
+		switch {
+		case verbosity == "terse":
+			out.Printf("%s: %s\n", item.Name, item.Change)
+		case item.Change == "added":
+			out.Printf("+ %-24s %s\n", item.Name, item.ToVersion)
+		case item.Change == "removed":
+			out.Printf("- %-24s %s\n", item.Name, item.FromVersion)
+		case item.Change == "changed":
+			out.Printf("~ %-24s %s -> %s\n", item.Name, item.FromVersion, item.ToVersion)
+			if item.FromRemote != item.ToRemote {
+				out.Printf("  %-24s remote %s -> %s\n", "", item.FromRemote, item.ToRemote)
+			}
+		default:
+			out.Printf("  %-24s %s\n", item.Name, item.ToVersion)
+		}
+	}
+}
+
+// pkgDiffItems returns the items showPkgDiff() shows for the given diff,
+// added, removed and then changed packages (unchanged ones too if verbose)
+func pkgDiffItems(d *pkgDiff, verbosity string) []*pkgDiffItem {
+	var items []*pkgDiffItem
+	for _, p := range d.Added {
+		items = append(items, &pkgDiffItem{Name: p.Name, Change: "added", ToVersion: p.Version, ToRemote: p.Remote})
+	}
+	for _, p := range d.Removed {
+		items = append(items, &pkgDiffItem{Name: p.Name, Change: "removed", FromVersion: p.Version, FromRemote: p.Remote})
+	}
+	for _, c := range d.Changed {
+		items = append(items, &pkgDiffItem{Name: c.To.Name, Change: "changed", FromVersion: c.From.Version, ToVersion: c.To.Version, FromRemote: c.From.Remote, ToRemote: c.To.Remote})
+	}
+	if verbosity == "verbose" {
+		for _, p := range d.Same {
+			items = append(items, &pkgDiffItem{Name: p.Name, Change: "same", FromVersion: p.Version, ToVersion: p.Version})
+		}
+	}
+	return items
+}
+
+// devlineResolve defines the 'dvln devline resolve' sub-command, it resolves
+// a devline into package versions and shows them or, if a 2nd devline is
+// given, writes them as exact revisions into that (new) static devline
+func devlineResolve(cmd *cli.Command, args []string) {
+	out.Debugln("Initialization done, firing up devlineResolve()")
+	errExit := int(out.ErrorExitVal())
+	if len(args) < 1 || len(args) > 2 {
+		out.IssueExit(errExit, out.NewErr("Please give the devline to resolve (and optionally a devline to freeze it into), run 'dvln help devline resolve' for usage", 2018))
+		return
+	}
+	wkspcRootDir, err := wkspc.RootDir()
+	if err != nil {
+		out.ErrorExit(errExit, out.WrapErr(err, "Unexpected problem scanning for a workspace", 2006))
+		return
+	}
+	var info *wkspcInfo
+	if wkspcRootDir != "" {
+		if info, err = readWkspcInfo(wkspcRootDir); err != nil {
+			out.Debugln("Unable to read workspace info, ignoring:", err)
+			info = nil
+		}
+	}
+	var file string
+	if len(args) == 2 {
+		file = devlineFile(args[1])
+		if _, err = os.Stat(file); err == nil {
+			if err = protectDevline.guard(fmt.Sprintf("Devline %s already exists (%s)", args[1], file)); err != nil {
+				out.IssueExit(errExit, err)
+				return
+			}
+		}
+	}
+	pkgs, origins, cb, err := resolveNamedDevline(args[0], info, wkspcRootDir)
+	if err != nil {
+		out.ErrorExit(errExit, err)
+		return
+	}
+	if file == "" {
+		showResolvedPkgs(pkgs, origins)
+		return
+	}
+
+	results, budgetHit := runPkgJobs(pkgs, func(ctx context.Context, p *resolvedPkg) *pkgResult {
+		return resolvePkgRevision(ctx, p, wkspcRootDir)
+	}, reportPkgResult)
+	// Only a devline with every package at a revision is written, the
+	// results are the one response (they say which packages failed)
+	for _, r := range results {
+		if r.Err != nil || r.Action == "not run" || r.Action == "cancelled" {
+			if !lookIsStructured() {
+				out.Issueln(out.NewErr(fmt.Sprintf("Unable to resolve every package to a revision, devline %s not written", args[1]), 2023))
+			}
+			finishPkgJobs("dvlnDevlineResolve", results, budgetHit)
+			return
+		}
+	}
+	dl := &devlineDef{
+		Name:        filepath.Base(args[1]),
+		Description: fmt.Sprintf("Frozen from devline %s on %s", args[0], time.Now().Format(time.RFC1123)),
+		Codebase:    cb.Name,
+		Packages:    make([]*devlinePkg, 0, len(pkgs)),
+	}
+	for _, r := range results {
+		dl.Packages = append(dl.Packages, &devlinePkg{Name: r.Name, Revision: r.Revision})
+	}
+	if err = writeDevline(file, dl); err != nil {
+		out.ErrorExit(errExit, err)
+		return
+	}
+	out.Verboseln("Wrote devline to:", file)
+	finishPkgJobs("dvlnDevlineResolve", results, budgetHit)
+}
+
+// resolvePkgRevision finds the revision the package version (tag or branch)
+// refers to on the packages remote, versions that aren't a tag or branch
+// must be revisions, which the remote can't be asked about so they're looked
+// for in the package in the workspace (if there).  It's run as one of the
+// parallel package jobs (see jobs.go) so it must not print anything itself.
+func resolvePkgRevision(ctx context.Context, p *resolvedPkg, wkspcRootDir string) *pkgResult {
+	r := &pkgResult{Name: p.Name, Action: "frozen"}
+	tags, branches, err := vcsRemoteRefs(ctx, p)
+	if err != nil {
+		return r.failed(2015, err)
+	}
+	version := p.Version
+	if version == "" {
+		version = "HEAD" // no default branch given: whatever the remote uses
+	}
+	if rev, ok := tags[version]; ok {
+		r.Revision = rev
+	} else if rev, ok := branches[version]; ok {
+		r.Revision = rev
+	} else if refsHaveRevision(version, tags, branches) {
+		r.Revision = version
+	} else if version == "HEAD" {
+		return r.failed(2030, out.NewErr(fmt.Sprintf("Package %s: unable to determine the remote default branch, give the package a branch in the codebase", p.Name), 2030))
+	} else if found, err := wkspcPkgHasRevision(ctx, p, wkspcRootDir); err != nil {
+		return r.failed(2015, err)
+	} else if !found {
+		return r.failed(2030, out.NewErr(fmt.Sprintf("Package %s: version \"%s\" is not a tag or branch on the remote or a revision in the workspace package", p.Name, version), 2030))
+	} else {
+		r.Revision = version
+	}
+	r.Msgs = append(r.Msgs, fmt.Sprintf("version \"%s\" is revision %s", p.Version, r.Revision))
+	return r
+}
+
+// refsHaveRevision returns true if the given revision is what one of the
+// given tags or branches (mapped to their revisions) refers to
+func refsHaveRevision(rev string, refs ...map[string]string) bool {
+	for _, revs := range refs {
+		for _, refRev := range revs {
+			if refRev == rev {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// wkspcPkgHasRevision returns true if the package in the given workspace has
+// the packages version as a revision, false if not (or if the package isn't
+// in the workspace, so there's nowhere to look)
+func wkspcPkgHasRevision(ctx context.Context, p *resolvedPkg, wkspcRootDir string) (bool, error) {
+	if wkspcRootDir == "" {
+		return false, nil
+	}
+	pkgDir, err := wkspcPkgDir(wkspcRootDir, p.Path)
+	if err != nil {
+		return false, err
+	}
+	if _, err = os.Stat(pkgDir); err != nil {
+		return false, nil
+	}
+	return vcsHasRevision(ctx, p, pkgDir, p.Version)
+}
+
+// showResolvedPkgs shows the packages (and versions) a devline resolved to
+// along with what set each version (in verbose mode)
+func showResolvedPkgs(pkgs []*resolvedPkg, origins map[string]string) {
+	verbosity := lookVerbosity()
+	if lookIsStructured() {
+		fields := []string{"name", "version"}
+		if verbosity != "terse" {
+			fields = append(fields, "setBy")
+		}
+		if verbosity == "verbose" {
+			fields = append(fields, "path", "vcs", "remote")
+		}
+		items := make([]interface{}, 0, len(pkgs))
+		for _, p := range pkgs {
+			items = append(items, map[string]interface{}{
+				"name":    p.Name,
+				"version": p.Version,
+				"setBy":   origins[p.Name],
+				"path":    p.Path,
+				"vcs":     p.VCS,
+				"remote":  p.Remote,
+			})
+		}
+		output, fatalProblem := renderItems("dvlnDevlineResolve", "packages", verbosity, fields, items)
+		out.Print(output)
+		if fatalProblem {
+			out.Exit(-1)
+		}
+		return
+	}
+	for _, p := range pkgs {
+		setBy := origins[p.Name]
+		if setBy == "" {
+			setBy = "codebase default branch"
+		}
+		switch verbosity {
+		case "terse":
+			out.Printf("%s: %s\n", p.Name, p.Version)
+		case "verbose":
+			out.Printf("%-24s %-20s (%s, %s %s)\n", p.Name, p.Version, setBy, p.VCS, p.Remote)
+		default:
+			out.Printf("%-24s %-20s (%s)\n", p.Name, p.Version, setBy)
+		}
+	}
+}
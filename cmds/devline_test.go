@@ -0,0 +1,121 @@
+// Copyright © 2015 Erik Brady <brady@dvln.org>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmds
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testGit runs git in the given dir for a test, returning it's output
+func testGit(t *testing.T, dir string, args ...string) string {
+	cmd := exec.Command("git", append([]string{"-c", "user.name=t", "-c", "user.email=t@t"}, args...)...)
+	cmd.Dir = dir
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s failed: %s: %s", strings.Join(args, " "), err, output)
+	}
+	return strings.TrimSpace(string(output))
+}
+
+func TestResolvePkgRevision(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	root, err := ioutil.TempDir("", "dvlnrev")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	// a remote with two commits on main (the first only reachable by sha)
+	// and a workspace with the package cloned from it
+	remote := filepath.Join(root, "remote")
+	testGit(t, root, "init", "-q", "-b", "main", remote)
+	testGit(t, remote, "commit", "-q", "--allow-empty", "-m", "one")
+	first := testGit(t, remote, "rev-parse", "HEAD")
+	testGit(t, remote, "commit", "-q", "--allow-empty", "-m", "two")
+	tip := testGit(t, remote, "rev-parse", "HEAD")
+	wkspcRootDir := filepath.Join(root, "ws")
+	testGit(t, root, "clone", "-q", remote, filepath.Join(wkspcRootDir, "net"))
+
+	ctx := context.Background()
+	tests := []struct {
+		version string
+		wkspc   string
+		rev     string // "" if it should fail
+	}{
+		{"main", "", tip},
+		{tip, "", tip},
+		{first, "", ""},
+		{first, wkspcRootDir, first},
+		{"nosuchbranch", wkspcRootDir, ""},
+		{"0123456789abcdef0123456789abcdef01234567", wkspcRootDir, ""},
+	}
+	for _, test := range tests {
+		p := &resolvedPkg{Name: "net", Path: "net", VCS: "git", Remote: remote, Version: test.version}
+		r := resolvePkgRevision(ctx, p, test.wkspc)
+		switch {
+		case test.rev == "" && r.Err == nil:
+			t.Errorf("version %q (workspace %q) resolved to %s, want a failure", test.version, test.wkspc, r.Revision)
+		case test.rev != "" && r.Err != nil:
+			t.Errorf("version %q (workspace %q) failed: %s", test.version, test.wkspc, r.Err)
+		case r.Revision != test.rev && r.Err == nil:
+			t.Errorf("version %q (workspace %q) resolved to %s, want %s", test.version, test.wkspc, r.Revision, test.rev)
+		}
+	}
+}
+
+func TestPkgDiffItems(t *testing.T) {
+	from := []*resolvedPkg{
+		{Name: "net", Path: "net", VCS: "git", Remote: "r/net", Version: "v1.0"},
+		{Name: "old", Path: "old", VCS: "git", Remote: "r/old", Version: "main"},
+		{Name: "util", Path: "util", VCS: "git", Remote: "r/util", Version: "main"},
+		{Name: "docs", Path: "docs", VCS: "git", Remote: "r/docs", Version: "main"},
+	}
+	to := []*resolvedPkg{
+		{Name: "app", Path: "app", VCS: "git", Remote: "r/app", Version: "dev"},
+		{Name: "net", Path: "net", VCS: "git", Remote: "r/net", Version: "v1.1"},
+		{Name: "util", Path: "util", VCS: "git", Remote: "r/util2", Version: "main"},
+		{Name: "docs", Path: "docs", VCS: "git", Remote: "r/docs", Version: "main"},
+	}
+	d := diffPkgs(from, to)
+	tests := []struct {
+		verbosity string
+		want      string
+	}{
+		{"terse", "app:added::dev old:removed:main: net:changed:v1.0:v1.1 util:changed:main:main"},
+		{"regular", "app:added::dev old:removed:main: net:changed:v1.0:v1.1 util:changed:main:main"},
+		{"verbose", "app:added::dev old:removed:main: net:changed:v1.0:v1.1 util:changed:main:main docs:same:main:main"},
+	}
+	for _, test := range tests {
+		var got []string
+		for _, item := range pkgDiffItems(d, test.verbosity) {
+			got = append(got, strings.Join([]string{item.Name, item.Change, item.FromVersion, item.ToVersion}, ":"))
+		}
+		if strings.Join(got, " ") != test.want {
+			t.Errorf("%s diff items:\n  %s\nwant:\n  %s", test.verbosity, strings.Join(got, " "), test.want)
+		}
+	}
+	if items := pkgDiffItems(d, "regular"); items[3].FromRemote != "r/util" || items[3].ToRemote != "r/util2" {
+		t.Errorf("Changed remote not in the diff item: %+v", items[3])
+	}
+	if d = diffPkgs(from, from); len(d.Added)+len(d.Removed)+len(d.Changed) != 0 || len(d.Same) != len(from) {
+		t.Errorf("A package set diffed against itself has changes: %+v", d)
+	}
+}
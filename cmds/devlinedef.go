@@ -0,0 +1,443 @@
+// Copyright © 2015 Erik Brady <brady@dvln.org>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package cmds devlinedef.go module deals with locating and loading devline
+// definitions and resolving them against a codebase into the list of
+// packages (and versions of those packages) that belong in a workspace.
+package cmds
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/dvln/out"
+	"github.com/dvln/util/path"
+	globs "github.com/dvln/viper"
+)
+
+// devlineFormat is the latest devline definition file format version this
+// dvln understands, files with no version are assumed to be version 1
+const devlineFormat = 1
+
+// devlineMaxDepth limits how deep devline inheritance can go
+const devlineMaxDepth = 32
+
+// devlineDef is the in-memory form of a devline definition file, it lists
+// the packages in the devline and the version (branch, tag or revision)
+// of each of those packages.  A devline can inherit from a parent devline,
+// in which case it overrides or adds packages to (and removes packages
+// from) the parent devlines packages.  Package versions can also be set
+// by rules (see devlinerules.go) making the devline dynamic and settings
+// can be given for those working on the devline (see defsettings.go).
+// As with codebases the file can be TOML, YAML or JSON (see deffile.go),
+// eg in TOML:
+//
+//	version = 1
+//	name = "myfeature"
+//	parent = "main"
+//	remove = ["docs"]
+//	[[packages]]
+//	name = "netlib"
+//	branch = "myfeature"
+//	[[packages]]
+//	name = "utils"
+//	tag = "v1.2.0"
+type devlineDef struct {
+	Version     int            `json:"version,omitempty" toml:"version" yaml:"version,omitempty"`
+	Name        string         `json:"name" toml:"name" yaml:"name"`
+	Description string         `json:"description,omitempty" toml:"description" yaml:"description,omitempty"`
+	Codebase    string         `json:"codebase,omitempty" toml:"codebase" yaml:"codebase,omitempty"`
+	Parent      string         `json:"parent,omitempty" toml:"parent" yaml:"parent,omitempty"` // devline inherited from, relative to this one
+	Remove      []string       `json:"remove,omitempty" toml:"remove" yaml:"remove,omitempty"` // parent pkgs not wanted
+	Packages    []*devlinePkg  `json:"packages" toml:"packages" yaml:"packages"`
+	Rules       []*devlineRule `json:"rules,omitempty" toml:"rules" yaml:"rules,omitempty"` // dynamic versions
+	Settings    settings       `json:"settings,omitempty" toml:"settings" yaml:"settings,omitempty"`
+	file        string         // where the definition was loaded from
+}
+
+// devlinePkg identifies a codebase package and it's version in a devline,
+// the version can be given generically or pinned to a tag, a branch or a
+// revision (only one of these can be used for a package)
+type devlinePkg struct {
+	Name     string `json:"name" toml:"name" yaml:"name"`
+	Version  string `json:"version,omitempty" toml:"version" yaml:"version,omitempty"` // default: pkg default branch
+	Tag      string `json:"tag,omitempty" toml:"tag" yaml:"tag,omitempty"`
+	Branch   string `json:"branch,omitempty" toml:"branch" yaml:"branch,omitempty"`
+	Revision string `json:"revision,omitempty" toml:"revision" yaml:"revision,omitempty"`
+}
+
+// version returns the version (tag, branch or revision) wanted for the pkg
+func (dp *devlinePkg) version() string {
+	for _, v := range []string{dp.Version, dp.Tag, dp.Branch, dp.Revision} {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// resolvedPkg is a package that has been resolved from a codebase and
+// devline, ie: we know where it goes, where it comes from and what version
+type resolvedPkg struct {
+	Name    string `json:"name"`
+	Path    string `json:"path"`
+	VCS     string `json:"vcs"`
+	Remote  string `json:"remote"`
+	Version string `json:"version,omitempty"`
+}
+
+// newResolvedPkg combines a codebase package definition with the version
+// a devline wants for it, if no version given the default branch is used
+func newResolvedPkg(p *pkgDef, version string) *resolvedPkg {
+	if version == "" {
+		version = p.Branch
+	}
+	return &resolvedPkg{
+		Name:    p.Name,
+		Path:    p.Path,
+		VCS:     p.VCS,
+		Remote:  p.Remote,
+		Version: version,
+	}
+}
+
+// loadDevline locates and reads in the given devline (name, path or URL),
+// named devlines are found in the cfgfile:devlinedir directory.  Only the
+// devline itself is loaded, see loadDevlineChain() for it's parents.
+func loadDevline(devline string) (*devlineDef, error) {
+	return loadDevlineFile(devline, findDefFile(devline, globs.GetString("devlinedir")))
+}
+
+// parentDevlineFile returns where the parent of a devline loaded from the
+// given file (or URL) is, a parent given as a name or relative path is
+// relative to where the devline was loaded from (a named parent without an
+// extension is looked for in any format locally, for URLs it's assumed to
+// be in the same format as the child devline)
+func parentDevlineFile(parent string, childFile string) string {
+	if isURL(parent) || strings.HasPrefix(parent, "file://") || filepath.IsAbs(parent) {
+		return parent
+	}
+	if isURL(childFile) {
+		base, err := url.Parse(childFile)
+		if err != nil {
+			return parent
+		}
+		ref, err := url.Parse(filepath.ToSlash(parent))
+		if err != nil {
+			return parent
+		}
+		parentURL := base.ResolveReference(ref)
+		if filepath.Ext(ref.Path) == "" {
+			parentURL.Path += filepath.Ext(base.Path)
+		}
+		return parentURL.String()
+	}
+	file := filepath.Join(filepath.Dir(strings.TrimPrefix(childFile, "file://")), parent)
+	if _, err := os.Stat(file); err == nil {
+		return file
+	}
+	return defFileWithExt(file)
+}
+
+// loadDevlineFile reads in the given devline from the given file (or URL)
+func loadDevlineFile(devline string, file string) (*devlineDef, error) {
+	out.Debugln("Reading devline definition:", file)
+	data, err := readDefFile(file)
+	if err != nil {
+		return nil, out.WrapErr(err, fmt.Sprintf("Unable to read devline \"%s\"", devline), 2010)
+	}
+	dl := &devlineDef{file: file}
+	if err = decodeDef(file, data, dl); err != nil {
+		return nil, out.WrapErr(err, fmt.Sprintf("Unable to parse devline definition: %s", file), 2010)
+	}
+	if dl.Name == "" {
+		dl.Name = devline
+	}
+	if err = validateDevline(dl, data); err != nil {
+		return nil, err
+	}
+	return dl, nil
+}
+
+// validateDevline checks a freshly parsed devline definition, all problems
+// found are reported in one error along with the line # each is on
+func validateDevline(dl *devlineDef, data []byte) error {
+	if dl.Version == 0 {
+		dl.Version = 1
+	}
+	if dl.Version > devlineFormat {
+		return out.NewErr(fmt.Sprintf("Devline %s is format version %d, this dvln only understands up to version %d (upgrade dvln): %s", dl.Name, dl.Version, devlineFormat, dl.file), 2028)
+	}
+	de := newDefErrs(dl.file, data)
+	names := make(map[string]bool, len(dl.Packages))
+	for i, dp := range dl.Packages {
+		line := de.lines.line("packages", i, "name")
+		if dp.Name == "" {
+			de.add(line, "package #%d has no name", i+1)
+			continue
+		}
+		if names[dp.Name] {
+			de.add(line, "package %s is listed more than once", dp.Name)
+		}
+		names[dp.Name] = true
+		set := 0
+		for _, v := range []string{dp.Version, dp.Tag, dp.Branch, dp.Revision} {
+			if v != "" {
+				set++
+			}
+		}
+		if set > 1 {
+			de.add(line, "package %s can only have one of version, tag, branch or revision", dp.Name)
+		}
+		if err := checkVCSArg(dp.version()); err != nil {
+			de.add(line, "package %s: %s", dp.Name, err)
+		}
+	}
+	for i, name := range dl.Remove {
+		if names[name] {
+			de.add(de.lines.line("remove", i), "package %s is both removed and listed as a package", name)
+		}
+	}
+	validateDevlineRules(dl, de)
+	validateSettings(dl.Settings, de)
+	return de.err(fmt.Sprintf("Devline %s definition is invalid", dl.Name), 2029)
+}
+
+// loadDevlineChain loads the given devline and all the devlines it inherits
+// from, the returned chain starts with the top parent (ie: the devline that
+// inherits from nothing) and ends with the given devline.  Parents are found
+// relative to the devline inheriting from them, see parentDevlineFile().
+func loadDevlineChain(devline string) ([]*devlineDef, error) {
+	var chain []*devlineDef
+	seen := make(map[string]bool)
+	dl, err := loadDevline(devline)
+	for err == nil {
+		where := dl.file
+		if !isURL(where) {
+			if abs, absErr := filepath.Abs(strings.TrimPrefix(where, "file://")); absErr == nil {
+				where = abs
+			}
+		}
+		if seen[where] {
+			return nil, out.NewErr(fmt.Sprintf("Devline %s inheritance loops back to devline %s (%s)", devline, dl.Name, dl.file), 2029)
+		}
+		seen[where] = true
+		if len(chain) == devlineMaxDepth {
+			return nil, out.NewErr(fmt.Sprintf("Devline %s inherits from more than %d devlines", devline, devlineMaxDepth), 2029)
+		}
+		chain = append([]*devlineDef{dl}, chain...)
+		if dl.Parent == "" {
+			return chain, nil
+		}
+		dl, err = loadDevlineFile(dl.Parent, parentDevlineFile(dl.Parent, dl.file))
+	}
+	return nil, err
+}
+
+// devlineCodebase returns the codebase the given devline says it is for, if
+// it doesn't say then the closest parent devline that does is used
+func devlineCodebase(devline string) (string, error) {
+	chain, err := loadDevlineChain(devline)
+	if err != nil {
+		return "", err
+	}
+	for i := len(chain) - 1; i >= 0; i-- {
+		if chain[i].Codebase != "" {
+			return chain[i].Codebase, nil
+		}
+	}
+	return "", nil
+}
+
+// devlineFile returns the file a devline (name or path) is written to, named
+// devlines go in the cfgfile:devlinedir directory
+func devlineFile(devline string) string {
+	if strings.ContainsRune(devline, filepath.Separator) || stringInSlice(filepath.Ext(devline), defExts) {
+		return devline
+	}
+	return filepath.Join(path.AbsPathify(globs.GetString("devlinedir")), devline+defExts[0])
+}
+
+// writeDevline writes the given devline definition to the given file in the
+// format (TOML, YAML or JSON) matching the files extension
+func writeDevline(file string, dl *devlineDef) error {
+	if dl.Version == 0 {
+		dl.Version = devlineFormat
+	}
+	data, err := encodeDef(file, dl)
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(file), 0755)
+	}
+	if err == nil {
+		err = ioutil.WriteFile(file, data, 0644)
+	}
+	if err != nil {
+		return out.WrapErr(err, fmt.Sprintf("Unable to write devline %s to %s", dl.Name, file), 2023)
+	}
+	return nil
+}
+
+// resolveDevline returns the packages (and versions) the given devline wants
+// from the given codebase.  If no devline is given then every package in
+// the codebase is used at it's default branch.
+func resolveDevline(cb *codebaseDef, devline string) ([]*resolvedPkg, error) {
+	pkgs, _, err := resolveDevlineChain(cb, devline)
+	return pkgs, err
+}
+
+// resolveDevlineChain resolves the given devline, and the devlines it
+// inherits from, into the packages (and versions) wanted from the codebase.
+// Also returned is what set each package version (eg: "devline proj_x"),
+// keyed on package name (not present if it's the default branch).  If the
+// top devline lists no packages, but has rules, it starts with all of the
+// codebase packages (so the rules can pick versions for them).  The codebase
+// and devline settings are merged in first (see defsettings.go).
+func resolveDevlineChain(cb *codebaseDef, devline string) ([]*resolvedPkg, map[string]string, error) {
+	var chain []*devlineDef
+	var err error
+	if devline != "" {
+		chain, err = loadDevlineChain(devline)
+	}
+	if err == nil {
+		err = mergeSettings(cb, chain)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return resolveChain(cb, chain)
+}
+
+// resolveChain is resolveDevlineChain() for an already loaded devline
+// chain (see loadDevlineChain()), an empty chain means no devline
+func resolveChain(cb *codebaseDef, chain []*devlineDef) ([]*resolvedPkg, map[string]string, error) {
+	pkgs := make([]*resolvedPkg, 0, len(cb.Packages))
+	origins := make(map[string]string, len(cb.Packages))
+	if len(chain) == 0 {
+		out.Debugf("No devline given, using all codebase %s packages\n", cb.Name)
+		for _, p := range cb.Packages {
+			pkgs = append(pkgs, newResolvedPkg(p, ""))
+		}
+		return pkgs, origins, nil
+	}
+	for i, dl := range chain {
+		if i == 0 && len(dl.Packages) == 0 && len(dl.Rules) != 0 {
+			for _, p := range cb.Packages {
+				pkgs = append(pkgs, newResolvedPkg(p, ""))
+			}
+		}
+		if dl.Codebase != "" && dl.Codebase != cb.Name {
+			out.Debugf("Devline %s is for codebase %s, using it with codebase %s\n", dl.Name, dl.Codebase, cb.Name)
+		}
+		for _, name := range dl.Remove {
+			kept := pkgs[:0]
+			for _, p := range pkgs {
+				if p.Name != name {
+					kept = append(kept, p)
+				}
+			}
+			if len(kept) == len(pkgs) {
+				out.Debugf("Devline %s removes package %s, it's not in the parent devline\n", dl.Name, name)
+			}
+			pkgs = kept
+			delete(origins, name)
+		}
+		if err := applyDevlineRules(cb, dl, pkgs, origins); err != nil {
+			return nil, nil, err
+		}
+		for _, dp := range dl.Packages {
+			p := cb.pkg(dp.Name)
+			if p == nil {
+				return nil, nil, out.NewErr(fmt.Sprintf("Devline %s package %s is not in codebase %s", dl.Name, dp.Name, cb.Name), 2011)
+			}
+			rp := newResolvedPkg(p, dp.version())
+			replaced := false
+			for i := range pkgs {
+				if pkgs[i].Name == rp.Name {
+					pkgs[i] = rp
+					replaced = true
+				}
+			}
+			if !replaced {
+				pkgs = append(pkgs, rp)
+			}
+			if dp.version() != "" {
+				origins[rp.Name] = "devline " + dl.Name
+			} else {
+				delete(origins, rp.Name)
+			}
+		}
+	}
+	return pkgs, origins, nil
+}
+
+// showPkgOrigins shows (in verbose mode) which devline in the inheritance
+// chain (or which devline rule) set the version of each package
+func showPkgOrigins(pkgs []*resolvedPkg, origins map[string]string) {
+	if lookIsStructured() || !globs.GetBool("verbose") {
+		return
+	}
+	for _, p := range pkgs {
+		if origin, ok := origins[p.Name]; ok {
+			out.Verbosef("Package %s: version \"%s\" set by %s\n", p.Name, p.Version, origin)
+		} else {
+			out.Verbosef("Package %s: version \"%s\" (codebase default branch)\n", p.Name, p.Version)
+		}
+	}
+}
+
+// pkgChange is a package whose definition differs between two package sets
+type pkgChange struct {
+	From *resolvedPkg
+	To   *resolvedPkg
+}
+
+// pkgDiff is the difference between two sets of resolved packages
+type pkgDiff struct {
+	Added   []*resolvedPkg // in the new set only
+	Removed []*resolvedPkg // in the old set only
+	Changed []*pkgChange   // in both but version, remote, etc differ
+	Same    []*resolvedPkg // in both and identical
+}
+
+// diffPkgs compares the "from" package set to the "to" package set, results
+// are in "to" order except for removed packages (which are in "from" order)
+func diffPkgs(from, to []*resolvedPkg) *pkgDiff {
+	d := &pkgDiff{}
+	fromPkgs := make(map[string]*resolvedPkg, len(from))
+	for _, p := range from {
+		fromPkgs[p.Name] = p
+	}
+	toPkgs := make(map[string]bool, len(to))
+	for _, p := range to {
+		toPkgs[p.Name] = true
+		old, ok := fromPkgs[p.Name]
+		switch {
+		case !ok:
+			d.Added = append(d.Added, p)
+		case *old != *p:
+			d.Changed = append(d.Changed, &pkgChange{From: old, To: p})
+		default:
+			d.Same = append(d.Same, p)
+		}
+	}
+	for _, p := range from {
+		if !toPkgs[p.Name] {
+			d.Removed = append(d.Removed, p)
+		}
+	}
+	return d
+}
@@ -0,0 +1,166 @@
+// Copyright © 2015 Erik Brady <brady@dvln.org>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmds
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	globs "github.com/dvln/viper"
+)
+
+// testDevlines are devline definitions (by file name) for the tests, main
+// is the top devline, feature inherits from it and sub/fix from feature
+var testDevlines = map[string]string{
+	"main.json":    `{"name": "main", "packages": [{"name": "net", "branch": "main"}, {"name": "util"}, {"name": "docs"}]}`,
+	"feature.json": `{"name": "feature", "parent": "main", "remove": ["docs"], "packages": [{"name": "net", "branch": "feature"}, {"name": "app", "tag": "v1.0"}]}`,
+	"sub/fix.json": `{"name": "fix", "parent": "../feature", "packages": [{"name": "util", "revision": "abc123"}, {"name": "net"}]}`,
+	"loop1.json":   `{"name": "loop1", "parent": "loop2", "packages": []}`,
+	"loop2.json":   `{"name": "loop2", "parent": "loop1.json", "packages": []}`,
+	"orphan.json":  `{"name": "orphan", "parent": "nosuch", "packages": []}`,
+}
+
+// writeTestDevlines writes the test devlines to a new temp dir
+func writeTestDevlines(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "dvlndl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for file, def := range testDevlines {
+		file = filepath.Join(dir, filepath.FromSlash(file))
+		if err = os.MkdirAll(filepath.Dir(file), 0755); err == nil {
+			err = ioutil.WriteFile(file, []byte(def), 0644)
+		}
+		if err != nil {
+			os.RemoveAll(dir)
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// testDevlineCodebase is the codebase the test devlines are for
+func testDevlineCodebase() *codebaseDef {
+	cb := &codebaseDef{Name: "cb", Packages: []*pkgDef{
+		{Name: "net", Remote: "n", Branch: "master"},
+		{Name: "util", Remote: "u", Branch: "master"},
+		{Name: "docs", Remote: "d"},
+		{Name: "app", Remote: "a", Branch: "dev"},
+	}}
+	validateCodebase(cb, []byte("{}"))
+	return cb
+}
+
+// pkgVersions describes resolved packages, eg: "net@main,util@master"
+func pkgVersions(pkgs []*resolvedPkg) string {
+	var versions []string
+	for _, p := range pkgs {
+		versions = append(versions, p.Name+"@"+p.Version)
+	}
+	return strings.Join(versions, ",")
+}
+
+func TestDevlineChain(t *testing.T) {
+	dir := writeTestDevlines(t)
+	defer os.RemoveAll(dir)
+	snap := snapshotGlobs()
+	defer snap.restore()
+	// the devline dir isn't used for parents, they're next to the child
+	setGlob("devlinedir", filepath.Join(dir, "sub"), "test")
+	cb := testDevlineCodebase()
+	tests := []struct {
+		devline string
+		pkgs    string
+		origins map[string]string
+	}{
+		{"", "net@master,util@master,docs@,app@dev", map[string]string{}},
+		{filepath.Join(dir, "main.json"), "net@main,util@master,docs@",
+			map[string]string{"net": "devline main"}},
+		// removals, overrides and additions
+		{filepath.Join(dir, "feature"), "net@feature,util@master,app@v1.0",
+			map[string]string{"net": "devline feature", "app": "devline feature"}},
+		// a pin, and a package back to it's default branch
+		{"fix", "net@master,util@abc123,app@v1.0",
+			map[string]string{"util": "devline fix", "app": "devline feature"}},
+	}
+	for _, test := range tests {
+		var chain []*devlineDef
+		if test.devline != "" {
+			var err error
+			if chain, err = loadDevlineChain(test.devline); err != nil {
+				t.Errorf("devline %q: %s", test.devline, err)
+				continue
+			}
+		}
+		pkgs, origins, err := resolveChain(cb, chain)
+		if err != nil {
+			t.Errorf("devline %q: %s", test.devline, err)
+			continue
+		}
+		if got := pkgVersions(pkgs); got != test.pkgs {
+			t.Errorf("devline %q resolved to %s, want %s", test.devline, got, test.pkgs)
+		}
+		if len(origins) != len(test.origins) {
+			t.Errorf("devline %q origins %v, want %v", test.devline, origins, test.origins)
+		}
+		for name, origin := range test.origins {
+			if origins[name] != origin {
+				t.Errorf("devline %q package %s set by %q, want %q", test.devline, name, origins[name], origin)
+			}
+		}
+	}
+	// no devline at all, every codebase package at it's default branch
+	if pkgs, err := resolveDevline(cb, ""); err != nil || pkgVersions(pkgs) != "net@master,util@master,docs@,app@dev" {
+		t.Errorf("no devline resolved to %s (err: %v)", pkgVersions(pkgs), err)
+	}
+	for _, devline := range []string{"loop1", "orphan"} {
+		if _, err := loadDevlineChain(filepath.Join(dir, devline)); err == nil {
+			t.Errorf("devline %s chain accepted", devline)
+		} else if devline == "loop1" && !strings.Contains(err.Error(), "loops back") {
+			t.Errorf("devline loop not detected: %s", err)
+		}
+	}
+}
+
+func TestDevlineChainURL(t *testing.T) {
+	dir := writeTestDevlines(t)
+	defer os.RemoveAll(dir)
+	snap := snapshotGlobs()
+	defer snap.restore()
+	setGlob("devlinedir", filepath.Join(dir, "sub"), "test")
+	srv := httptest.NewServer(http.StripPrefix("/dl/", http.FileServer(http.Dir(dir))))
+	defer srv.Close()
+	chain, err := loadDevlineChain(srv.URL + "/dl/sub/fix.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, dl := range chain {
+		names = append(names, dl.Name)
+	}
+	if strings.Join(names, ",") != "main,feature,fix" || chain[0].file != srv.URL+"/dl/main.json" {
+		t.Errorf("devline chain via URL is %v (top from %s)", names, chain[0].file)
+	}
+	if _, err = loadDevlineChain(srv.URL + "/dl/loop1.json"); err == nil {
+		t.Error("devline loop via URL accepted")
+	}
+	if got := globs.GetString("devlinedir"); got != filepath.Join(dir, "sub") {
+		t.Errorf("devlinedir changed to %s", got)
+	}
+}
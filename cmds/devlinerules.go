@@ -0,0 +1,220 @@
+// Copyright © 2015 Erik Brady <brady@dvln.org>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package cmds devlinerules.go module deals with dynamic (generated) devlines,
+// ie: devlines that pick package versions via rules which are resolved when
+// the devline is used (get, update, etc).  For example, in TOML:
+//
+//	[[rules]]
+//	select = "core"        # pkg selector (see selector.go), default: all pkgs
+//	tag = "v2.*"           # the latest tag matching the glob
+//	[[rules]]
+//	branch = "main"        # the tip of the branch
+//
+// The first rule selecting a package sets it's version, packages listed in
+// the devline itself aren't touched by the devline's rules.  A dynamic
+// devline can be frozen into static revisions with 'dvln devline resolve'.
+package cmds
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"sync"
+	"unicode"
+
+	"github.com/dvln/out"
+	"github.com/dvln/wkspc"
+)
+
+// devlineRule picks the version for the packages it selects
+type devlineRule struct {
+	Select string `json:"select,omitempty" toml:"select" yaml:"select,omitempty"` // default: all pkgs
+	Tag    string `json:"tag,omitempty" toml:"tag" yaml:"tag,omitempty"`          // latest tag matching glob
+	Branch string `json:"branch,omitempty" toml:"branch" yaml:"branch,omitempty"` // tip of the branch
+}
+
+// String describes the rule, eg: "latest tag v2.* for core"
+func (r *devlineRule) String() string {
+	desc := "branch " + r.Branch
+	if r.Tag != "" {
+		desc = "latest tag " + r.Tag
+	}
+	if r.Select != "" {
+		desc += " for " + r.Select
+	}
+	return desc
+}
+
+// validateDevlineRules checks the rules of a freshly parsed devline, any
+// problems are added to the given problem list
+func validateDevlineRules(dl *devlineDef, de *defErrs) {
+	for i, r := range dl.Rules {
+		line := de.lines.line("rules", i, "tag")
+		if r.Tag == "" {
+			line = de.lines.line("rules", i, "branch")
+		}
+		if (r.Tag == "") == (r.Branch == "") {
+			de.add(line, "rule #%d needs one of tag or branch", i+1)
+			continue
+		}
+		if _, err := path.Match(r.Tag, ""); err != nil {
+			de.add(line, "rule #%d tag \"%s\" is not a valid glob: %s", i+1, r.Tag, err)
+		}
+		if err := checkVCSArg(r.Branch); err != nil {
+			de.add(line, "rule #%d: %s", i+1, err)
+		}
+	}
+}
+
+// applyDevlineRules sets the versions of the given packages based on the
+// devline's rules, except for packages the devline lists explicitly.  The
+// origins map is updated with the rule that set each package version.
+func applyDevlineRules(cb *codebaseDef, dl *devlineDef, pkgs []*resolvedPkg, origins map[string]string) error {
+	if len(dl.Rules) == 0 {
+		return nil
+	}
+	wkspcRootDir, _ := wkspc.RootDir()
+	done := make(map[string]bool, len(pkgs))
+	for _, dp := range dl.Packages {
+		done[dp.Name] = true
+	}
+	for i, r := range dl.Rules {
+		selected, err := selectPkgs(pkgs, r.Select, cb, wkspcRootDir)
+		if err != nil {
+			return out.WrapErr(err, fmt.Sprintf("Devline %s rule #%d (%s) selector failed", dl.Name, i+1, r), 2030)
+		}
+		var todo []*resolvedPkg
+		for _, p := range selected {
+			if !done[p.Name] {
+				done[p.Name] = true
+				todo = append(todo, p)
+			}
+		}
+		versions, err := ruleVersions(dl, i, r, todo, wkspcRootDir)
+		if err != nil {
+			return err
+		}
+		for _, p := range todo {
+			for j := range pkgs {
+				if pkgs[j].Name == p.Name {
+					pkgs[j] = newResolvedPkg(cb.pkg(p.Name), versions[p.Name])
+				}
+			}
+			origins[p.Name] = fmt.Sprintf("devline %s rule #%d (%s)", dl.Name, i+1, r)
+		}
+	}
+	return nil
+}
+
+// ruleVersions returns the version the given rule (#idx of the devline)
+// picks for each of the given packages, keyed on package name.  For tag
+// rules the tags of the packages are looked up in parallel (see jobs.go).
+func ruleVersions(dl *devlineDef, idx int, r *devlineRule, pkgs []*resolvedPkg, wkspcRootDir string) (map[string]string, error) {
+	versions := make(map[string]string, len(pkgs))
+	if r.Tag == "" {
+		for _, p := range pkgs {
+			versions[p.Name] = r.Branch
+		}
+		return versions, nil
+	}
+	var mu sync.Mutex
+	results, _ := runQuietPkgJobs(pkgs, func(ctx context.Context, p *resolvedPkg) *pkgResult {
+		res := &pkgResult{Name: p.Name, Action: "tagged"}
+		tag, err := latestPkgTag(ctx, p, r.Tag, wkspcRootDir)
+		if err != nil {
+			return res.failed(2030, err)
+		}
+		mu.Lock()
+		versions[p.Name] = tag
+		mu.Unlock()
+		return res
+	})
+	for _, res := range results {
+		if res.Err != nil {
+			return nil, out.WrapErr(res.Err, fmt.Sprintf("Devline %s rule #%d (%s) failed for package %s", dl.Name, idx+1, r, res.Name), 2030)
+		}
+	}
+	return versions, nil
+}
+
+// latestPkgTag returns the latest (highest version) tag of the package that
+// matches the given glob, the tags come from the packages remote or, if the
+// VCS can't list remote tags, from the package in the workspace (if there)
+func latestPkgTag(ctx context.Context, p *resolvedPkg, glob string, wkspcRootDir string) (string, error) {
+	var tags []string
+	remoteTags, _, err := vcsRemoteRefs(ctx, p)
+	if err == nil {
+		for tag := range remoteTags {
+			tags = append(tags, tag)
+		}
+	} else {
+		if wkspcRootDir == "" {
+			return "", err
+		}
+		pkgDir, dirErr := wkspcPkgDir(wkspcRootDir, p.Path)
+		if dirErr != nil {
+			return "", dirErr
+		}
+		if _, statErr := os.Stat(pkgDir); statErr != nil {
+			return "", err
+		}
+		out.Debugf("Package %s: using workspace tags, %s\n", p.Name, err)
+		if tags, err = vcsTags(ctx, p, pkgDir); err != nil {
+			return "", err
+		}
+	}
+	latest := ""
+	for _, tag := range tags {
+		if ok, _ := path.Match(glob, tag); ok && (latest == "" || versionLess(latest, tag)) {
+			latest = tag
+		}
+	}
+	if latest == "" {
+		return "", out.NewErr(fmt.Sprintf("Package %s: no tag matches \"%s\"", p.Name, glob), 2030)
+	}
+	return latest, nil
+}
+
+// versionLess compares version strings (eg: tags like v2.10.1) piece by
+// piece, where runs of digits are compared numerically, so v2.9 < v2.10
+func versionLess(a, b string) bool {
+	ap, bp := versionParts(a), versionParts(b)
+	for i := 0; i < len(ap) && i < len(bp); i++ {
+		if ap[i] == bp[i] {
+			continue
+		}
+		an, aErr := strconv.Atoi(ap[i])
+		bn, bErr := strconv.Atoi(bp[i])
+		if aErr == nil && bErr == nil {
+			return an < bn
+		}
+		return ap[i] < bp[i]
+	}
+	return len(ap) < len(bp)
+}
+
+// versionParts splits a version string into runs of digits and non-digits
+func versionParts(version string) []string {
+	var parts []string
+	start := 0
+	for i, c := range version {
+		if i > start && unicode.IsDigit(c) != unicode.IsDigit(rune(version[i-1])) {
+			parts = append(parts, version[start:i])
+			start = i
+		}
+	}
+	return append(parts, version[start:])
+}
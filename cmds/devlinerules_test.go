@@ -0,0 +1,59 @@
+// Copyright © 2015 Erik Brady <brady@dvln.org>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmds
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestVersionParts(t *testing.T) {
+	tests := map[string][]string{
+		"":           {""},
+		"v2.10.1":    {"v", "2", ".", "10", ".", "1"},
+		"1.0-rc12":   {"1", ".", "0", "-rc", "12"},
+		"release":    {"release"},
+		"2015":       {"2015"},
+		"v1.2.3beta": {"v", "1", ".", "2", ".", "3", "beta"},
+	}
+	for version, want := range tests {
+		if got := versionParts(version); !reflect.DeepEqual(got, want) {
+			t.Errorf("versionParts(%q) = %q, want %q", version, got, want)
+		}
+	}
+}
+
+func TestVersionLess(t *testing.T) {
+	tests := []struct {
+		a, b string
+		less bool
+	}{
+		{"v2.9", "v2.10", true},
+		{"v2.10", "v2.9", false},
+		{"v2.10", "v2.10", false},
+		{"v1.0", "v1.0.1", true},
+		{"v1.0.1", "v1.0", false},
+		{"v1.0-rc2", "v1.0-rc10", true},
+		{"v1.9.9", "v10.0.0", true},
+		{"v1.0", "v1.0a", true},
+		{"v1.0a", "v1.0b", true},
+		{"a", "b", true},
+		{"", "v1", true},
+	}
+	for _, test := range tests {
+		if got := versionLess(test.a, test.b); got != test.less {
+			t.Errorf("versionLess(%q, %q) = %v, want %v", test.a, test.b, got, test.less)
+		}
+	}
+}
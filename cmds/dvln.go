@@ -109,15 +109,19 @@ func addSubCommands(c *cli.Command) {
 	//c.AddCommand(branchCmd) //    % dvln branch ..
 	//c.AddCommand(catCmd) //       % dvln cat ..
 	//c.AddCommand(checkCmd) //     % dvln check ..
+	c.AddCommand(codesCmd) //      % dvln codes ..
 	//c.AddCommand(commitCmd) //    % dvln commit ..
-	//c.AddCommand(configCmd) //    % dvln config ..
+	c.AddCommand(configCmd) //     % dvln config ..
 	//c.AddCommand(copyrightCmd) // % dvln copyright ..
 	//c.AddCommand(createCmd) //    % dvln create ..
 	//c.AddCommand(dependCmd) //    % dvln depend ..
 	//c.AddCommand(describeCmd) //  % dvln describe ..
+	c.AddCommand(devlineCmd) //     % dvln devline ..
 	//c.AddCommand(diffCmd) //      % dvln diff ..
-	//c.AddCommand(freezeCmd) //    % dvln freeze ..
-	c.AddCommand(getCmd) //         % dvln get ..
+	c.AddCommand(foreachCmd) //     % dvln foreach ..
+	c.AddCommand(freezeCmd)  //     % dvln freeze ..
+	c.AddCommand(getCmd)     //     % dvln get ..
+	c.AddCommand(initCmd)    //     % dvln init ..
 	//c.AddCommand(issueCmd) //     % dvln issue ..
 	//c.AddCommand(logCmd) //       % dvln log ..  (or maybe dvln list?)
 	//c.AddCommand(manCmd) //       % dvln man ..
@@ -132,7 +136,7 @@ func addSubCommands(c *cli.Command) {
 	//c.AddCommand(revertCmd) //    % dvln revert ..
 	//c.AddCommand(rmCmd) //        % dvln rm ..
 	//c.AddCommand(snapshotCmd) //  % dvln snapshot ..
-	//c.AddCommand(statusCmd) //    % dvln status ..
+	c.AddCommand(statusCmd) //      % dvln status ..
 	//c.AddCommand(tagCmd) //       % dvln tag ..
 	//c.AddCommand(thawCmd) //      % dvln thaw ..
 	//c.AddCommand(trackCmd) //     % dvln track ..
@@ -204,6 +208,10 @@ func setupDvlnCmdCLIArgs(c *cli.Command, reloadCLIFlags bool) {
 	c.Flags().IntP("port", "P", globs.GetInt("Port"), desc)
 	desc, _, _ = globs.Desc("serve")
 	c.Flags().BoolP("serve", "S", globs.GetBool("serve"), desc)
+	desc, _, _ = globs.Desc("servehost")
+	c.Flags().String("servehost", globs.GetString("servehost"), desc)
+	desc, _, _ = globs.Desc("serveroot")
+	c.Flags().String("serveroot", globs.GetString("serveroot"), desc)
 	desc, _, _ = globs.Desc("version")
 	c.Flags().BoolP("version", "V", globs.GetBool("version"), desc)
 
@@ -225,7 +233,7 @@ func showCLIPkgOutput(theOutput string, look string) {
 	//       think this is because help isn't being properly registered by Execute()
 	//help := globs.GetBool("help")
 	//if help && look == "json" {
-	if look == "json" {
+	if look != "text" && look != "table" {
 		type helpStruct struct {
 			HelpMsg   string `json:"helpMsg"`
 			RecordLog string `json:"recordLog,omitempty"`
@@ -246,7 +254,7 @@ func showCLIPkgOutput(theOutput string, look string) {
 			}
 		}
 		items = append(items, &usage)
-		output, fatalProblem := api.GetJSONOutput(globs.GetString("apiver"), "dvlnHelp", "usage", "regular", fields, items)
+		output, fatalProblem := renderItems("dvlnHelp", "usage", "regular", fields, items)
 		if fatalProblem {
 			out.Print(output)
 			out.Exit(-1)
@@ -257,6 +265,17 @@ func showCLIPkgOutput(theOutput string, look string) {
 	}
 }
 
+// lookVerbosity returns the verbosity level to report in --look=json output
+// based on the terse and verbose settings, ie: "terse", "regular" or "verbose"
+func lookVerbosity() string {
+	if globs.GetBool("terse") {
+		return "terse"
+	} else if globs.GetBool("verbose") {
+		return "verbose"
+	}
+	return "regular"
+}
+
 // Execute is called by main(), it basically finishes prepping the 'dvln'
 // configuration data (combined with init() setting up options and available
 // subcommands and such) and then kicks off the 'cli' (cobra) package to run
@@ -282,7 +301,7 @@ func Execute(sha1 string, args []string) int {
 
 	// See if in JSON output mode, if so set the 'out' pkg appropriately...
 	look := globs.GetString("look")
-	if look == "json" {
+	if lookIsJSON() {
 		// See the 'out' pkg and the "Formatter" interface there, this allows
 		// dying msgs (fatal/error+exit/issue+exit) or not-dying msgs (no exit)
 		// types of output msgs to be shown in JSON format.  Basically, in JSON
@@ -377,7 +396,7 @@ func scanUserConfigFile() error {
 
 	// Handle $HOME and ~ and such in the config file name
 	configCleanPath := path.AbsPathify(configPath)
-	globs.Set("configdir", "")
+	setGlob("configdir", "", "dvln")
 
 	// Typically config defaults to a path (dir) to look for config.<extension>
 	// files in but it can also be a full path to a file, try and detect which:
@@ -386,11 +405,11 @@ func scanUserConfigFile() error {
 	if fileInfo, err = os.Stat(configCleanPath); err == nil && fileInfo.IsDir() {
 		// if it's a dir then just add the path, default looks for cfg.json|..
 		globs.AddConfigPath(configPath)
-		globs.Set("configdir", configCleanPath)
+		setGlob("configdir", configCleanPath, "dvln")
 	} else {
 		// if it's not a visible dir assume it's a file, if no file no problem
 		if err == nil && !fileInfo.IsDir() {
-			globs.Set("configdir", filepath.Dir(configCleanPath))
+			setGlob("configdir", filepath.Dir(configCleanPath), "dvln")
 			globs.SetConfigFile(configCleanPath)
 		} else {
 			out.Debugln("No config file located, normal, continuing")
@@ -447,6 +466,7 @@ func pushCLIOptsToGlobs(c *cli.Command, topCmd bool, args []string) {
 	// the 'globs' (viper) pkg so it's pflags and overide config levels focus
 	// just on those CLI options actually used (kind of a custom hack)
 	globs.SetPFlags(c.Flags())
+	recordCLIGlobs(c.Flags())
 	c.Flags().SetErrorHandling(currErrHndl)
 
 	// If running '<cmd> <subcmd> ..' we'll also scan the <subcmd> args here
@@ -581,7 +601,10 @@ func adjustOutLevels() {
 				record = out.UseTempLogFile("dvln.")
 				tmpLogfileActive = true
 				tmpLogfileMsg = fmt.Sprintf("Temp output logfile: %s", record)
-				if globs.GetString("look") == "json" {
+				if lookIsNDJSON() {
+					emitEvent(&lookEvent{Event: "note", Msg: tmpLogfileMsg, Level: fmt.Sprintf("%s", out.LevelNote)})
+					tmpLogfileMsg = ""
+				} else if lookIsJSON() {
 					// If in JSON stash the tmp logfile
 					// name as early as possible in the JSON API so it will have
 					// a "note" field with the temp logfile info "ready"
@@ -595,7 +618,7 @@ func adjustOutLevels() {
 
 				// Here we try and override what the user gave us basically by
 				// replacing it with the actual tmp file name
-				globs.Set("record", record)
+				setGlob("record", record, "dvln")
 				// Since we're replacing the CLI opt temp|tmp with the true
 				// temp file name we need to "force" globs (viper) to use the
 				// new value and not the pflags value (if Set() is used *and*
@@ -619,7 +642,7 @@ func adjustOutLevels() {
 				record = "~" + cast.ToString(rest)
 			}
 			if origRecord != record {
-				globs.Set("Record", record)
+				setGlob("record", record, "dvln")
 			}
 		}
 		currThresh := out.Threshold(out.ForLogfile)
@@ -667,6 +690,11 @@ func scanUserCfgAndReinit() error {
 	if err := scanUserConfigFile(); err != nil {
 		return err
 	}
+	// If in a workspace its config file settings, if any, are layered above
+	// the users config file settings (see wkspccfg.go)
+	if err := scanWkspcConfigFile(); err != nil {
+		return err
+	}
 
 	// Final output levels adjustements to take into account any tweaks from
 	// the users config file settings.  Note, don't move this below the calls
@@ -699,7 +727,14 @@ func reloadCLIDefaults() {
 	// file settings and even CLI flags used:
 	reloadCLIFlags := true
 	setupDvlnCmdCLIArgs(dvlnCmd, reloadCLIFlags)
+	setupCodesCmdCLIArgs(codesCmd, reloadCLIFlags)
+	setupConfigCmdCLIArgs(configCmd, reloadCLIFlags)
+	setupDevlineCmdCLIArgs(devlineCmd, reloadCLIFlags)
+	setupForeachCmdCLIArgs(foreachCmd, reloadCLIFlags)
+	setupFreezeCmdCLIArgs(freezeCmd, reloadCLIFlags)
 	setupGetCmdCLIArgs(getCmd, reloadCLIFlags)
+	setupInitCmdCLIArgs(initCmd, reloadCLIFlags)
+	setupStatusCmdCLIArgs(statusCmd, reloadCLIFlags)
 	setupUpdateCmdCLIArgs(updateCmd, reloadCLIFlags)
 	setupVersionCmdCLIArgs(versionCmd, reloadCLIFlags)
 	// NewSubCommand: If you add a new subcommand you need to add a method to
@@ -710,23 +745,9 @@ func reloadCLIDefaults() {
 	//     call it from directly above).
 }
 
-// dvlnFinalPrep basically does just that... now that the 'globs' config
-// data is fully populated with CLI's, env's, config files, codebase/pkg
-// settings and defaults, handle any "easy" opts we can, eg: show version (-V),
-// show available "global" cfg/env settings (-G), set up the number of parallel
-// CPU's to leverage (-j<#>), etc... all stuff that can happen before we kick
-// into the full 'cli' (cobra) commander package 'Execute()' method.  Returns:
-// - programComplete: true if error or able to wrap up users needs
-// - exitVal (int): if programComplete is true, then 0 means success, non-zero
-//                  means failure (ignored if programComplete is false)
-func dvlnFinalPrep() (bool, int) {
-	// (re)Dump user config file info.  Possibly dumped already from the calls
-	// within scanUserConfigFile() but, if output/logfile thresholds changed in
-	// the users config file we may have missed logging it, so dump it again as
-	// it's useful for client/admin troubleshooting of dvln:
-	if globs.ConfigFileUsed() != "" {
-		out.Debugln("Used config file:", globs.ConfigFileUsed())
-	}
+// helpCmdName returns the subcommand to give in 'dvln help<subcmd>' usage
+// hints, eg: " get" (or "" for dvln itself)
+func helpCmdName() string {
 	cmdName := " [subcmd]"
 	if currentCmd != "" {
 		if currentCmd == dvlnCmd.Root().Name() {
@@ -735,17 +756,33 @@ func dvlnFinalPrep() (bool, int) {
 			cmdName = " " + currentCmd
 		}
 	}
+	return cmdName
+}
+
+// checkSettingValues makes sure the jobs, fatalon and look settings have
+// usable values and sets up the number of CPU's to use for the jobs setting.
+// It's run once all settings are in and again if codebase or devline
+// settings get merged in (see defsettings.go), as those can set them too.
+func checkSettingValues() error {
+	if issueMsg, code := settingValuesIssue(); issueMsg != "" {
+		return out.NewErr(issueMsg, code)
+	}
+	return nil
+}
 
+// settingValuesIssue does the checkSettingValues() work, returning the issue
+// message and code of the first bad setting found (or "" and 0), the REST
+// server uses it to fail the request with the issue code
+func settingValuesIssue() (string, int) {
+	cmdName := helpCmdName()
 	// Honor the parallel jobs setting (-j, --jobs, cfg file setting Jobs or env
 	// var DVLN_JOBS can all control this), identifies # of CPU's to use.
-	errExit := int(out.ErrorExitVal())
 	numCPU := runtime.NumCPU()
 	if jobs := globs.GetString("jobs"); jobs != "" && jobs != "all" {
 		if _, err := strconv.Atoi(jobs); err != nil {
-			issueMsg := fmt.Sprintf("Jobs value should be a number or 'all', found: %s\n", jobs)
+			issueMsg := fmt.Sprintf("Jobs value should be a number or 'all', found: %s (from %s)\n", jobs, settingSource("jobs"))
 			issueMsg = fmt.Sprintf("%sPlease run 'dvln help%s' for usage\n", issueMsg, cmdName)
-			out.IssueExit(errExit, out.NewErr(issueMsg, 2003))
-			return true, errExit
+			return issueMsg, 2003
 		}
 		numJobs := cast.ToInt(jobs)
 		if numJobs > numCPU {
@@ -756,24 +793,55 @@ func dvlnFinalPrep() (bool, int) {
 		runtime.GOMAXPROCS(numCPU)
 	}
 
-	// Do some validation on the 'serve' mode:
-	if serve := globs.GetBool("serve"); serve {
-		out.Fatalln("Serve mode is not available yet, to contribute email 'brady@dvln.org'  :)")
-		// Test runs can make fatal not really fatal, so bail out if so
-		return true, 0
+	// The number of VCS failures to stop at, 0 (or less) means never stop
+	if _, err := cast.ToIntE(globs.Get("fatalon")); err != nil {
+		issueMsg := fmt.Sprintf("Fatalon value should be a number (0: never stop), found: %v (from %s)\n", globs.Get("fatalon"), settingSource("fatalon"))
+		issueMsg = fmt.Sprintf("%sPlease run 'dvln help%s' for usage\n", issueMsg, cmdName)
+		return issueMsg, 2044
 	}
 
 	// Make sure that given --look|-l or cfgfile:Look or env:DVLN_LOOK are valid
 	look := globs.GetString("look")
-	if look != "text" && look != "json" {
-		issueMsg := fmt.Sprintf("The --look option (-l) can only be set to 'text' or 'json', found: '%s'\n", look)
+	if !stringInSlice(look, looks) {
+		issueMsg := fmt.Sprintf("The --look option (-l) can only be set to one of '%s', found: '%s'\n", strings.Join(looks, "', '"), look)
 		issueMsg = fmt.Sprintf("%sPlease run 'dvln help%s' for usage\n", issueMsg, cmdName)
-		out.IssueExit(errExit, out.NewErr(issueMsg, 2004))
-		return true, errExit
-	} else if look == "json" && globs.GetBool("interact") {
-		out.Debugln("Interactive runs are not available for the 'json' output \"look\"")
+		return issueMsg, 2004
+	} else if look != "text" && look != "table" && globs.GetBool("interact") {
+		out.Debugf("Interactive runs are not available for the '%s' output \"look\"\n", look)
 		out.Debugln("- silently disabling interaction (client may have it set for text output)")
-		globs.Set("interact", false)
+		setGlob("interact", false, "dvln")
+	}
+	return "", 0
+}
+
+// dvlnFinalPrep basically does just that... now that the 'globs' config
+// data is fully populated with CLI's, env's, config files, codebase/pkg
+// settings and defaults, handle any "easy" opts we can, eg: show version (-V),
+// show available "global" cfg/env settings (-G), set up the number of parallel
+// CPU's to leverage (-j<#>), etc... all stuff that can happen before we kick
+// into the full 'cli' (cobra) commander package 'Execute()' method.  Returns:
+// - programComplete: true if error or able to wrap up users needs
+// - exitVal (int): if programComplete is true, then 0 means success, non-zero
+//                  means failure (ignored if programComplete is false)
+func dvlnFinalPrep() (bool, int) {
+	// (re)Dump user config file info.  Possibly dumped already from the calls
+	// within scanUserConfigFile() but, if output/logfile thresholds changed in
+	// the users config file we may have missed logging it, so dump it again as
+	// it's useful for client/admin troubleshooting of dvln:
+	if globs.ConfigFileUsed() != "" {
+		out.Debugln("Used config file:", globs.ConfigFileUsed())
+	}
+	cmdName := helpCmdName()
+	errExit := int(out.ErrorExitVal())
+	if err := checkSettingValues(); err != nil {
+		out.IssueExit(errExit, err)
+		return true, errExit
+	}
+
+	// If serve mode is requested fire up the REST API server, see serve.go,
+	// the server only returns if it fails to start up or dies off
+	if serve := globs.GetBool("serve"); serve {
+		return true, serveREST()
 	}
 
 	// If the developer asks for the version of the tool print that out:
@@ -789,8 +857,10 @@ func dvlnFinalPrep() (bool, int) {
 	globs.Debug()
 
 	globsCLI := globs.GetString("globs")
-	if globsCLI != "" && globsCLI != "env" && globsCLI != "cfg" && globsCLI != "skip" {
-		issueMsg := fmt.Sprintf("The --globs option (-G) can only be set to 'env' or 'cfg', found: '%s'\n", globsCLI)
+	globsSrc := globsCLI == "src" || strings.HasPrefix(globsCLI, "src:")
+	globsLevel, globsLevelOK := parseGlobsLevel(strings.TrimPrefix(strings.TrimPrefix(globsCLI, "src"), ":"))
+	if globsCLI != "" && globsCLI != "env" && globsCLI != "cfg" && globsCLI != "skip" && (!globsSrc || !globsLevelOK) {
+		issueMsg := fmt.Sprintf("The --globs option (-G) can only be set to 'env' or 'cfg' (settings available) or 'src[:novice|standard|expert]' (where settings came from), found: '%s'\n", globsCLI)
 		issueMsg = fmt.Sprintf("%sPlease run 'dvln help%s' for usage\n", issueMsg, cmdName)
 		out.IssueExit(errExit, out.NewErr(issueMsg, 2005))
 		return true, errExit
@@ -801,20 +871,22 @@ func dvlnFinalPrep() (bool, int) {
 		out.Exit(0)
 		return true, 0
 	}
+	// Or where each setting came from (see globsreport.go)
+	if globsSrc {
+		output, fatalProblem := showGlobsReport(globsLevel)
+		out.Print(output)
+		if fatalProblem {
+			out.Exit(errExit)
+			return true, errExit
+		}
+		out.Exit(0)
+		return true, 0
+	}
 
-	rootDir := ""
-	var err error
 	// Find the workspaces root dir, will cache it in the wkspc module, if
 	// there is no workspace can be "" at this point (note: some cmds take
 	// a '--wkspcdir' option so that is taken into consideration 1st)
-	wkspcdir := globs.GetString("wkspcdir") // CLI option --workspace/-w
-	if wkspcdir != "." && wkspcdir != "" {
-		rootDir, err = wkspc.RootDir(wkspcdir) // handle a CLI given dir/subdir
-		out.Traceln("Workspace dir passed in:", wkspcdir)
-	} else {
-		out.Traceln("No workspace dir passed in, driving off of cwd")
-		rootDir, err = wkspc.RootDir() // scan from CWD for a wkspc root dir
-	}
+	rootDir, err := findWkspcRootDir()
 	out.Debugln("Workspace root dir:", rootDir)
 	if err != nil {
 		// err means a failure (no workspace is not an error, it's normal)
@@ -858,14 +930,24 @@ func (f handleLookJSONMsgs) FormatMessage(
 	applyMask := out.ForBoth
 	suppressOutputMask := 0
 	suppressNativePrefixing := false
-	look := globs.GetString("look")
-	if look != "json" || outLevel < out.LevelIssue {
+	if !lookIsJSON() || outLevel < out.LevelIssue {
 		return msg, 0, suppressOutputMask, suppressNativePrefixing
 	}
+	if lookIsNDJSON() {
+		// Streaming, so issues go out as events as they happen, dying or not,
+		// the event is written like any other (so it can't be interleaved
+		// with package job events) and the native output is suppressed
+		ev := &lookEvent{Event: "warning", Msg: msg, Level: fmt.Sprintf("%s", outLevel), ErrCode: code}
+		if dying {
+			ev.Event = "error"
+		}
+		emitEvent(ev)
+		return "", applyMask, out.ForBoth, true
+	}
 	problemMsg := api.NewMsg(msg, code, fmt.Sprintf("%s", outLevel))
 	if dying {
 		suppressNativePrefixing = true
-		msg = api.FatalJSONMsg(globs.GetString("apiver"), problemMsg)
+		msg = addIssueCodeJSON(api.FatalJSONMsg(globs.GetString("apiver"), problemMsg), code)
 	} else {
 		// Suppress output to the screen and the logfile, our final JSON dump
 		// will include the warning and that will also go to the logfile (assuming
@@ -17,7 +17,9 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"runtime"
 	"strings"
 	"testing"
@@ -121,6 +123,7 @@ func TestHelpInterface(t *testing.T) {
 	checkResultContains(t, x, "dvln: Multi-package development line and workspace management tool")
 	checkResultContains(t, x, "Available Commands:")
 	checkResultContains(t, x, "get packages")
+	checkResultContains(t, x, "show package status within a workspace")
 	checkResultContains(t, x, "-D, --debug           control debug output")
 	x = setupDvlnCmdTest("--help")
 	checkResultContains(t, x, "dvln: Multi-package development line and workspace management tool")
@@ -153,6 +156,41 @@ func TestHelpInterface(t *testing.T) {
 	checkResultOmits(t, x, "\"apiVersion\": ")
 }
 
+// TestHelpCodes checks the issue code registry is available via help
+func TestHelpCodes(t *testing.T) {
+	x := setupDvlnCmdTest("help codes")
+	checkResultContains(t, x, "Issue codes:")
+	checkResultContains(t, x, "2001 issue no subcommand given")
+	checkResultContains(t, x, "hint: run 'dvln help' for the list of subcommands")
+	x = setupDvlnCmdTest("codes 2016")
+	checkResultContains(t, x, "2016 issue no workspace found")
+	checkResultOmits(t, x, "2001 issue")
+}
+
+func TestConfigValidation(t *testing.T) {
+	os.Setenv("PKG_OUT_NO_EXIT", "1")
+	x := setupDvlnCmdTest("config set bogus 1")
+	checkResultContains(t, x, "Issue #2038: Unable to use setting bogus: unknown setting")
+	x = setupDvlnCmdTest("config set globs cfg")
+	checkResultContains(t, x, "Issue #2038: Unable to use setting globs: setting \"globs\" can't be set in a config file")
+	x = setupDvlnCmdTest("config set --scope=team jobs 4")
+	checkResultContains(t, x, "Issue #2018: The --scope option can only be set to 'user' or 'workspace'")
+	os.Setenv("PKG_OUT_NO_EXIT", "0")
+}
+
+func TestLooks(t *testing.T) {
+	x := setupDvlnCmdTest("-L ndjson codes 2016")
+	checkResultContains(t, x, `{"event":"result",`)
+	checkResultContains(t, x, `"context":"dvlnCodes","kind":"codes"`)
+	checkResultContains(t, x, `"code":2016`)
+	checkResultOmits(t, x, "2016 issue no workspace found")
+	x = setupDvlnCmdTest("-L table codes 2016")
+	checkResultContains(t, x, "CODE  SEVERITY  DESCRIPTION")
+	checkResultContains(t, x, "2016  issue     no workspace found")
+	x = setupDvlnCmdTest("-L xml codes")
+	checkResultContains(t, x, "can only be set to one of 'text', 'json', 'ndjson', 'yaml', 'table'")
+}
+
 func TestAnalysisArg(t *testing.T) {
 	// We'll combine it with help output for a few
 	x := setupDvlnCmdTest("-Ah")
@@ -331,6 +369,19 @@ func TestGlobsFunctionality(t *testing.T) {
 	if err != nil {
 		t.Fatalf("Unable to unmarshal JSON: -vGcfg -Ljson options used: %s", err)
 	}
+	x = setupDvlnCmdTest("-Gsrc -v")
+	checkResultContains(t, x, "NAME")
+	checkResultContains(t, x, "SOURCE")
+	checkResultContains(t, x, "cli:--globs")
+	checkResultContains(t, x, "EXPERT")
+	checkResultContains(t, x, "memory and timing analytics")
+	x = setupDvlnCmdTest("-Gsrc:novice -v")
+	checkResultContains(t, x, "NOVICE")
+	checkResultOmits(t, x, "memory and timing analytics")
+	x = setupDvlnCmdTest("-Gsrc:bogus")
+	checkResultContains(t, x, "Issue #2005: The --globs option (-G) can only be set to 'env' or 'cfg'")
+	x = setupDvlnCmdTest("-Gsrcnovice")
+	checkResultContains(t, x, "Issue #2005: The --globs option (-G) can only be set to 'env' or 'cfg'")
 	x = setupDvlnCmdTest("--verbose=false -tGenv -Ljson")
 	checkResultContains(t, x, "\"apiVersion\": ")
 	checkResultContains(t, x, "\"id\": 0,")
@@ -367,3 +418,81 @@ func TestGlobsFunctionality(t *testing.T) {
 	checkResultContains(t, x, "Issue #2001: Please use a valid subcommand")
 	os.Setenv("PKG_OUT_NO_EXIT", "0")
 }
+
+// TestSettingLayers checks the priority of the settings layers, from lowest
+// to highest: the users config, the workspace config, env and then the CLI
+func TestSettingLayers(t *testing.T) {
+	os.Setenv("PKG_OUT_NO_EXIT", "1")
+	defer os.Setenv("PKG_OUT_NO_EXIT", "0")
+	root, err := ioutil.TempDir("", "dvlnlayers")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	userCfg := filepath.Join(root, "cfg.json")
+	wkspcDir := filepath.Join(root, "wkspc")
+	wkspcCfg := filepath.Join(wkspcDir, ".dvln", "cfg.json")
+	if err = os.MkdirAll(filepath.Dir(wkspcCfg), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for file, cfg := range map[string]string{
+		userCfg:  `{"logfilelevel": "debug", "devline": "user_dl", "fatalon": 1, "jobs": "1"}`,
+		wkspcCfg: `{"devline": "wkspc_dl", "fatalon": 2, "jobs": "2", "bogus": 1}`,
+	} {
+		if err = ioutil.WriteFile(file, []byte(cfg), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Chdir(wkspcDir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(cwd)
+	snap := snapshotGlobs()
+	defer snap.restore()
+	os.Setenv("DVLN_CONFIG", userCfg)
+	defer os.Unsetenv("DVLN_CONFIG")
+	os.Setenv("DVLN_FATALON", "3")
+	defer os.Unsetenv("DVLN_FATALON")
+	os.Setenv("DVLN_JOBS", "3")
+	defer os.Unsetenv("DVLN_JOBS")
+
+	// put the sticky CLI options back for the tests that follow
+	defer setupDvlnCmdTest("-Jall -Ltext -Gskip")
+	x := setupDvlnCmdTest("-Gsrc")
+	checkResultContains(t, x, "Issue #2036: Workspace config file "+wkspcCfg+": unknown setting \"bogus\"")
+	checkResultContains(t, x, "wkspc_dl")
+	x = setupDvlnCmdTest("-J4 -Gsrc -Ljson")
+	var resp struct {
+		Data struct {
+			Items []*globSetting `json:"items"`
+		} `json:"data"`
+	}
+	jsonStart := strings.Index(x.Output, "{")
+	if jsonStart < 0 {
+		t.Fatalf("No JSON in the -Gsrc -Ljson output:\n%s", x.Output)
+	}
+	if err = json.NewDecoder(strings.NewReader(x.Output[jsonStart:])).Decode(&resp); err != nil {
+		t.Fatalf("Unable to unmarshal JSON: -J4 -Gsrc -Ljson options used: %s", err)
+	}
+	want := map[string][2]string{
+		"logfilelevel": {"debug", "config:" + userCfg},
+		"devline":      {"wkspc_dl", "workspace:" + wkspcCfg},
+		"fatalon":      {"3", "env:DVLN_FATALON"},
+		"jobs":         {"4", "cli:--jobs"},
+	}
+	for _, setting := range resp.Data.Items {
+		if w, ok := want[setting.Name]; ok {
+			if value := fmt.Sprint(setting.Value); value != w[0] || setting.Source != w[1] {
+				t.Errorf("Setting %s: got %s from %s, want %s from %s", setting.Name, value, setting.Source, w[0], w[1])
+			}
+			delete(want, setting.Name)
+		}
+	}
+	for name := range want {
+		t.Errorf("Setting %s missing from the -Gsrc report", name)
+	}
+}
@@ -0,0 +1,172 @@
+// Copyright © 2015 Erik Brady <brady@dvln.org>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package cmds foreach.go module implements the 'dvln foreach' subcommand
+// framework for the 'cli' (aka: cobra) package.  Lets run something in
+// every package!!!
+package cmds
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	cli "github.com/dvln/cobra"
+	"github.com/dvln/out"
+	globs "github.com/dvln/viper"
+	"github.com/dvln/wkspc"
+)
+
+var foreachCmd = &cli.Command{
+	Use:   "foreach",
+	Short: "run a command in every package",
+	Long: `Run a command in each (or each selected) package dir in parallel, eg:
+  % dvln foreach 'git log -1 --oneline | cat'   (one arg: run via the shell)
+  % dvln foreach --pkg=pkg_x,pkg_y -- make test  (args: run as is, no shell)
+  % dvln foreach -J4 -F0 -- make test   (4 at a time, don't stop on failures)
+  % dvln foreach -- grep -n 'two words' README
+Output is prefixed with the package name, the command can use the env vars
+DVLN_PKG_NAME, DVLN_PKG_PATH and DVLN_WKSPC_ROOT`,
+	Run: foreach,
+}
+
+// init bootstraps the options used for the foreach subcommand and descriptions
+// and initial defaults for those options and such.
+func init() {
+	reloadCLIFlags := false
+	setupForeachCmdCLIArgs(foreachCmd, reloadCLIFlags)
+}
+
+// setupForeachCmdCLIArgs is used from init() to set up the 'globs' (viper) pkg
+// CLI options available to this subcommand (other options were already set up
+// in the "parent" dvln subcommand in a like-named method). Every subcommand
+// has a like named method "setup<subcmd>CmdCLIArgs()", called in init() above
+// and called from dvln.go
+func setupForeachCmdCLIArgs(c *cli.Command, reloadCLIFlags bool) {
+	var desc string
+	if reloadCLIFlags {
+		c.Flags().SetDefValueReparseOK(true)
+	}
+	desc, _, _ = globs.Desc("pkg")
+	c.Flags().StringP("pkg", "p", globs.GetString("pkg"), desc)
+	c.Run = foreach
+	// NewCLIOpts: if there were opts for the subcmd set them here and note that
+	// "persistent" opts are set in cmds/dvln.go, only opts specific to the
+	// 'dvln foreach' subcommand are set here
+	// Note that you'll need to modify cmds/global.go as well otherwise your
+	// globs.Desc() call and globs.GetBool("myopt") will not work.
+	if reloadCLIFlags {
+		c.Flags().SetDefValueReparseOK(false)
+	}
+}
+
+// foreach defines the 'dvln foreach' sub-command, it runs the given command in
+// each selected package (in parallel, see jobs.go) and exits non-zero if the
+// command failed in any package
+func foreach(cmd *cli.Command, args []string) {
+	out.Debugln("Initialization done, firing up foreach()")
+	errExit := int(out.ErrorExitVal())
+	if len(args) == 0 {
+		out.IssueExit(errExit, out.NewErr("Please give a command to run, run 'dvln help foreach' for usage", 2018))
+		return
+	}
+	cmdLine := strings.Join(args, " ")
+	wkspcRootDir, err := wkspc.RootDir()
+	if err != nil {
+		out.ErrorExit(errExit, out.WrapErr(err, "Unexpected problem scanning for a workspace", 2006))
+		return
+	}
+	if wkspcRootDir == "" {
+		out.ErrorExit(errExit, out.NewErr("No workspace found, use 'dvln get' or 'dvln init' to create one", 2016))
+		return
+	}
+	info, pkgs, err := wkspcRecordedPkgs(wkspcRootDir)
+	if err == nil {
+		pkgs, err = selectWkspcPkgs(wkspcRootDir, info, pkgs, globs.GetString("pkg"))
+	}
+	if err != nil {
+		out.ErrorExit(errExit, err)
+		return
+	}
+
+	out.Debugf("Running \"%s\" in %d packages\n", cmdLine, len(pkgs))
+	results, budgetHit := runPkgJobs(pkgs, func(ctx context.Context, p *resolvedPkg) *pkgResult {
+		return runInPkg(ctx, wkspcRootDir, p, args)
+	}, reportForeachResult)
+	finishPkgJobs("dvlnForeach", results, budgetHit)
+}
+
+// foreachExecCmd returns the command to run for the given foreach args, a
+// single arg is a command line for the shell (so pipes, env vars and the like
+// work) while more than one arg is a command and it's args which are run as
+// is, without a shell, so the quoting they had on the dvln CLI is kept
+func foreachExecCmd(ctx context.Context, args []string) *exec.Cmd {
+	switch {
+	case len(args) > 1:
+		return exec.CommandContext(ctx, args[0], args[1:]...)
+	case runtime.GOOS == "windows":
+		return exec.CommandContext(ctx, "cmd", "/C", args[0])
+	}
+	return exec.CommandContext(ctx, "sh", "-c", args[0])
+}
+
+// runInPkg runs the given command (see foreachExecCmd()) in the package dir,
+// it's run as one of the parallel package jobs (see jobs.go) so the output
+// of the command is collected rather than printed
+func runInPkg(ctx context.Context, wkspcRootDir string, p *resolvedPkg, args []string) *pkgResult {
+	r := &pkgResult{Name: p.Name, Action: "ok"}
+	pkgDir, err := wkspcPkgDir(wkspcRootDir, p.Path)
+	if err != nil {
+		return r.failed(2041, err)
+	}
+	if _, err := os.Stat(pkgDir); os.IsNotExist(err) {
+		r.Action = "missing"
+		return r
+	}
+	cmdLine := strings.Join(args, " ")
+	c := foreachExecCmd(ctx, args)
+	c.Dir = pkgDir
+	c.Env = append(os.Environ(),
+		"DVLN_PKG_NAME="+p.Name,
+		"DVLN_PKG_PATH="+p.Path,
+		"DVLN_WKSPC_ROOT="+wkspcRootDir)
+	output, err := c.CombinedOutput()
+	for _, line := range strings.Split(strings.TrimRight(string(output), "\n"), "\n") {
+		if line != "" {
+			r.Output = append(r.Output, line)
+		}
+	}
+	if err != nil && ctx.Err() != nil {
+		return r.failed(2025, fmt.Errorf("Package %s: command \"%s\" stopped: %w", p.Name, cmdLine, ctx.Err()))
+	}
+	if err != nil {
+		r.Action = "failed"
+		return r.failed(2025, out.WrapErr(err, fmt.Sprintf("Package %s: command \"%s\" failed", p.Name, cmdLine), 2025))
+	}
+	return r
+}
+
+// reportForeachResult shows the command output for a package prefixed by the
+// package name (in text mode, other looks are dumped in finishPkgJobs())
+func reportForeachResult(r *pkgResult) {
+	if lookIsStructured() {
+		return
+	}
+	for _, line := range r.Output {
+		out.Printf("%s: %s\n", r.Name, line)
+	}
+	reportPkgResult(r)
+}
@@ -0,0 +1,43 @@
+// Copyright © 2015 Erik Brady <brady@dvln.org>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmds
+
+import (
+	"context"
+	"runtime"
+	"testing"
+)
+
+func TestForeachExecCmd(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh and echo")
+	}
+	ctx := context.Background()
+	// several args are run as is, quoting kept and nothing expanded
+	got, err := foreachExecCmd(ctx, []string{"echo", "two  words", "$HOME"}).Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "two  words $HOME\n" {
+		t.Errorf("multi-arg command output %q, quoting or args not kept", got)
+	}
+	// a single arg is a shell command line
+	got, err = foreachExecCmd(ctx, []string{"echo a | tr a b"}).Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "b\n" {
+		t.Errorf("single arg command output %q, not run via the shell", got)
+	}
+}
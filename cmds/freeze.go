@@ -0,0 +1,191 @@
+// Copyright © 2015 Erik Brady <brady@dvln.org>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package cmds freeze.go module implements the 'dvln freeze' subcommand
+// framework for the 'cli' (aka: cobra) package.  Lets snapshot a workspace!!!
+package cmds
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	cli "github.com/dvln/cobra"
+	"github.com/dvln/out"
+	"github.com/dvln/wkspc"
+)
+
+var freezeCmd = &cli.Command{
+	Use:   "freeze",
+	Short: "snapshot the workspace into a static devline",
+	Long: `Snapshot the exact revision of every package in the workspace into a new
+static devline that can be used to reproduce the workspace later, eg:
+  % dvln freeze proj_x_rc1
+  % dvln get -d proj_x_rc1             (reproduce it elsewhere)
+  % dvln freeze --force proj_x_rc1     (overwrite an existing devline)
+  % dvln freeze /tmp/bug1234.json      (write to a specific file)
+Note: local modifications and unpushed revisions are not captured, a
+warning is given for any package that has either`,
+	Run: freeze,
+}
+
+// init bootstraps the options used for the freeze subcommand and descriptions
+// and initial defaults for those options and such.
+func init() {
+	reloadCLIFlags := false
+	setupFreezeCmdCLIArgs(freezeCmd, reloadCLIFlags)
+}
+
+// setupFreezeCmdCLIArgs is used from init() to set up the 'globs' (viper) pkg
+// CLI options available to this subcommand (other options were already set up
+// in the "parent" dvln subcommand in a like-named method). Every subcommand
+// has a like named method "setup<subcmd>CmdCLIArgs()", called in init() above
+// and called from dvln.go
+func setupFreezeCmdCLIArgs(c *cli.Command, reloadCLIFlags bool) {
+	if reloadCLIFlags {
+		c.Flags().SetDefValueReparseOK(true)
+	}
+	c.Run = freeze
+	// NewCLIOpts: if there were opts for the subcmd set them here and note that
+	// "persistent" opts are set in cmds/dvln.go, only opts specific to the
+	// 'dvln freeze' subcommand are set here
+	// Note that you'll need to modify cmds/global.go as well otherwise your
+	// globs.Desc() call and globs.GetBool("myopt") will not work.
+	if reloadCLIFlags {
+		c.Flags().SetDefValueReparseOK(false)
+	}
+}
+
+// freeze defines the 'dvln freeze' sub-command, it grabs the revision checked
+// out for each package in the workspace (in parallel, see jobs.go) and then
+// writes them out as a new static devline
+func freeze(cmd *cli.Command, args []string) {
+	out.Debugln("Initialization done, firing up freeze()")
+	errExit := int(out.ErrorExitVal())
+	if len(args) != 1 {
+		out.IssueExit(errExit, out.NewErr("Please give the name of the devline to create, run 'dvln help freeze' for usage", 2018))
+		return
+	}
+	devline := args[0]
+	wkspcRootDir, err := wkspc.RootDir()
+	if err != nil {
+		out.ErrorExit(errExit, out.WrapErr(err, "Unexpected problem scanning for a workspace", 2006))
+		return
+	}
+	if wkspcRootDir == "" {
+		out.ErrorExit(errExit, out.NewErr("No workspace found, use 'dvln get' or 'dvln init' to create one", 2016))
+		return
+	}
+	file := devlineFile(devline)
+	if _, err = os.Stat(file); err == nil {
+		if err = protectDevline.guard(fmt.Sprintf("Devline %s already exists (%s)", devline, file)); err != nil {
+			out.IssueExit(errExit, err)
+			return
+		}
+	}
+	// The packages come from the manifest (sans orphans, they're no longer
+	// in the devline) or, if there isn't one, the workspace codebase/devline
+	info, recorded, err := wkspcRecordedPkgs(wkspcRootDir)
+	var m *wkspcManifest
+	if err == nil {
+		m, err = readManifest(wkspcRootDir)
+	}
+	if err != nil {
+		out.ErrorExit(errExit, err)
+		return
+	}
+	pkgs := make([]*resolvedPkg, 0, len(recorded))
+	for _, p := range recorded {
+		if mp := m.pkg(p.Name); mp == nil || !mp.Orphan {
+			pkgs = append(pkgs, p)
+		}
+	}
+	if len(pkgs) == 0 {
+		out.ErrorExit(errExit, out.NewErr(fmt.Sprintf("No packages in workspace %s to freeze, devline %s not written", wkspcRootDir, devline), 2023))
+		return
+	}
+
+	results, budgetHit := runPkgJobs(pkgs, func(ctx context.Context, p *resolvedPkg) *pkgResult {
+		return freezePkg(ctx, wkspcRootDir, p)
+	}, func(r *pkgResult) {
+		reportPkgResult(r)
+		if r.Err == nil && r.Action != "frozen" {
+			out.Issueln(out.NewErr(fmt.Sprintf("Package %s: frozen but %s, local work is not captured", r.Name, r.Action), 2024))
+		}
+	})
+	// Only a snapshot of every package is written, the results are the one
+	// response (they say which packages failed)
+	for _, r := range results {
+		if r.Err != nil || r.Action == "not run" || r.Action == "cancelled" {
+			if !lookIsStructured() {
+				out.Issueln(out.NewErr(fmt.Sprintf("Unable to snapshot every package, devline %s not written", devline), 2023))
+			}
+			finishPkgJobs("dvlnFreeze", results, budgetHit)
+			return
+		}
+	}
+
+	// a devline given as a file is named after it, sans the extension
+	name := filepath.Base(devline)
+	if stringInSlice(filepath.Ext(name), defExts) {
+		name = strings.TrimSuffix(name, filepath.Ext(name))
+	}
+	dl := &devlineDef{
+		Name:        name,
+		Description: fmt.Sprintf("Frozen from workspace %s on %s", wkspcRootDir, time.Now().Format(time.RFC1123)),
+		Codebase:    info.Codebase,
+		Packages:    make([]*devlinePkg, 0, len(pkgs)),
+	}
+	for _, r := range results {
+		dl.Packages = append(dl.Packages, &devlinePkg{Name: r.Name, Revision: r.Revision})
+	}
+	if err = writeDevline(file, dl); err != nil {
+		out.ErrorExit(errExit, err)
+		return
+	}
+	out.Verboseln("Wrote devline to:", file)
+	finishPkgJobs("dvlnFreeze", results, budgetHit)
+}
+
+// freezePkg grabs the revision of a single package and notes if there's any
+// local work that won't be captured by that revision, it's run as one of
+// the parallel package jobs (see jobs.go) so it must not print anything
+func freezePkg(ctx context.Context, wkspcRootDir string, p *resolvedPkg) *pkgResult {
+	r := &pkgResult{Name: p.Name, Action: "frozen"}
+	pkgDir, err := wkspcPkgDir(wkspcRootDir, p.Path)
+	if err != nil {
+		return r.failed(2041, err)
+	}
+	if r.Revision, err = vcsRevision(ctx, p, pkgDir); err != nil {
+		return r.failed(2015, err)
+	}
+	r.Msgs = append(r.Msgs, fmt.Sprintf("at revision %s", r.Revision))
+	dirty, err := vcsIsDirty(ctx, p, pkgDir)
+	if err != nil {
+		return r.failed(2015, err)
+	}
+	unpushed, err := vcsUnpushed(ctx, p, pkgDir)
+	if err != nil {
+		return r.failed(2015, err)
+	}
+	switch {
+	case dirty:
+		r.Action = "modified"
+	case unpushed != 0:
+		r.Action = "unpushed"
+	}
+	return r
+}
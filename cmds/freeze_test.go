@@ -0,0 +1,100 @@
+// Copyright © 2015 Erik Brady <brady@dvln.org>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmds
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// TestFreeze freezes a workspace with a clean package, one with local
+// changes and one with a revision on a local branch only, each is frozen at
+// it's checked out revision and the local work is noted
+func TestFreeze(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	os.Setenv("PKG_OUT_NO_EXIT", "1")
+	defer os.Setenv("PKG_OUT_NO_EXIT", "0")
+	root, err := ioutil.TempDir("", "dvlnfreeze")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	remote := filepath.Join(root, "remote")
+	testGit(t, root, "init", "-q", "-b", "main", remote)
+	testGit(t, remote, "commit", "-q", "--allow-empty", "-m", "one")
+	wkspcRootDir := filepath.Join(root, "ws")
+	m := &wkspcManifest{}
+	var pkgs []*resolvedPkg
+	for _, name := range []string{"clean", "dirty", "unpushed"} {
+		p := &resolvedPkg{Name: name, Path: name, VCS: "git", Remote: remote, Version: "main"}
+		testGit(t, root, "clone", "-q", remote, filepath.Join(wkspcRootDir, name))
+		m.setPkg(p, "")
+		pkgs = append(pkgs, p)
+	}
+	if err = ioutil.WriteFile(filepath.Join(wkspcRootDir, "dirty", "new.txt"), []byte("x\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// the unpushed revision is on a branch that's not checked out, so the
+	// checked out branch isn't ahead of it's remote
+	unpushedDir := filepath.Join(wkspcRootDir, "unpushed")
+	testGit(t, unpushedDir, "checkout", "-q", "-b", "wip")
+	testGit(t, unpushedDir, "commit", "-q", "--allow-empty", "-m", "local")
+	testGit(t, unpushedDir, "checkout", "-q", "main")
+	if err = createWkspcMetaDir(wkspcRootDir); err == nil {
+		err = writeManifest(wkspcRootDir, m)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, action := range []string{"frozen", "modified", "unpushed"} {
+		r := freezePkg(context.Background(), wkspcRootDir, pkgs[i])
+		if r.Err != nil || r.Action != action {
+			t.Errorf("Package %s: frozen as %s (err: %v), want %s", pkgs[i].Name, r.Action, r.Err, action)
+		}
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(cwd)
+	if err = os.Chdir(wkspcRootDir); err != nil {
+		t.Fatal(err)
+	}
+	snap := snapshotGlobs()
+	defer snap.restore()
+	setGlob("look", "text", "test")
+	file := filepath.Join(root, "proj_x_rc1.json")
+	freeze(freezeCmd, []string{file})
+	dl, err := loadDevline(file)
+	if err != nil {
+		t.Fatalf("Unable to read the frozen devline: %s", err)
+	}
+	if dl.Name != "proj_x_rc1" || len(dl.Packages) != len(pkgs) {
+		t.Fatalf("Frozen devline %s has %d packages, want proj_x_rc1 with %d", dl.Name, len(dl.Packages), len(pkgs))
+	}
+	for i, dp := range dl.Packages {
+		rev := testGit(t, filepath.Join(wkspcRootDir, pkgs[i].Path), "rev-parse", "HEAD")
+		if dp.Name != pkgs[i].Name || dp.Revision != rev {
+			t.Errorf("Frozen package %s at %s, want %s at %s", dp.Name, dp.Revision, pkgs[i].Name, rev)
+		}
+	}
+}
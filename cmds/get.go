@@ -16,6 +16,11 @@
 package cmds
 
 import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
 	cli "github.com/dvln/cobra"
 	"github.com/dvln/out"
 	globs "github.com/dvln/viper"
@@ -28,7 +33,9 @@ var getCmd = &cli.Command{
 	Long: `Get packages via a static or dynamic/generated devline, eg:
   % dvln get [ --codebase=cb_x ] [ --pkg=pkg_y ] [ --devline=dl_z ]
   % dvln get [ -c cb_x ] [ -p=pkg_y ] [ -d dl_z ]
-  % dvln g [ -d dl_z ]    (set cfgfile:codebase|env:DVLN_CODEBASE, not req'd)`,
+  % dvln g [ -d dl_z ]    (set cfgfile:codebase|env:DVLN_CODEBASE, not req'd)
+  % dvln get -d dl_z -v   (shows which devline set each package version)
+  % dvln get -d dl_z -L ndjson  (streams package progress as JSON events)`,
 	Run: get,
 }
 
@@ -70,21 +77,103 @@ func setupGetCmdCLIArgs(c *cli.Command, reloadCLIFlags bool) {
 
 // get defines the 'dvln get' sub-command in terms of it's options and making
 // sure global config is setup correctly with all settings/controls the user
-// requsted via the CLI
+// requsted via the CLI.  It reads the codebase definition, resolves the
+// devline (if any) into packages and versions, bootstraps the workspace
+// metadata dir and then clones each package into the workspace.
 func get(cmd *cli.Command, args []string) {
 	out.Debugln("Initialization done, firing up get()")
+	errExit := int(out.ErrorExitVal())
 	// use precomputed workspace root dir (see dvln.go), may be empty
 	wkspcRootDir, err := wkspc.RootDir()
 	if err != nil {
-		out.ErrorExit(int(out.ErrorExitVal()), out.WrapErr(err, "Unexpected problem scanning for a workspace", 2006))
+		out.ErrorExit(errExit, out.WrapErr(err, "Unexpected problem scanning for a workspace", 2006))
 		return
 	}
 	if wkspcRootDir == "" {
-		out.Debugln("Workspace root: no workspace")
+		// No workspace yet, the one we're getting goes in --wkspcdir (or cwd)
+		if wkspcRootDir, err = filepath.Abs(globs.GetString("wkspcdir")); err != nil {
+			out.ErrorExit(errExit, out.WrapErr(err, "Unable to determine the workspace dir", 2006))
+			return
+		}
+		out.Debugln("Workspace root: no workspace, creating:", wkspcRootDir)
 	} else {
 		out.Debugln("Workspace root:", wkspcRootDir)
 	}
 	codebase := globs.GetString("codebase")
 	devline := globs.GetString("devline")
+	if codebase == "" && devline != "" {
+		// devlines can say what codebase they're for (eg: frozen devlines)
+		if dlCodebase, err := devlineCodebase(devline); err == nil {
+			codebase = dlCodebase
+		}
+	}
 	out.Debugf("Getting packages from codebase %s, devline %s\n", codebase, devline)
+
+	cb, err := loadCodebase(codebase)
+	if err != nil {
+		out.ErrorExit(errExit, err)
+		return
+	}
+	pkgs, origins, err := resolveDevlineChain(cb, devline)
+	if err == nil {
+		showPkgOrigins(pkgs, origins)
+		pkgs, err = selectPkgs(pkgs, globs.GetString("pkg"), cb, wkspcRootDir)
+	}
+	if err != nil {
+		out.ErrorExit(errExit, err)
+		return
+	}
+
+	// Bootstrap the workspace metadata and record where it came from
+	if err = createWkspcMetaDir(wkspcRootDir); err != nil {
+		out.ErrorExit(errExit, err)
+		return
+	}
+	if err = writeWkspcInfo(wkspcRootDir, &wkspcInfo{Codebase: cb.Name, Devline: devline}); err != nil {
+		out.ErrorExit(errExit, err)
+		return
+	}
+	if err = wkspc.SetRootDir(wkspcRootDir); err != nil {
+		out.ErrorExit(errExit, out.WrapErr(err, "Unexpected problem setting the workspace root dir", 2007))
+		return
+	}
+
+	mr, err := newManifestRecorder(wkspcRootDir, pkgs, nil)
+	if err != nil {
+		out.ErrorExit(errExit, err)
+		return
+	}
+	results, budgetHit := runPkgJobs(pkgs, func(ctx context.Context, p *resolvedPkg) *pkgResult {
+		return getPkg(ctx, wkspcRootDir, p)
+	}, mr.reporter(reportPkgResult))
+	if mr.err != nil {
+		out.ErrorExit(errExit, mr.err)
+		return
+	}
+	finishPkgJobs("dvlnGet", results, budgetHit)
+}
+
+// getPkg brings a single package into the workspace, it is run as one of the
+// parallel package jobs (see jobs.go) so it must not print anything itself
+func getPkg(ctx context.Context, wkspcRootDir string, p *resolvedPkg) *pkgResult {
+	r := &pkgResult{Name: p.Name}
+	pkgDir, err := wkspcPkgDir(wkspcRootDir, p.Path)
+	if err != nil {
+		return r.failed(2041, err)
+	}
+	if _, err := os.Stat(pkgDir); err == nil {
+		r.Action = "skipped"
+		r.Msgs = append(r.Msgs, "already in workspace")
+		r.Revision, _ = vcsRevision(ctx, p, pkgDir)
+		return r
+	}
+	r.Action = "got"
+	r.Msgs = append(r.Msgs, fmt.Sprintf("version \"%s\" from %s", p.Version, p.Remote))
+	if err := vcsClone(ctx, p, pkgDir); err != nil {
+		// don't leave a partial clone around, it would look like a good pkg
+		os.RemoveAll(pkgDir)
+		return r.failed(2013, err)
+	}
+	r.Revision, _ = vcsRevision(ctx, p, pkgDir)
+	return r
 }
@@ -0,0 +1,234 @@
+// Copyright © 2015 Erik Brady <brady@dvln.org>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package cmds globsreport.go module implements the '--globs=src' settings
+// provenance report, it lists every known 'globs' (viper) setting with its
+// effective value and where that value came from, eg:
+//
+//	% dvln --globs=src
+//	% dvln --globs=src:standard -v   (novice+standard settings, full detail)
+//	% dvln -Gsrc -Ljson
+package cmds
+
+import (
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	flag "github.com/dvln/pflag"
+	globs "github.com/dvln/viper"
+)
+
+// globSources tracks settings that dvln itself set (or overrode from some
+// other layer, eg: a workspace config) and where the value came from, the
+// 'globs' (viper) pkg can't tell us that so we keep track here
+var globSources = make(map[string]string)
+
+// cliGlobs tracks the settings that were given as CLI options
+var cliGlobs = make(map[string]bool)
+
+// globSourcesMu protects globSources, 'dvln --serve' sets globs per request
+var globSourcesMu sync.Mutex
+
+// setGlob sets the given 'globs' (viper) setting, overriding all other
+// layers, and records where the value came from for the --globs=src report
+// - source: where the value came from, eg: "dvln" or "workspace:<file>"
+func setGlob(key string, value interface{}, source string) {
+	globs.Set(key, value)
+	globSourcesMu.Lock()
+	globSources[strings.ToLower(key)] = source
+	globSourcesMu.Unlock()
+}
+
+// globDefaults are the setting defaults (see setGlobDefault()), lower case
+var globDefaults = make(map[string]interface{})
+
+// setGlobDefault sets the default value of the given 'globs' (viper) setting
+// and records it, 'globs' can't give the default back once a setting is set
+// by other layers but the type of the default is the type of the setting
+// (see configValue())
+func setGlobDefault(key string, value interface{}) {
+	globs.SetDefault(key, value)
+	globDefaults[strings.ToLower(key)] = value
+}
+
+// globsSnapshot is the value and recorded source (if any) of every setting at
+// some point in time, so settings changed since can be put back (see restore)
+type globsSnapshot struct {
+	values  map[string]interface{}
+	sources map[string]string
+}
+
+// snapshotGlobs takes a snapshot of all the 'globs' (viper) settings
+func snapshotGlobs() *globsSnapshot {
+	snap := &globsSnapshot{values: make(map[string]interface{}), sources: make(map[string]string)}
+	for _, key := range globs.AllKeys() {
+		snap.values[strings.ToLower(key)] = globs.Get(key)
+	}
+	globSourcesMu.Lock()
+	for key, source := range globSources {
+		snap.sources[key] = source
+	}
+	globSourcesMu.Unlock()
+	return snap
+}
+
+// restore puts back the value and source of every setting that was changed
+// via setGlob() since the snapshot was taken, settings that weren't changed
+// are left alone (so they stay in the layer they came from)
+func (snap *globsSnapshot) restore() {
+	globSourcesMu.Lock()
+	defer globSourcesMu.Unlock()
+	for key, source := range globSources {
+		if prev, ok := snap.sources[key]; ok && prev == source && reflect.DeepEqual(snap.values[key], globs.Get(key)) {
+			continue
+		}
+		globs.Set(key, snap.values[key])
+		if prev, ok := snap.sources[key]; ok {
+			globSources[key] = prev
+		} else {
+			delete(globSources, key)
+		}
+	}
+}
+
+// recordCLIGlobs notes which of the given flags were used on the CLI
+func recordCLIGlobs(flags *flag.FlagSet) {
+	flags.Visit(func(f *flag.Flag) {
+		cliGlobs[strings.ToLower(f.Name)] = true
+	})
+}
+
+// useLevelNames maps the 'globs' user levels to the names used in reports
+// (and, in any case, in the --globs=src:<level> filter)
+var useLevelNames = map[globs.UseLevel]string{
+	globs.InternalUse:  "INTERNAL",
+	globs.NoviceUser:   "NOVICE",
+	globs.StandardUser: "STANDARD",
+	globs.ExpertUser:   "EXPERT",
+}
+
+// scopeNames maps the 'globs' scopes to the names used in reports
+var scopeNames = map[globs.Scope]string{
+	globs.ConstGlobal:   "ConstGlobal",
+	globs.BasicGlobal:   "BasicGlobal",
+	globs.CLIGlobal:     "CLIGlobal",
+	globs.CLIOnlyGlobal: "CLIOnlyGlobal",
+}
+
+// globSetting is a single line item in the --globs=src report
+type globSetting struct {
+	Name        string      `json:"name"`
+	Value       interface{} `json:"value"`
+	Source      string      `json:"source"`
+	UseLevel    string      `json:"useLevel"`
+	Scope       string      `json:"scope"`
+	Description string      `json:"description"`
+}
+
+// globsEnvVar returns the env var that can set the given setting
+func globsEnvVar(key string) string {
+	return "DVLN_" + strings.ToUpper(key)
+}
+
+// globSource returns where the effective value of the given setting came
+// from, in the order the 'globs' pkg gives them priority: set by dvln (or an
+// override layer), CLI option, env var, config file and finally the default
+func globSource(key string, scope globs.Scope) string {
+	key = strings.ToLower(key)
+	globSourcesMu.Lock()
+	source, ok := globSources[key]
+	globSourcesMu.Unlock()
+	switch {
+	case ok:
+		return source
+	case cliGlobs[key]:
+		return "cli:--" + key
+	case scope == globs.ConstGlobal || scope == globs.CLIOnlyGlobal:
+		return "default"
+	}
+	if _, ok := os.LookupEnv(globsEnvVar(key)); ok {
+		return "env:" + globsEnvVar(key)
+	}
+	if globs.InConfig(key) {
+		return "config:" + globs.ConfigFileUsed()
+	}
+	return "default"
+}
+
+// settingSource returns where the effective value of the given setting came
+// from, see globSource()
+func settingSource(key string) string {
+	_, _, scope := globs.Desc(key)
+	return globSource(key, scope)
+}
+
+// parseGlobsLevel takes the <level> from --globs=src:<level> and returns the
+// highest user level to report (all levels if no level was given)
+func parseGlobsLevel(level string) (globs.UseLevel, bool) {
+	if level == "" {
+		return globs.ExpertUser, true
+	}
+	for useLevel, name := range useLevelNames {
+		if name == strings.ToUpper(level) && useLevel != globs.InternalUse {
+			return useLevel, true
+		}
+	}
+	return 0, false
+}
+
+// globsReport returns the settings at or below the given user level, sorted
+// by name, internal settings are left out
+func globsReport(maxLevel globs.UseLevel) []*globSetting {
+	keys := globs.AllKeys()
+	sort.Strings(keys)
+	settings := make([]*globSetting, 0, len(keys))
+	for _, key := range keys {
+		desc, useLevel, scope := globs.Desc(key)
+		if useLevel == globs.InternalUse || useLevel > maxLevel {
+			continue
+		}
+		settings = append(settings, &globSetting{
+			Name:        key,
+			Value:       globs.Get(key),
+			Source:      globSource(key, scope),
+			UseLevel:    useLevelNames[useLevel],
+			Scope:       scopeNames[scope],
+			Description: desc,
+		})
+	}
+	return settings
+}
+
+// showGlobsReport dumps the --globs=src report, in text form as columns
+// with more detail in verbose mode (and less in terse mode)
+func showGlobsReport(maxLevel globs.UseLevel) (string, bool) {
+	settings := globsReport(maxLevel)
+	items := make([]interface{}, 0, len(settings))
+	for _, setting := range settings {
+		items = append(items, setting)
+	}
+	verbosity := lookVerbosity()
+	fields := []string{"name", "value", "source"}
+	if verbosity == "terse" {
+		fields = fields[:2]
+	} else if verbosity == "verbose" {
+		fields = append(fields, "useLevel", "scope", "description")
+	}
+	if !lookIsStructured() {
+		return renderTable(fields, items)
+	}
+	return renderItems("dvlnGlobs", "settings", verbosity, fields, items)
+}
@@ -0,0 +1,178 @@
+// Copyright © 2015 Erik Brady <brady@dvln.org>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package cmds init.go module implements the 'dvln init' subcommand
+// framework for the 'cli' (aka: cobra) package.  Lets start a workspace!!!
+package cmds
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	cli "github.com/dvln/cobra"
+	"github.com/dvln/out"
+	globs "github.com/dvln/viper"
+	"github.com/dvln/wkspc"
+)
+
+var initCmd = &cli.Command{
+	Use:   "init",
+	Short: "create an empty workspace",
+	Long: `Create an empty workspace (no packages yet) in the current or given dir, eg:
+  % dvln init [ --codebase=cb_x ] [ --devline=dl_z ] [ dir ]
+  % dvln init -c cb_x -d dl_z ws_dir
+  % dvln init --force   (allow nesting within, or re-init of, a workspace)
+A devline that says what codebase it's for needs no --codebase.  A re-init
+starts the workspace over, the packages already in it are no longer tracked.
+Use 'dvln get' or 'dvln update' within the workspace to bring in packages`,
+	Run: initWkspc,
+}
+
+// init bootstraps the options used for the init subcommand and descriptions
+// and initial defaults for those options and such.
+func init() {
+	reloadCLIFlags := false
+	setupInitCmdCLIArgs(initCmd, reloadCLIFlags)
+}
+
+// setupInitCmdCLIArgs is used from init() to set up the 'globs' (viper) pkg CLI
+// options available to this subcommand (other options were already set up in
+// the "parent" dvln subcommand in a like-named method). Every subcommand has
+// a like named method "setup<subcmd>CmdCLIArgs()", called in init() above and
+// called from dvln.go
+func setupInitCmdCLIArgs(c *cli.Command, reloadCLIFlags bool) {
+	var desc string
+	if reloadCLIFlags {
+		c.Flags().SetDefValueReparseOK(true)
+	}
+	desc, _, _ = globs.Desc("codebase")
+	c.Flags().StringP("codebase", "c", globs.GetString("codebase"), desc)
+	desc, _, _ = globs.Desc("devline")
+	c.Flags().StringP("devline", "d", globs.GetString("devline"), desc)
+	c.Run = initWkspc
+	// NewCLIOpts: if there were opts for the subcmd set them here and note that
+	// "persistent" opts are set in cmds/dvln.go, only opts specific to the
+	// 'dvln init' subcommand are set here
+	// Note that you'll need to modify cmds/global.go as well otherwise your
+	// globs.Desc() call and globs.GetBool("myopt") will not work.
+	if reloadCLIFlags {
+		c.Flags().SetDefValueReparseOK(false)
+	}
+}
+
+// initWkspc defines the 'dvln init' sub-command (it can't be named init() for
+// obvious reasons), it creates the workspace metadata dir in the given dir
+// (or cwd) and records the codebase and devline for the workspace
+func initWkspc(cmd *cli.Command, args []string) {
+	out.Debugln("Initialization done, firing up initWkspc()")
+	errExit := int(out.ErrorExitVal())
+	dir := "."
+	if len(args) > 1 {
+		out.IssueExit(errExit, out.NewErr("Only one workspace dir can be given, please run 'dvln help init' for usage", 2018))
+		return
+	} else if len(args) == 1 {
+		dir = args[0]
+	}
+	wkspcDir, err := filepath.Abs(dir)
+	if err != nil {
+		out.ErrorExit(errExit, out.WrapErr(err, "Unable to determine the workspace dir", 2006))
+		return
+	}
+
+	// See if we're within an existing workspace, scan from the closest dir
+	// that exists as the workspace dir itself may not be there yet
+	scanDir := wkspcDir
+	for {
+		if _, err = os.Stat(scanDir); err == nil || filepath.Dir(scanDir) == scanDir {
+			break
+		}
+		scanDir = filepath.Dir(scanDir)
+	}
+	existingRoot, err := wkspc.RootDir(scanDir)
+	if err != nil {
+		out.ErrorExit(errExit, out.WrapErr(err, "Unexpected problem scanning for a workspace", 2006))
+		return
+	}
+	if existingRoot != "" {
+		issueMsg := fmt.Sprintf("Workspace %s would be nested within workspace %s", wkspcDir, existingRoot)
+		if existingRoot == wkspcDir {
+			issueMsg = fmt.Sprintf("Workspace %s already exists", wkspcDir)
+		}
+		if err = protectNesting.guard(issueMsg); err != nil {
+			out.IssueExit(errExit, err)
+			return
+		}
+	}
+
+	// Validate the codebase and devline (if given) before creating anything
+	info := &wkspcInfo{Devline: globs.GetString("devline")}
+	codebase := globs.GetString("codebase")
+	if codebase == "" && info.Devline != "" {
+		// devlines can say what codebase they're for (eg: frozen devlines)
+		if codebase, err = devlineCodebase(info.Devline); err != nil {
+			out.ErrorExit(errExit, err)
+			return
+		}
+		if codebase == "" {
+			out.IssueExit(errExit, out.NewErr(fmt.Sprintf("Devline %s doesn't say what codebase it's for, please use --codebase|-c as well", info.Devline), 2008))
+			return
+		}
+	}
+	if codebase != "" {
+		cb, err := loadCodebase(codebase)
+		if err == nil {
+			_, err = resolveDevline(cb, info.Devline)
+		}
+		if err != nil {
+			out.ErrorExit(errExit, err)
+			return
+		}
+		info.Codebase = cb.Name
+	}
+	if err = os.MkdirAll(wkspcDir, 0755); err != nil {
+		out.ErrorExit(errExit, out.WrapErr(err, "Unable to create the workspace dir", 2012))
+		return
+	}
+	if err = createWkspcMetaDir(wkspcDir); err == nil {
+		err = writeWkspcInfo(wkspcDir, info)
+	}
+	if err == nil && existingRoot == wkspcDir {
+		// a (forced) re-init starts over, no packages are recorded yet
+		if err = os.Remove(manifestPath(wkspcDir)); os.IsNotExist(err) {
+			err = nil
+		} else if err != nil {
+			err = out.WrapErr(err, "Unable to clear the workspace manifest", 2022)
+		}
+	}
+	if err != nil {
+		out.ErrorExit(errExit, err)
+		return
+	}
+	if lookIsStructured() {
+		type initStruct struct {
+			WkspcDir string `json:"wkspcDir"`
+			Codebase string `json:"codebase"`
+			Devline  string `json:"devline"`
+		}
+		fields := []string{"wkspcDir", "codebase", "devline"}
+		items := []interface{}{&initStruct{wkspcDir, info.Codebase, info.Devline}}
+		output, fatalProblem := renderItems("dvlnInit", "workspace", lookVerbosity(), fields, items)
+		out.Print(output)
+		if fatalProblem {
+			out.Exit(-1)
+		}
+		return
+	}
+	out.Printf("Initialized workspace %s (codebase: %s, devline: %s)\n", wkspcDir, info.Codebase, info.Devline)
+}
@@ -0,0 +1,95 @@
+// Copyright © 2015 Erik Brady <brady@dvln.org>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmds
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestInitWkspc runs init for a new workspace, over an existing one (with
+// and without --force) and with just a devline that names it's codebase
+func TestInitWkspc(t *testing.T) {
+	os.Setenv("PKG_OUT_NO_EXIT", "1")
+	defer os.Setenv("PKG_OUT_NO_EXIT", "0")
+	root, err := ioutil.TempDir("", "dvlninit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	defs := map[string]string{
+		"cb/cb.json":   `{"name": "cb", "packages": [{"name": "net", "remote": "n"}]}`,
+		"dl/dl.json":   `{"name": "dl", "codebase": "cb", "packages": [{"name": "net", "version": "main"}]}`,
+		"dl/nocb.json": `{"name": "nocb", "packages": []}`,
+	}
+	for file, def := range defs {
+		file = filepath.Join(root, filepath.FromSlash(file))
+		if err = os.MkdirAll(filepath.Dir(file), 0755); err == nil {
+			err = ioutil.WriteFile(file, []byte(def), 0644)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	snap := snapshotGlobs()
+	defer snap.restore()
+	setGlob("codebasedir", filepath.Join(root, "cb"), "test")
+	setGlob("devlinedir", filepath.Join(root, "dl"), "test")
+	setGlob("look", "text", "test")
+
+	ws := filepath.Join(root, "ws")
+	tests := []struct {
+		desc, dir, codebase, devline string
+		force                        bool
+		info                         *wkspcInfo // nil: no workspace created
+	}{
+		{"new workspace", ws, "cb", "", false, &wkspcInfo{Codebase: "cb"}},
+		{"existing workspace", ws, "cb", "dl", false, &wkspcInfo{Codebase: "cb"}},
+		{"forced re-init", ws, "cb", "dl", true, &wkspcInfo{Codebase: "cb", Devline: "dl"}},
+		{"devline only", filepath.Join(root, "ws2"), "", "dl", false, &wkspcInfo{Codebase: "cb", Devline: "dl"}},
+		{"devline without a codebase", filepath.Join(root, "ws3"), "", "nocb", false, nil},
+	}
+	for _, test := range tests {
+		if test.desc == "existing workspace" {
+			m := &wkspcManifest{}
+			m.setPkg(&resolvedPkg{Name: "net", Path: "net", VCS: "git", Remote: "n"}, "abc123")
+			if err = writeManifest(ws, m); err != nil {
+				t.Fatal(err)
+			}
+		}
+		setGlob("codebase", test.codebase, "test")
+		setGlob("devline", test.devline, "test")
+		setGlob("force", test.force, "test")
+		initWkspc(initCmd, []string{test.dir})
+
+		if test.info == nil {
+			if _, err = os.Stat(test.dir); !os.IsNotExist(err) {
+				t.Errorf("%s: workspace dir was created", test.desc)
+			}
+			continue
+		}
+		info, err := readWkspcInfo(test.dir)
+		if err != nil || *info != *test.info {
+			t.Errorf("%s: workspace info %+v (err: %v), want %+v", test.desc, info, err, test.info)
+		}
+		_, err = os.Stat(manifestPath(test.dir))
+		if test.desc == "existing workspace" && err != nil {
+			t.Errorf("%s: manifest removed without --force: %v", test.desc, err)
+		} else if test.desc == "forced re-init" && !os.IsNotExist(err) {
+			t.Errorf("%s: old manifest left in place: %v", test.desc, err)
+		}
+	}
+}
@@ -0,0 +1,256 @@
+// Copyright © 2015 Erik Brady <brady@dvln.org>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package cmds issuecodes.go module is the registry of the issue codes dvln
+// uses with it's notes, issues and errors (eg: out.NewErr(msg, 2016)), each
+// code has a severity, a short description and a hint on what to do about
+// it.  When adding a new code to a subcommand add it here as well, the
+// registry is shown via 'dvln help codes' (or 'dvln codes') and the code
+// details are added to JSON error output so clients can react to them.
+package cmds
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	cli "github.com/dvln/cobra"
+	"github.com/dvln/out"
+	globs "github.com/dvln/viper"
+)
+
+// Issue code severities
+const (
+	sevNote  = "note"  // informational
+	sevIssue = "issue" // a usage or setup problem the user can fix
+	sevError = "error" // an operation failed
+)
+
+// issueCode describes a dvln issue code
+type issueCode struct {
+	Code     int    `json:"code"`
+	Severity string `json:"severity"`
+	Desc     string `json:"description"`
+	Hint     string `json:"hint"`
+}
+
+// issueCodes is the registry of dvln issue codes
+var issueCodes = map[int]*issueCode{
+	101:  {101, sevNote, "temporary logfile in use", "set cfgfile:logfile to log to a file of your choosing"},
+	2000: {2000, sevIssue, "command line processing problem", "run 'dvln help <subcmd>' for usage"},
+	2001: {2001, sevIssue, "no subcommand given", "run 'dvln help' for the list of subcommands"},
+	2002: {2002, sevIssue, "user config file could not be read", "check the syntax of the ~/.dvlncfg/cfg.* file (or env:DVLN_CONFIG)"},
+	2003: {2003, sevIssue, "bad --jobs value", "use a number or 'all'"},
+	2004: {2004, sevIssue, "bad --look value", "use one of the supported output formats, see 'dvln help'"},
+	2005: {2005, sevIssue, "bad --globs value", "use 'env' or 'cfg' (settings available) or 'src[:<level>]' (where settings came from)"},
+	2006: {2006, sevError, "workspace scan failed", "check the permissions of the current dir (and it's parents)"},
+	2007: {2007, sevError, "workspace root dir setup failed", "check the permissions of the workspace dir"},
+	2008: {2008, sevIssue, "no codebase given", "use --codebase|-c or set cfgfile:codebase|env:DVLN_CODEBASE"},
+	2009: {2009, sevIssue, "codebase definition could not be read or parsed", "check the codebase name/URL and the file syntax at the line given"},
+	2010: {2010, sevIssue, "devline definition could not be read or parsed", "check the devline name/URL and the file syntax at the line given"},
+	2011: {2011, sevIssue, "devline package not in the codebase", "fix the devline or use the codebase the devline is for"},
+	2012: {2012, sevError, "workspace metadata problem", "check the workspace .dvln dir, re-run 'dvln init --force' if it's damaged"},
+	2013: {2013, sevError, "VCS clone, fetch, checkout or stash failed", "check the remote is reachable and the VCS error given"},
+	2014: {2014, sevError, "--fatalon limit of failures reached", "fix the failures listed, or raise --fatalon (0: never stop)"},
+	2015: {2015, sevError, "VCS query failed", "check the package dir is a valid clone and the VCS error given"},
+	2016: {2016, sevIssue, "no workspace found", "cd into a workspace or create one with 'dvln get' or 'dvln init'"},
+	2017: {2017, sevError, "package removal failed", "check the permissions of the package dir"},
+	2018: {2018, sevIssue, "wrong number of arguments", "run 'dvln help <subcmd>' for usage"},
+	2019: {2019, sevIssue, "workspace would be nested or already exists", "pick another dir or use --force"},
+	2020: {2020, sevError, "REST server failed", "check the --port is free and --servehost is an address of this host"},
+	2021: {2021, sevIssue, "bad REST request", "check the method and query parameters against the endpoint"},
+	2022: {2022, sevError, "workspace manifest could not be read or written", "check the workspace .dvln/manifest.json file"},
+	2023: {2023, sevError, "devline could not be written", "check the devline dir permissions and the packages that failed"},
+	2024: {2024, sevNote, "frozen package has local work not captured", "commit and push the work, then freeze again"},
+	2025: {2025, sevError, "foreach command failed in a package", "see the command output for the package"},
+	2026: {2026, sevIssue, "bad package selector", "check the --pkg names, groups and globs against the codebase"},
+	2027: {2027, sevIssue, "codebase definition is invalid", "fix the problems at the lines given"},
+	2028: {2028, sevIssue, "definition file format is newer than this dvln", "upgrade dvln"},
+	2029: {2029, sevIssue, "devline definition or inheritance is invalid", "fix the problems given (eg: parent loops)"},
+	2030: {2030, sevError, "devline rule could not be resolved", "check the rule's tag glob matches a tag of each selected package"},
+	2031: {2031, sevIssue, "package has local changes", "commit, stash or revert them, or use --interact|-i or --force"},
+	2032: {2032, sevIssue, "aborted by the user", "re-run when ready"},
+	2033: {2033, sevIssue, "package has unpushed revisions", "push them, or use --interact|-i or --force"},
+	2034: {2034, sevIssue, "packages have unpushed local branches", "push or remove the branches, or use --force"},
+	2035: {2035, sevIssue, "devline already exists", "pick another name or use --force to overwrite it"},
+	2036: {2036, sevError, "workspace config file could not be read or is invalid", "fix the settings listed in the workspace .dvln/cfg.* file, see 'dvln --globs=src'"},
+	2037: {2037, sevError, "dvln is older than the version required", "upgrade dvln, the dvlnminver setting (see 'dvln --globs=src') says what is required"},
+	2038: {2038, sevIssue, "setting unknown or not settable in a config file", "see 'dvln --globs=cfg' for the settings a config file can have"},
+	2039: {2039, sevError, "config file could not be written", "check the config file (and it's dir) permissions"},
+	2040: {2040, sevIssue, "setting not in the config file", "see 'dvln config list' for the settings in the config files"},
+	2041: {2041, sevIssue, "package path can't be used in a workspace", "use a path relative to the workspace root, without \"..\" and outside of the .dvln dir"},
+	2042: {2042, sevError, "operation failed in one or more packages", "see the failures listed for each package, fix them and re-run"},
+	2043: {2043, sevIssue, "unknown issue code", "run 'dvln help codes' for the issue codes dvln uses"},
+	2044: {2044, sevIssue, "bad --fatalon value", "use the number of failures to stop at (0: never stop)"},
+}
+
+// lookupIssueCode returns the registry entry for a code, nil if unknown
+func lookupIssueCode(code int) *issueCode {
+	return issueCodes[code]
+}
+
+// sortedIssueCodes returns the registered issue codes, sorted by code
+func sortedIssueCodes() []*issueCode {
+	codes := make([]*issueCode, 0, len(issueCodes))
+	for _, ic := range issueCodes {
+		codes = append(codes, ic)
+	}
+	sort.Slice(codes, func(i, j int) bool { return codes[i].Code < codes[j].Code })
+	return codes
+}
+
+// issueCodesHelp returns the issue code registry in text form
+func issueCodesHelp(codes []*issueCode) string {
+	lines := make([]string, 0, len(codes))
+	for _, ic := range codes {
+		lines = append(lines, fmt.Sprintf("  %4d %-5s %s\n       hint: %s", ic.Code, ic.Severity, ic.Desc, ic.Hint))
+	}
+	return strings.Join(lines, "\n")
+}
+
+var codesCmd = &cli.Command{
+	Use:   "codes",
+	Short: "list the issue codes dvln uses",
+	Long: `List the issue codes dvln uses (all, or those given) with the severity,
+description and a hint on what to do about each, eg:
+  % dvln help codes
+  % dvln codes 2016 2031
+  % dvln codes --look=json`,
+	Run: codes,
+}
+
+// init bootstraps the options used for the codes subcommand and adds the
+// code registry to the subcommand help (so 'dvln help codes' lists them)
+func init() {
+	reloadCLIFlags := false
+	codesCmd.Long += "\n\nIssue codes:\n" + issueCodesHelp(sortedIssueCodes())
+	setupCodesCmdCLIArgs(codesCmd, reloadCLIFlags)
+}
+
+// setupCodesCmdCLIArgs is used from init() to set up the 'globs' (viper) pkg
+// CLI options available to this subcommand (other options were already set up
+// in the "parent" dvln subcommand in a like-named method). Every subcommand
+// has a like named method "setup<subcmd>CmdCLIArgs()", called in init() above
+// and called from dvln.go
+func setupCodesCmdCLIArgs(c *cli.Command, reloadCLIFlags bool) {
+	if reloadCLIFlags {
+		c.Flags().SetDefValueReparseOK(true)
+	}
+	c.Run = codes
+	// NewCLIOpts: if there were opts for the subcmd set them here and note that
+	// "persistent" opts are set in cmds/dvln.go, only opts specific to the
+	// 'dvln codes' subcommand are set here
+	// Note that you'll need to modify cmds/global.go as well otherwise your
+	// globs.Desc() call and globs.GetBool("myopt") will not work.
+	if reloadCLIFlags {
+		c.Flags().SetDefValueReparseOK(false)
+	}
+}
+
+// codes defines the 'dvln codes' sub-command, it shows the registered issue
+// codes (or just the codes given) in text or JSON form
+func codes(cmd *cli.Command, args []string) {
+	out.Debugln("Initialization done, firing up codes()")
+	errExit := int(out.ErrorExitVal())
+	list := sortedIssueCodes()
+	if len(args) != 0 {
+		list = list[:0]
+		for _, arg := range args {
+			code, err := strconv.Atoi(arg)
+			if err != nil || lookupIssueCode(code) == nil {
+				out.IssueExit(errExit, out.NewErr(fmt.Sprintf("Unknown issue code: %s, run 'dvln help codes' for the list", arg), 2043))
+				return
+			}
+			list = append(list, lookupIssueCode(code))
+		}
+	}
+	if !lookIsStructured() {
+		out.Println(issueCodesHelp(list))
+		return
+	}
+	items := make([]interface{}, 0, len(list))
+	for _, ic := range list {
+		items = append(items, ic)
+	}
+	fields := []string{"code", "severity", "description", "hint"}
+	output, fatalProblem := renderItems("dvlnCodes", "codes", lookVerbosity(), fields, items)
+	out.Print(output)
+	if fatalProblem {
+		out.Exit(-1)
+	}
+}
+
+// addIssueCodeJSON adds the registry details (severity, description and
+// hint) of the given code to a JSON error response, as "issue" within the
+// "error" object (or at the top level if no such object), if the response
+// can't be handled it's returned as is.  Any --jsonprefix is set aside while
+// the response is updated and then put back (see stripJSONPrefix()).
+func addIssueCodeJSON(jsonMsg string, code int) string {
+	ic := lookupIssueCode(code)
+	body, addPrefix, ok := stripJSONPrefix(jsonMsg, globs.GetString("jsonprefix"))
+	trimmed := strings.TrimSpace(body)
+	if ic == nil || !ok || !strings.HasPrefix(trimmed, "{") {
+		return jsonMsg
+	}
+	var resp map[string]interface{}
+	if err := json.Unmarshal([]byte(trimmed), &resp); err != nil {
+		return jsonMsg
+	}
+	if errObj, ok := resp["error"].(map[string]interface{}); ok {
+		errObj["issue"] = ic
+	} else {
+		resp["issue"] = ic
+	}
+	var data []byte
+	var err error
+	if indent := globs.GetInt("jsonindentlevel"); indent > 0 && !globs.GetBool("jsonraw") {
+		data, err = json.MarshalIndent(resp, "", strings.Repeat(" ", indent))
+	} else {
+		data, err = json.Marshal(resp)
+	}
+	if err != nil {
+		return jsonMsg
+	}
+	return addPrefix(string(data)) + jsonMsg[len(strings.TrimRight(jsonMsg, " \t\n")):]
+}
+
+// stripJSONPrefix removes the given JSON prefix from a JSON response, the
+// prefix is either at the start of every line of the response or just at the
+// start of it.  Returned is the response without the prefix, a func that
+// adds the prefix back (the same way) to a response, and false if the
+// response doesn't have the prefix.
+func stripJSONPrefix(jsonMsg string, prefix string) (string, func(string) string, bool) {
+	if prefix == "" {
+		return jsonMsg, func(msg string) string { return msg }, true
+	}
+	lines := strings.Split(strings.TrimRight(jsonMsg, " \t\n"), "\n")
+	everyLine := len(lines) > 1
+	for i, line := range lines {
+		if !strings.HasPrefix(line, prefix) {
+			everyLine = false
+			break
+		}
+		lines[i] = strings.TrimPrefix(line, prefix)
+	}
+	if everyLine {
+		return strings.Join(lines, "\n"), func(msg string) string {
+			return prefix + strings.Replace(msg, "\n", "\n"+prefix, -1)
+		}, true
+	}
+	if !strings.HasPrefix(jsonMsg, prefix) {
+		return jsonMsg, nil, false
+	}
+	return strings.TrimPrefix(jsonMsg, prefix), func(msg string) string { return prefix + msg }, true
+}
@@ -0,0 +1,152 @@
+// Copyright © 2015 Erik Brady <brady@dvln.org>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmds
+
+import (
+	"encoding/json"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestAddIssueCodeJSON(t *testing.T) {
+	snap := snapshotGlobs()
+	defer snap.restore()
+	setGlob("jsonindentlevel", 0, "test")
+	resp := `{"apiVersion": "0.1", "error": {"code": 2031, "message": "nope"}}`
+	tests := []struct {
+		prefix string
+		msg    string
+	}{
+		{"", resp + "\n"},
+		{")]}',", ")]}'," + resp + "\n"},
+		{"// ", "// {\n//   \"apiVersion\": \"0.1\",\n//   \"error\": {\"code\": 2031, \"message\": \"nope\"}\n// }\n"},
+	}
+	for _, test := range tests {
+		setGlob("jsonprefix", test.prefix, "test")
+		got := addIssueCodeJSON(test.msg, 2031)
+		if !strings.HasSuffix(got, "}\n") {
+			t.Errorf("prefix %q: trailing newline lost: %q", test.prefix, got)
+		}
+		body, _, ok := stripJSONPrefix(got, test.prefix)
+		if !ok {
+			t.Errorf("prefix %q: prefix lost: %q", test.prefix, got)
+			continue
+		}
+		if test.prefix == "// " && strings.Count(got, "// ") != strings.Count(got, "\n") {
+			t.Errorf("prefix %q: not on every line: %q", test.prefix, got)
+		}
+		var r struct {
+			Error struct {
+				Code  int                    `json:"code"`
+				Issue map[string]interface{} `json:"issue"`
+			} `json:"error"`
+		}
+		if err := json.Unmarshal([]byte(body), &r); err != nil {
+			t.Errorf("prefix %q: bad JSON %q: %s", test.prefix, got, err)
+			continue
+		}
+		if r.Error.Code != 2031 || r.Error.Issue == nil {
+			t.Errorf("prefix %q: issue details not added: %q", test.prefix, got)
+		}
+	}
+	// responses without the prefix, or unknown codes, are left alone
+	setGlob("jsonprefix", ")]}',", "test")
+	if got := addIssueCodeJSON(resp, 2031); got != resp {
+		t.Errorf("response without the prefix changed: %q", got)
+	}
+	setGlob("jsonprefix", "", "test")
+	if got := addIssueCodeJSON(resp, 1); got != resp {
+		t.Errorf("response with an unknown code changed: %q", got)
+	}
+}
+
+// issueCodeArgs are the funcs (and methods) taking an issue code along with
+// the position of the code in their args (-1: the last arg)
+var issueCodeArgs = map[string]int{
+	"out.NewErr":  -1,
+	"out.WrapErr": -1,
+	"api.NewMsg":  1,
+	"failed":      0,
+	"restError":   -1,
+}
+
+// TestIssueCodesRegistered scans the cmds source for the issue codes passed
+// to the funcs above (and used for protections) and makes sure each is in
+// the registry, so the hints and 'dvln issue' know about them
+func TestIssueCodesRegistered(t *testing.T) {
+	files, err := filepath.Glob("*.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fset := token.NewFileSet()
+	found := 0
+	checkCode := func(expr ast.Expr) {
+		lit, ok := expr.(*ast.BasicLit)
+		if !ok || lit.Kind != token.INT {
+			return
+		}
+		found++
+		code, _ := strconv.Atoi(lit.Value)
+		if lookupIssueCode(code) == nil {
+			t.Errorf("%s: issue code %d is not in the registry", fset.Position(lit.Pos()), code)
+		}
+	}
+	for _, file := range files {
+		if strings.HasSuffix(file, "_test.go") {
+			continue
+		}
+		f, err := parser.ParseFile(fset, file, nil, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ast.Inspect(f, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.CallExpr:
+				var name string
+				switch fun := n.Fun.(type) {
+				case *ast.Ident:
+					name = fun.Name
+				case *ast.SelectorExpr:
+					name = fun.Sel.Name
+					if pkg, ok := fun.X.(*ast.Ident); ok && (pkg.Name == "out" || pkg.Name == "api") {
+						name = pkg.Name + "." + name
+					}
+				}
+				idx, ok := issueCodeArgs[name]
+				if !ok || len(n.Args) == 0 {
+					break
+				}
+				if idx < 0 {
+					idx = len(n.Args) - 1
+				}
+				if idx < len(n.Args) {
+					checkCode(n.Args[idx])
+				}
+			case *ast.CompositeLit:
+				if typ, ok := n.Type.(*ast.Ident); ok && typ.Name == "protection" && len(n.Elts) != 0 {
+					checkCode(n.Elts[0])
+				}
+			}
+			return true
+		})
+	}
+	if found == 0 {
+		t.Errorf("No issue codes found in the cmds source")
+	}
+}
@@ -0,0 +1,378 @@
+// Copyright © 2015 Erik Brady <brady@dvln.org>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package cmds jobs.go module runs per-package work (clones, updates, etc)
+// across a bounded pool of parallel jobs, the size of the pool is driven by
+// the --jobs|-J option (or cfgfile:jobs|env:DVLN_JOBS) and the number of
+// failures tolerated by the --fatalon|-F option (cfgfile:fatalon|..).
+package cmds
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/dvln/cast"
+	"github.com/dvln/out"
+	globs "github.com/dvln/viper"
+)
+
+// pkgResult is the outcome of running a job on a single package.  Jobs run in
+// parallel so they must not print anything, instead any detail they want to
+// show the user goes into Msgs and is dumped (in package order) afterwards.
+type pkgResult struct {
+	Name     string   // package name
+	Action   string   // what was done, eg: "got", "skipped"
+	Msgs     []string // detail for verbose output
+	Output   []string // output of commands run on the package (if any)
+	Revision string   // revision checked out (if known)
+	Code     int      // issue code if the job failed
+	Err      error    // non-nil if the job failed
+}
+
+// failed marks the result as a failure with the given issue code and error
+func (r *pkgResult) failed(code int, err error) *pkgResult {
+	r.Code = code
+	r.Err = err
+	return r
+}
+
+// pkgResultItem is the --look=json form of a pkgResult
+type pkgResultItem struct {
+	Name    string   `json:"name"`
+	Action  string   `json:"action"`
+	Output  []string `json:"output,omitempty"`
+	ErrCode int      `json:"errCode,omitempty"`
+	ErrMsg  string   `json:"errMsg,omitempty"`
+	ErrHint string   `json:"errHint,omitempty"` // from the issue code registry
+}
+
+// pkgJobFunc is the work to be done on a single package by a job, if the
+// context is cancelled the job should give up as soon as it can
+type pkgJobFunc func(ctx context.Context, p *resolvedPkg) *pkgResult
+
+// indexedResult lets a job tell us which package a result belongs to, the
+// job waits for handled to be closed before starting on another package so
+// it won't start one after the result used up the error budget
+type indexedResult struct {
+	idx     int
+	res     *pkgResult
+	handled chan struct{}
+}
+
+// numJobs returns how many packages should be worked on in parallel, the
+// jobs setting has already been validated in dvlnFinalPrep()
+func numJobs() int {
+	n := runtime.NumCPU()
+	if jobs := globs.GetString("jobs"); jobs != "" && jobs != "all" {
+		n = cast.ToInt(jobs)
+	}
+	if n < 1 {
+		n = 1
+	}
+	return n
+}
+
+// fatalOn returns the number of failed packages (VCS errors) it takes to
+// stop a multi-package operation, 0 means never stop
+func fatalOn() int {
+	n := globs.GetInt("fatalon")
+	if n < 0 {
+		n = 0
+	}
+	return n
+}
+
+// runPkgJobs runs the given job func on each package using up to numJobs()
+// packages at a time.  As results come in they are handed to the report func
+// in package order (not completion order) so output is deterministic (with
+// --look=ndjson start/finish/fail events are emitted as jobs start and end).
+// Once the number of failed jobs reaches the fatalOn() error budget no new jobs
+// are started and jobs already running are cancelled, packages that never
+// ran get a "not run" result and those that failed due to being cancelled
+// (ie: their error is context.Canceled) a "cancelled" result, any other
+// failure is still a failure even if it came in after the budget was hit.
+// Results are returned in package order along with a flag indicating if the
+// error budget was reached.
+func runPkgJobs(pkgs []*resolvedPkg, job pkgJobFunc, report func(*pkgResult)) ([]*pkgResult, bool) {
+	return runPkgJobPool(pkgs, job, report, true)
+}
+
+// runQuietPkgJobs is runPkgJobs() for work done on the way to the real work
+// (eg: checking which packages are modified for the package selector) where
+// no --look=ndjson events should be emitted, just the results returned
+func runQuietPkgJobs(pkgs []*resolvedPkg, job pkgJobFunc) ([]*pkgResult, bool) {
+	return runPkgJobPool(pkgs, job, func(*pkgResult) {}, false)
+}
+
+// runPkgJobPool does the work for runPkgJobs() and runQuietPkgJobs(), the
+// events flag indicates if --look=ndjson events should be emitted
+func runPkgJobPool(pkgs []*resolvedPkg, job pkgJobFunc, report func(*pkgResult), events bool) ([]*pkgResult, bool) {
+	results := make([]*pkgResult, len(pkgs))
+	idxCh := make(chan int)
+	resCh := make(chan indexedResult)
+	stop := make(chan struct{})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Feed package indexes to the jobs until done or told to stop
+	go func() {
+		defer close(idxCh)
+		for i := range pkgs {
+			select {
+			case idxCh <- i:
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	jobCnt := numJobs()
+	if jobCnt > len(pkgs) {
+		jobCnt = len(pkgs)
+	}
+	budget := fatalOn()
+	out.Debugf("Running %d package jobs, %d at a time, stopping at %d failures\n", len(pkgs), jobCnt, budget)
+	var wg sync.WaitGroup
+	for j := 0; j < jobCnt; j++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range idxCh {
+				if ctx.Err() != nil {
+					continue
+				}
+				jobCtx := ctx
+				if events {
+					emitEvent(&lookEvent{Event: "start", Pkg: pkgs[i].Name})
+					jobCtx = pkgJobContext(ctx, pkgs[i].Name) // for progress events
+				}
+				r := indexedResult{i, job(jobCtx, pkgs[i]), make(chan struct{})}
+				resCh <- r
+				<-r.handled
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(resCh)
+	}()
+
+	next := 0
+	failures := 0
+	budgetHit := false
+	for r := range resCh {
+		if r.res.Err != nil {
+			if budgetHit && errors.Is(r.res.Err, context.Canceled) {
+				// we pulled the plug on it, it didn't fail on it's own
+				r.res.Action = "cancelled"
+				r.res.Code = 0
+				r.res.Err = nil
+			} else {
+				failures++
+			}
+		}
+		results[r.idx] = r.res
+		if events {
+			emitPkgResult(r.res)
+		}
+		if budget != 0 && failures >= budget && !budgetHit {
+			budgetHit = true
+			close(stop)
+			cancel()
+		}
+		close(r.handled)
+		for next < len(results) && results[next] != nil {
+			report(results[next])
+			next++
+		}
+	}
+	for ; next < len(results); next++ {
+		if results[next] == nil {
+			results[next] = &pkgResult{Name: pkgs[next].Name, Action: "not run"}
+			if events {
+				emitPkgResult(results[next])
+			}
+		}
+		report(results[next])
+	}
+	return results, budgetHit
+}
+
+// emitPkgResult emits the finish (or fail) event for a package result
+func emitPkgResult(r *pkgResult) {
+	ev := &lookEvent{Event: "finish", Pkg: r.Name, Action: r.Action, Output: r.Output}
+	if r.Err != nil {
+		ev.Event = "fail"
+		ev.Action = "failed"
+		ev.ErrCode = r.Code
+		ev.Msg = r.Err.Error()
+	}
+	emitEvent(ev)
+}
+
+// reportPkgResult is the standard way to show a single package result, the
+// detail only shows up in verbose mode while failures are always shown
+func reportPkgResult(r *pkgResult) {
+	if lookIsStructured() {
+		return // all results are dumped together, see finishPkgJobs()
+	}
+	if r.Err != nil {
+		out.Issueln(r.Err)
+		return
+	}
+	out.Verbosef("Package %s: %s\n", r.Name, r.Action)
+	for _, msg := range r.Msgs {
+		out.Verbosef("  %s\n", msg)
+	}
+}
+
+// countPkgResults returns a one line summary of the given results, eg:
+// "10 got, 2 skipped, 1 failed (13 packages)", along with the list of
+// failed packages and their issue codes (if any failed)
+func countPkgResults(results []*pkgResult) (string, []string) {
+	var actions []string
+	var failures []string
+	counts := make(map[string]int)
+	for _, r := range results {
+		action := r.Action
+		if r.Err != nil {
+			action = "failed"
+			failures = append(failures, fmt.Sprintf("%s (issue #%d)", r.Name, r.Code))
+		}
+		if _, ok := counts[action]; !ok {
+			actions = append(actions, action)
+		}
+		counts[action]++
+	}
+	summary := make([]string, 0, len(actions))
+	for _, action := range actions {
+		summary = append(summary, fmt.Sprintf("%d %s", counts[action], action))
+	}
+	if len(summary) == 0 {
+		summary = append(summary, "nothing done")
+	}
+	return fmt.Sprintf("%s (%d packages)", strings.Join(summary, ", "), len(results)), failures
+}
+
+// summarizePkgResults prints a one line summary of the given results, eg:
+// "Summary: 10 got, 2 skipped, 1 failed (13 packages)", followed by the
+// list of failed packages and their issue codes (if any failed)
+func summarizePkgResults(results []*pkgResult) {
+	summary, failures := countPkgResults(results)
+	out.Printf("Summary: %s\n", summary)
+	if len(failures) != 0 {
+		out.Printf("Failed: %s\n", strings.Join(failures, ", "))
+	}
+}
+
+// pkgResultsErr returns nil if none of the given results failed, otherwise
+// an error saying how many failed with the issue code from pkgResultsCode()
+func pkgResultsErr(results []*pkgResult, budgetHit bool) error {
+	code := pkgResultsCode(results, budgetHit)
+	switch {
+	case code == 0:
+		return nil
+	case budgetHit:
+		return out.NewErr(fmt.Sprintf("Reached the --fatalon limit of %d VCS error(s), stopped", fatalOn()), code)
+	}
+	failed := 0
+	for _, r := range results {
+		if r.Err != nil {
+			failed++
+		}
+	}
+	return out.NewErr(fmt.Sprintf("Failed in %d of %d packages", failed, len(results)), code)
+}
+
+// pkgResultsCode returns the issue code for the given results, 0 if none of
+// them failed.  If the fatalon error budget was reached that's the issue
+// (2014), else if all the failures have the same issue code that's used (eg:
+// 2025 if a foreach command failed) otherwise it's 2042.
+func pkgResultsCode(results []*pkgResult, budgetHit bool) int {
+	if budgetHit {
+		return 2014
+	}
+	code := 0
+	for _, r := range results {
+		if r.Err == nil {
+			continue
+		}
+		if code != 0 && code != r.Code || lookupIssueCode(r.Code) == nil {
+			return 2042
+		}
+		code = r.Code
+	}
+	return code
+}
+
+// finishPkgJobs wraps up a multi-package operation by dumping the results, a
+// text summary or, with a structured --look (json, yaml, table), all package
+// results in one response (with --look=ndjson the results were streamed so
+// just a summary event is sent).
+// If any package failed (or the fatalon error budget was reached) we exit
+// non-zero.  Returns the exit value (0 if all is well), callers should
+// return if it's non-zero.
+// - apiContext: the JSON API context for the operation, eg: "dvlnGet"
+func finishPkgJobs(apiContext string, results []*pkgResult, budgetHit bool) int {
+	errExit := int(out.ErrorExitVal())
+	failErr := pkgResultsErr(results, budgetHit)
+	if !lookIsStructured() {
+		summarizePkgResults(results)
+		if failErr != nil {
+			out.ErrorExit(errExit, failErr)
+			return errExit
+		}
+		return 0
+	}
+	if lookIsNDJSON() {
+		summary, failures := countPkgResults(results)
+		ev := &lookEvent{Event: "summary", Context: apiContext, Msg: summary, Data: failures, ErrCode: pkgResultsCode(results, budgetHit)}
+		emitEvent(ev)
+		if failErr != nil {
+			out.Exit(errExit)
+			return errExit
+		}
+		return 0
+	}
+	fields := []string{"name", "action", "errCode", "errMsg", "errHint"}
+	for _, r := range results {
+		if len(r.Output) != 0 {
+			fields = []string{"name", "action", "output", "errCode", "errMsg", "errHint"}
+			break
+		}
+	}
+	items := make([]interface{}, 0, len(results))
+	for _, r := range results {
+		item := &pkgResultItem{Name: r.Name, Action: r.Action, Output: r.Output}
+		if r.Err != nil {
+			item.Action = "failed"
+			item.ErrCode = r.Code
+			item.ErrMsg = r.Err.Error()
+			if ic := lookupIssueCode(r.Code); ic != nil {
+				item.ErrHint = ic.Hint
+			}
+		}
+		items = append(items, item)
+	}
+	output, fatalProblem := renderItems(apiContext, "packages", lookVerbosity(), fields, items)
+	out.Print(output)
+	if fatalProblem || failErr != nil {
+		out.Exit(errExit)
+		return errExit
+	}
+	return 0
+}
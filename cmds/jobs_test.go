@@ -0,0 +1,153 @@
+// Copyright © 2015 Erik Brady <brady@dvln.org>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmds
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+// captureEvents sets --look=ndjson and collects the events emitted until
+// the returned done func is called, which returns them
+func captureEvents(t *testing.T) func() []*lookEvent {
+	snap := snapshotGlobs()
+	setGlob("look", "ndjson", "test")
+	var lines []string
+	saved := eventOut
+	eventOut = func(line string) { lines = append(lines, line) }
+	return func() []*lookEvent {
+		eventOut = saved
+		snap.restore()
+		var events []*lookEvent
+		for _, line := range lines {
+			if !strings.HasSuffix(line, "\n") || strings.Count(line, "\n") != 1 {
+				t.Errorf("event not a single line: %q", line)
+			}
+			ev := &lookEvent{}
+			if err := json.Unmarshal([]byte(line), ev); err != nil {
+				t.Errorf("event not JSON: %q: %s", line, err)
+				continue
+			}
+			if ev.Time == "" {
+				t.Errorf("event has no time: %q", line)
+			}
+			events = append(events, ev)
+		}
+		return events
+	}
+}
+
+// eventsString describes events, eg: "start:a progress:a:git fetch"
+func eventsString(events []*lookEvent) string {
+	var descs []string
+	for _, ev := range events {
+		desc := ev.Event
+		for _, field := range []string{ev.Pkg, ev.Action, ev.Msg} {
+			if field != "" {
+				desc += ":" + field
+			}
+		}
+		if ev.ErrCode != 0 {
+			desc += fmt.Sprintf(":#%d", ev.ErrCode)
+		}
+		descs = append(descs, desc)
+	}
+	return strings.Join(descs, " ")
+}
+
+func TestPkgJobEvents(t *testing.T) {
+	os.Setenv("PKG_OUT_NO_EXIT", "1")
+	defer os.Setenv("PKG_OUT_NO_EXIT", "0")
+	pkgs := []*resolvedPkg{{Name: "a"}, {Name: "b"}, {Name: "c"}}
+	job := func(ctx context.Context, p *resolvedPkg) *pkgResult {
+		r := &pkgResult{Name: p.Name, Action: "got"}
+		jobProgress(ctx, "working on %s", p.Name)
+		if p.Name == "b" {
+			return r.failed(2013, errors.New("b broke"))
+		}
+		return r
+	}
+	tests := []struct {
+		fatalon string
+		events  string
+	}{
+		{"0", "start:a progress:a:working on a finish:a:got " +
+			"start:b progress:b:working on b fail:b:failed:b broke:#2013 " +
+			"start:c progress:c:working on c finish:c:got " +
+			"summary:2 got, 1 failed (3 packages):#2013"},
+		{"1", "start:a progress:a:working on a finish:a:got " +
+			"start:b progress:b:working on b fail:b:failed:b broke:#2013 " +
+			"finish:c:not run " +
+			"summary:1 got, 1 failed, 1 not run (3 packages):#2014"},
+	}
+	for _, test := range tests {
+		done := captureEvents(t)
+		setGlob("jobs", "1", "test") // one at a time so the order is known
+		setGlob("fatalon", test.fatalon, "test")
+		var reported []string
+		results, budgetHit := runPkgJobs(pkgs, job, func(r *pkgResult) { reported = append(reported, r.Name) })
+		finishPkgJobs("dvlnTest", results, budgetHit)
+		events := done()
+		if got := eventsString(events); got != test.events {
+			t.Errorf("fatalon %s events:\n  %s\nwant:\n  %s", test.fatalon, got, test.events)
+		}
+		if strings.Join(reported, ",") != "a,b,c" {
+			t.Errorf("fatalon %s results reported as %v", test.fatalon, reported)
+		}
+		if last := events[len(events)-1]; last.Context != "dvlnTest" || last.ErrHint == "" {
+			t.Errorf("fatalon %s summary event context %q hint %q", test.fatalon, last.Context, last.ErrHint)
+		}
+	}
+	// no failures, the summary has no issue code
+	done := captureEvents(t)
+	results, budgetHit := runPkgJobs(pkgs[:1], job, func(*pkgResult) {})
+	finishPkgJobs("dvlnTest", results, budgetHit)
+	if got := eventsString(done()); !strings.HasSuffix(got, "summary:1 got (1 packages)") {
+		t.Errorf("events without failures: %s", got)
+	}
+	// quiet jobs (eg: the package selector) emit no events
+	done = captureEvents(t)
+	runQuietPkgJobs(pkgs, job)
+	if events := done(); len(events) != 0 {
+		t.Errorf("quiet package jobs emitted events: %s", eventsString(events))
+	}
+}
+
+func TestPkgResultsCode(t *testing.T) {
+	broke := errors.New("broke")
+	tests := []struct {
+		results   []*pkgResult
+		budgetHit bool
+		code      int
+	}{
+		{[]*pkgResult{{Name: "a"}}, false, 0},
+		{[]*pkgResult{{Name: "a"}, {Name: "b", Code: 2025, Err: broke}}, false, 2025},
+		{[]*pkgResult{{Name: "a", Code: 2025, Err: broke}, {Name: "b", Code: 2025, Err: broke}}, false, 2025},
+		{[]*pkgResult{{Name: "a", Code: 2025, Err: broke}, {Name: "b", Code: 2013, Err: broke}}, false, 2042},
+		{[]*pkgResult{{Name: "a", Err: broke}}, false, 2042},
+		{[]*pkgResult{{Name: "a", Code: 2013, Err: broke}}, true, 2014},
+	}
+	for i, test := range tests {
+		code := pkgResultsCode(test.results, test.budgetHit)
+		err := pkgResultsErr(test.results, test.budgetHit)
+		if code != test.code || (err == nil) != (code == 0) {
+			t.Errorf("Results %d: got code %d (error: %v), want %d", i, code, err, test.code)
+		}
+	}
+}
@@ -0,0 +1,293 @@
+// Copyright © 2015 Erik Brady <brady@dvln.org>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package cmds look.go module handles the structured output "looks" that
+// can be selected via --look|-l (or cfgfile:look|env:DVLN_LOOK).  Subcommands
+// hand the items they report to renderItems() which renders them per look:
+// - json: a single JSON response (the 'api' pkg envelope) at the end of a run
+// - yaml: the same response in YAML form
+// - table: columnar text, one row per item with a header of field names
+// - ndjson: one JSON event per line as the run progresses (so a CI system or
+// IDE can show live progress on long multi-package get|update runs), eg:
+//
+//	{"event":"start","time":"2015-06-01T10:00:00Z","pkg":"netlib"}
+//	{"event":"progress","time":"2015-06-01T10:00:00Z","pkg":"netlib","msg":"git clone .."}
+//	{"event":"finish","time":"2015-06-01T10:00:02Z","pkg":"netlib","action":"got"}
+//	{"event":"fail","time":"2015-06-01T10:00:03Z","pkg":"utils","action":"failed","errCode":2013,..}
+//	{"event":"summary","time":"2015-06-01T10:00:03Z","context":"dvlnGet","msg":"1 got, 1 failed (2 packages)",..}
+package cmds
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/dvln/api"
+	"github.com/dvln/out"
+	globs "github.com/dvln/viper"
+	"github.com/dvln/yaml"
+)
+
+// looks are the valid --look settings, text is the default
+var looks = []string{"text", "json", "ndjson", "yaml", "table"}
+
+// lookEvent is a single --look=ndjson event, the event types are:
+// - start, progress, finish, fail: a package job starting, making progress,
+// finishing up or failing (see jobs.go)
+// - summary: the wrap up of a multi-package operation
+// - result: the items a (non multi-package) subcommand reports
+// - note, warning, error: messages, an error event is the last event seen
+type lookEvent struct {
+	Event   string      `json:"event"`
+	Time    string      `json:"time"`
+	Context string      `json:"context,omitempty"`
+	Kind    string      `json:"kind,omitempty"`
+	Pkg     string      `json:"pkg,omitempty"`
+	Action  string      `json:"action,omitempty"`
+	Msg     string      `json:"msg,omitempty"`
+	Level   string      `json:"level,omitempty"`
+	Output  []string    `json:"output,omitempty"`
+	ErrCode int         `json:"errCode,omitempty"`
+	ErrHint string      `json:"errHint,omitempty"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+// eventMu serializes event output, package jobs emit events in parallel
+var eventMu sync.Mutex
+
+// eventOut writes out an event line, tests replace it to see the events
+var eventOut = func(line string) { out.Print(line) }
+
+// pkgCtxKey is the context key used to tag a package job's context with
+// the package name so progress events can be attributed to the package
+type pkgCtxKey struct{}
+
+// lookIsStructured returns true if the output look is anything but text, ie:
+// text output should be suppressed and the items reported via renderItems()
+func lookIsStructured() bool {
+	return globs.GetString("look") != "text"
+}
+
+// lookIsJSON returns true if the output look is JSON in some form, in which
+// case issues and errors are reported in JSON form as well
+func lookIsJSON() bool {
+	look := globs.GetString("look")
+	return look == "json" || look == "ndjson"
+}
+
+// lookIsNDJSON returns true if the output look streams JSON events
+func lookIsNDJSON() bool {
+	return globs.GetString("look") == "ndjson"
+}
+
+// eventLine returns the given event as a single line of JSON (sans newline),
+// the time is filled in if not already set
+func eventLine(ev *lookEvent) string {
+	if ev.Time == "" {
+		ev.Time = time.Now().UTC().Format(time.RFC3339)
+	}
+	if ev.ErrCode != 0 && ev.ErrHint == "" {
+		if ic := lookupIssueCode(ev.ErrCode); ic != nil {
+			ev.ErrHint = ic.Hint
+		}
+	}
+	line, err := json.Marshal(ev)
+	if err != nil {
+		// only happens if the Data can't be marshalled, report it as an event
+		line, _ = json.Marshal(&lookEvent{Event: "error", Time: ev.Time, Msg: fmt.Sprintf("Unable to encode %s event: %s", ev.Event, err)})
+	}
+	return string(line)
+}
+
+// emitEvent writes the given event on its own line if in --look=ndjson mode
+// (and does nothing otherwise), it's safe to use from parallel package jobs
+func emitEvent(ev *lookEvent) {
+	if !lookIsNDJSON() {
+		return
+	}
+	eventMu.Lock()
+	defer eventMu.Unlock()
+	eventOut(eventLine(ev) + "\n")
+}
+
+// pkgJobContext returns a context for a job working on the given package
+func pkgJobContext(ctx context.Context, pkgName string) context.Context {
+	return context.WithValue(ctx, pkgCtxKey{}, pkgName)
+}
+
+// jobProgress emits a progress event for the package the given job context
+// belongs to (if any), eg: as each VCS command is run for the package
+func jobProgress(ctx context.Context, format string, args ...interface{}) {
+	pkgName, ok := ctx.Value(pkgCtxKey{}).(string)
+	if !ok {
+		return
+	}
+	emitEvent(&lookEvent{Event: "progress", Pkg: pkgName, Msg: fmt.Sprintf(format, args...)})
+}
+
+// renderItems renders the items a subcommand reports in the structured look
+// selected (see the top of this file).  Items are rendered via their JSON
+// form so the field names match across looks, only the given fields (in the
+// given order) are shown for yaml and table.  Returns the output and true if
+// there was a fatal problem rendering it.
+// - apiContext: the JSON API context for the operation, eg: "dvlnStatus"
+// - kind: the kind of items, eg: "packages"
+func renderItems(apiContext, kind, verbosity string, fields []string, items []interface{}) (string, bool) {
+	switch globs.GetString("look") {
+	case "ndjson":
+		return eventLine(&lookEvent{Event: "result", Context: apiContext, Kind: kind, Data: items}) + "\n", false
+	case "yaml":
+		return renderYAML(apiContext, kind, verbosity, fields, items)
+	case "table":
+		return renderTable(fields, items)
+	}
+	return api.GetJSONOutput(globs.GetString("apiver"), apiContext, kind, verbosity, fields, items)
+}
+
+// itemFields returns the values of the given fields for each item (nil if
+// an item has no such field), as found in the items JSON form
+func itemFields(fields []string, items []interface{}) ([][]interface{}, error) {
+	rows := make([][]interface{}, 0, len(items))
+	for _, item := range items {
+		data, err := json.Marshal(item)
+		if err != nil {
+			return nil, err
+		}
+		var values map[string]interface{}
+		if err = json.Unmarshal(data, &values); err != nil {
+			return nil, err
+		}
+		row := make([]interface{}, len(fields))
+		for i, field := range fields {
+			row[i] = values[field]
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// renderFailed returns the error output for items that couldn't be rendered
+func renderFailed(err error) (string, bool) {
+	return fmt.Sprintf("Unable to render %s output: %s\n", globs.GetString("look"), err), true
+}
+
+// renderYAML renders the items as YAML, laid out like the JSON response
+func renderYAML(apiContext, kind, verbosity string, fields []string, items []interface{}) (string, bool) {
+	rows, err := itemFields(fields, items)
+	if err != nil {
+		return renderFailed(err)
+	}
+	yamlItems := make([]yaml.MapSlice, 0, len(rows))
+	for _, row := range rows {
+		var yamlItem yaml.MapSlice
+		for i, field := range fields {
+			if row[i] != nil {
+				yamlItem = append(yamlItem, yaml.MapItem{Key: field, Value: row[i]})
+			}
+		}
+		yamlItems = append(yamlItems, yamlItem)
+	}
+	resp := yaml.MapSlice{
+		{Key: "apiVersion", Value: globs.GetString("apiver")},
+		{Key: "context", Value: apiContext},
+		{Key: "data", Value: yaml.MapSlice{
+			{Key: "kind", Value: kind},
+			{Key: "verbosity", Value: verbosity},
+			{Key: "items", Value: yamlItems},
+		}},
+	}
+	data, err := yaml.Marshal(resp)
+	if err != nil {
+		return renderFailed(err)
+	}
+	return string(data), false
+}
+
+// renderTable renders the items as aligned columns with a header row, eg:
+//
+//	NAME    ACTION  OUTPUT
+//	netlib  ran     On branch main
+//	                nothing to commit
+//	utils   ran     -
+//
+// Lists (and multi-line strings) get a line per element, so a row can span
+// several lines with the other cells only on the first of them
+func renderTable(fields []string, items []interface{}) (string, bool) {
+	rows, err := itemFields(fields, items)
+	if err != nil {
+		return renderFailed(err)
+	}
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, strings.ToUpper(strings.Join(fields, "\t")))
+	for _, row := range rows {
+		cells := make([][]string, len(row))
+		height := 1
+		for i, value := range row {
+			cells[i] = tableCell(value)
+			if len(cells[i]) > height {
+				height = len(cells[i])
+			}
+		}
+		for line := 0; line < height; line++ {
+			parts := make([]string, len(cells))
+			for i, cell := range cells {
+				if line < len(cell) {
+					parts[i] = cell[line]
+				}
+			}
+			fmt.Fprintln(w, strings.Join(parts, "\t"))
+		}
+	}
+	w.Flush()
+	// continuation lines leave padding where the other cells would be
+	lines := strings.SplitAfter(buf.String(), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \n")
+		if strings.HasSuffix(line, "\n") {
+			lines[i] += "\n"
+		}
+	}
+	return strings.Join(lines, ""), false
+}
+
+// tableCell returns the lines of the table form of a (JSON decoded) value,
+// a line per list element or per line of a string, missing or empty values
+// show up as "-"
+func tableCell(value interface{}) []string {
+	switch v := value.(type) {
+	case nil:
+		return []string{"-"}
+	case string:
+		v = strings.TrimRight(v, "\n")
+		if v == "" {
+			return []string{"-"}
+		}
+		return strings.Split(strings.Replace(v, "\t", "    ", -1), "\n")
+	case []interface{}:
+		if len(v) == 0 {
+			return []string{"-"}
+		}
+		var lines []string
+		for _, elem := range v {
+			lines = append(lines, tableCell(elem)...)
+		}
+		return lines
+	}
+	return []string{fmt.Sprint(value)}
+}
@@ -0,0 +1,132 @@
+// Copyright © 2015 Erik Brady <brady@dvln.org>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmds
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/dvln/yaml"
+)
+
+// lookTests are the items of a few subcommands (status, devline diff and
+// the package results of get, foreach, etc) along with their table form
+var lookTests = []struct {
+	name   string
+	fields []string
+	items  []interface{}
+	table  string
+}{
+	{
+		name:   "status",
+		fields: []string{"name", "state", "revision", "ahead"},
+		items: []interface{}{
+			map[string]interface{}{"name": "netlib", "state": "modified", "revision": "4f2a9c1", "ahead": 2},
+			map[string]interface{}{"name": "utils", "state": "clean", "revision": "9b0e5d2", "ahead": 0},
+		},
+		table: "NAME    STATE     REVISION  AHEAD\n" +
+			"netlib  modified  4f2a9c1   2\n" +
+			"utils   clean     9b0e5d2   0\n",
+	},
+	{
+		name:   "devline diff",
+		fields: []string{"name", "change", "fromVersion", "toVersion"},
+		items: []interface{}{
+			&pkgDiffItem{Name: "netlib", Change: "added", ToVersion: "v1.2"},
+			&pkgDiffItem{Name: "utils", Change: "changed", FromVersion: "v1.0", ToVersion: "main"},
+		},
+		table: "NAME    CHANGE   FROMVERSION  TOVERSION\n" +
+			"netlib  added    -            v1.2\n" +
+			"utils   changed  v1.0         main\n",
+	},
+	{
+		name:   "package results",
+		fields: []string{"name", "action", "output", "errCode", "errMsg"},
+		items: []interface{}{
+			&pkgResultItem{Name: "netlib", Action: "ran", Output: []string{"On branch main", "nothing to commit"}},
+			&pkgResultItem{Name: "utils", Action: "failed", Output: []string{"fatal: bad object"}, ErrCode: 2015, ErrMsg: "exit status 128"},
+			&pkgResultItem{Name: "zlib", Action: "ran"},
+		},
+		table: "NAME    ACTION  OUTPUT             ERRCODE  ERRMSG\n" +
+			"netlib  ran     On branch main     -        -\n" +
+			"                nothing to commit\n" +
+			"utils   failed  fatal: bad object  2015     exit status 128\n" +
+			"zlib    ran     -                  -        -\n",
+	},
+}
+
+func TestRenderTable(t *testing.T) {
+	snap := snapshotGlobs()
+	defer snap.restore()
+	setGlob("look", "table", "test")
+	for _, test := range lookTests {
+		got, fatal := renderItems("dvlnTest", "packages", "regular", test.fields, test.items)
+		if fatal || got != test.table {
+			t.Errorf("%s: got (fatal: %v):\n%s\nwant:\n%s", test.name, fatal, got, test.table)
+		}
+	}
+}
+
+func TestRenderYAML(t *testing.T) {
+	snap := snapshotGlobs()
+	defer snap.restore()
+	setGlob("look", "yaml", "test")
+	setGlob("apiver", "1", "test")
+	for _, test := range lookTests {
+		got, fatal := renderItems("dvlnTest", "packages", "regular", test.fields, test.items)
+		if fatal {
+			t.Errorf("%s: fatal problem: %s", test.name, got)
+			continue
+		}
+		var resp struct {
+			APIVersion string `yaml:"apiVersion"`
+			Context    string `yaml:"context"`
+			Data       struct {
+				Kind      string                   `yaml:"kind"`
+				Verbosity string                   `yaml:"verbosity"`
+				Items     []map[string]interface{} `yaml:"items"`
+			} `yaml:"data"`
+		}
+		if err := yaml.Unmarshal([]byte(got), &resp); err != nil {
+			t.Errorf("%s: output isn't YAML: %s\n%s", test.name, err, got)
+			continue
+		}
+		if resp.APIVersion != "1" || resp.Context != "dvlnTest" || resp.Data.Kind != "packages" || resp.Data.Verbosity != "regular" {
+			t.Errorf("%s: wrong response envelope:\n%s", test.name, got)
+		}
+		rows, err := itemFields(test.fields, test.items)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(resp.Data.Items) != len(rows) {
+			t.Errorf("%s: got %d items, want %d:\n%s", test.name, len(resp.Data.Items), len(rows), got)
+			continue
+		}
+		for i, row := range rows {
+			item := resp.Data.Items[i]
+			for j, field := range test.fields {
+				value, ok := item[field]
+				switch {
+				case row[j] == nil && ok:
+					t.Errorf("%s: item %d has unset field %s", test.name, i, field)
+				case row[j] != nil && fmt.Sprint(value) != fmt.Sprint(row[j]):
+					t.Errorf("%s: item %d field %s: got %v, want %v", test.name, i, field, value, row[j])
+				}
+			}
+			if len(item) > len(test.fields) {
+				t.Errorf("%s: item %d has extra fields: %v", test.name, i, item)
+			}
+		}
+	}
+}
@@ -0,0 +1,213 @@
+// Copyright © 2015 Erik Brady <brady@dvln.org>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package cmds manifest.go module manages the workspace manifest, the state
+// file within the workspace metadata dir that records each package in the
+// workspace and the revision it has checked out.  It's what status, diff,
+// freeze and friends use to know what's in a workspace without having to
+// rescan every package.
+package cmds
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/dvln/out"
+)
+
+// manifestPkg is the manifest record for a single package in the workspace
+type manifestPkg struct {
+	Name     string `json:"name"`
+	Path     string `json:"path"`
+	VCS      string `json:"vcs"`
+	Remote   string `json:"remote"`
+	Version  string `json:"version,omitempty"`  // requested version
+	Revision string `json:"revision,omitempty"` // checked out revision
+	Orphan   bool   `json:"orphan,omitempty"`   // no longer in the devline
+}
+
+// wkspcManifest is the in-memory form of the workspace manifest
+type wkspcManifest struct {
+	Packages []*manifestPkg `json:"packages"`
+}
+
+// manifestPath returns the path to the manifest for the given workspace
+func manifestPath(rootDir string) string {
+	return filepath.Join(wkspcMetaDirPath(rootDir), "manifest.json")
+}
+
+// readManifest reads the manifest for the given workspace, if there isn't
+// one yet an empty manifest is returned
+func readManifest(rootDir string) (*wkspcManifest, error) {
+	m := &wkspcManifest{Packages: []*manifestPkg{}}
+	data, err := ioutil.ReadFile(manifestPath(rootDir))
+	if os.IsNotExist(err) {
+		return m, nil
+	}
+	if err == nil {
+		err = json.Unmarshal(data, m)
+	}
+	if err != nil {
+		return nil, out.WrapErr(err, "Unable to read the workspace manifest", 2022)
+	}
+	return m, nil
+}
+
+// writeManifest writes the manifest for the given workspace, it's written to
+// a temp file first and then renamed into place so the manifest is never
+// left half written (eg: if we're killed off mid-write)
+func writeManifest(rootDir string, m *wkspcManifest) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return out.WrapErr(err, "Unable to write the workspace manifest", 2022)
+	}
+	tmpFile, err := ioutil.TempFile(wkspcMetaDirPath(rootDir), "manifest.")
+	if err != nil {
+		return out.WrapErr(err, "Unable to write the workspace manifest", 2022)
+	}
+	_, err = tmpFile.Write(append(data, '\n'))
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmpFile.Name(), manifestPath(rootDir))
+	}
+	if err != nil {
+		os.Remove(tmpFile.Name())
+		return out.WrapErr(err, "Unable to write the workspace manifest", 2022)
+	}
+	return nil
+}
+
+// pkg returns the manifest record for the given package name, nil if the
+// package isn't in the manifest
+func (m *wkspcManifest) pkg(name string) *manifestPkg {
+	for _, mp := range m.Packages {
+		if mp.Name == name {
+			return mp
+		}
+	}
+	return nil
+}
+
+// setPkg adds or replaces the manifest record for the given package
+func (m *wkspcManifest) setPkg(p *resolvedPkg, revision string) {
+	mp := &manifestPkg{
+		Name:     p.Name,
+		Path:     p.Path,
+		VCS:      p.VCS,
+		Remote:   p.Remote,
+		Version:  p.Version,
+		Revision: revision,
+	}
+	for i, old := range m.Packages {
+		if old.Name == p.Name {
+			m.Packages[i] = mp
+			return
+		}
+	}
+	m.Packages = append(m.Packages, mp)
+}
+
+// removePkg drops the given package from the manifest (if it's there)
+func (m *wkspcManifest) removePkg(name string) {
+	for i, mp := range m.Packages {
+		if mp.Name == name {
+			m.Packages = append(m.Packages[:i], m.Packages[i+1:]...)
+			return
+		}
+	}
+}
+
+// resolvedPkgs returns the packages in the manifest in resolved form (ie: the
+// same form a resolved devline takes) so the two can be compared
+func (m *wkspcManifest) resolvedPkgs() []*resolvedPkg {
+	pkgs := make([]*resolvedPkg, 0, len(m.Packages))
+	for _, mp := range m.Packages {
+		pkgs = append(pkgs, &resolvedPkg{
+			Name:    mp.Name,
+			Path:    mp.Path,
+			VCS:     mp.VCS,
+			Remote:  mp.Remote,
+			Version: mp.Version,
+		})
+	}
+	return pkgs
+}
+
+// manifestRecorder records the results of package jobs in the manifest of
+// a workspace as each result comes in (see runPkgJobs()), so the manifest
+// reflects what was done to the workspace even if we're stopped part way
+type manifestRecorder struct {
+	rootDir string
+	m       *wkspcManifest
+	pkgs    map[string]*resolvedPkg
+	dropped map[string]bool // pkgs dropped from the devline (may be nil)
+	err     error           // first problem writing the manifest, if any
+}
+
+// newManifestRecorder returns a recorder for the results of package jobs run
+// on the given packages in the given workspace, dropped names the packages
+// being dropped from the devline (nil if none)
+func newManifestRecorder(rootDir string, pkgs []*resolvedPkg, dropped map[string]bool) (*manifestRecorder, error) {
+	m, err := readManifest(rootDir)
+	if err != nil {
+		return nil, err
+	}
+	mr := &manifestRecorder{rootDir: rootDir, m: m, pkgs: make(map[string]*resolvedPkg, len(pkgs)), dropped: dropped}
+	for _, p := range pkgs {
+		mr.pkgs[p.Name] = p
+	}
+	return mr, nil
+}
+
+// record updates the manifest based on the given package result and writes
+// it out.  Packages that failed or never ran are left as they were, those
+// dropped from the devline but left in place are marked as orphans (so
+// they aren't dropped, and reported, all over again on the next update).
+func (mr *manifestRecorder) record(r *pkgResult) {
+	p := mr.pkgs[r.Name]
+	if p == nil || r.Err != nil {
+		return
+	}
+	switch r.Action {
+	case "got", "added", "updated", "current", "skipped":
+		mr.m.setPkg(p, r.Revision)
+	case "removed", "gone":
+		mr.m.removePkg(p.Name)
+	case "orphaned", "kept":
+		if r.Action == "kept" && !mr.dropped[p.Name] {
+			return // left as is, local work in the way of an update
+		}
+		if mr.m.pkg(p.Name) == nil {
+			mr.m.setPkg(p, r.Revision)
+		}
+		mr.m.pkg(p.Name).Orphan = true
+	default:
+		return
+	}
+	if err := writeManifest(mr.rootDir, mr.m); err != nil && mr.err == nil {
+		mr.err = err
+	}
+}
+
+// reporter returns a report func for runPkgJobs() that records each result
+// in the manifest and then hands it to the given report func
+func (mr *manifestRecorder) reporter(report func(*pkgResult)) func(*pkgResult) {
+	return func(r *pkgResult) {
+		mr.record(r)
+		report(r)
+	}
+}
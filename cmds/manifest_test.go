@@ -0,0 +1,77 @@
+// Copyright © 2015 Erik Brady <brady@dvln.org>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmds
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestManifestRecorder(t *testing.T) {
+	root, err := ioutil.TempDir("", "dvln-manifest-")
+	if err != nil {
+		t.Fatalf("Unable to create a temp workspace: %s", err)
+	}
+	defer os.RemoveAll(root)
+	if err = createWkspcMetaDir(root); err != nil {
+		t.Fatalf("Unable to create the workspace metadata dir: %s", err)
+	}
+	pkgs := []*resolvedPkg{
+		{Name: "app", Path: "app", VCS: "git", Remote: "r/app", Version: "main"},
+		{Name: "old", Path: "old", VCS: "git", Remote: "r/old"},
+		{Name: "dirty", Path: "dirty", VCS: "git", Remote: "r/dirty"},
+		{Name: "bad", Path: "bad", VCS: "git", Remote: "r/bad"},
+	}
+	mr, err := newManifestRecorder(root, pkgs, map[string]bool{"old": true, "dirty": true})
+	if err != nil {
+		t.Fatalf("Unable to create a manifest recorder: %s", err)
+	}
+	report := mr.reporter(func(*pkgResult) {})
+
+	// each result is in the manifest as soon as it's reported
+	report(&pkgResult{Name: "app", Action: "got", Revision: "abc123"})
+	m, err := readManifest(root)
+	if err != nil || m.pkg("app") == nil || m.pkg("app").Revision != "abc123" {
+		t.Fatalf("Package app not recorded in the manifest as soon as it was got: %v", err)
+	}
+	report(&pkgResult{Name: "old", Action: "orphaned"})
+	report(&pkgResult{Name: "dirty", Action: "kept"})
+	report((&pkgResult{Name: "bad", Action: "got"}).failed(2013, errors.New("clone failed")))
+	if mr.err != nil {
+		t.Fatalf("Unable to record results: %s", mr.err)
+	}
+	if m, err = readManifest(root); err != nil {
+		t.Fatalf("Unable to read the manifest: %s", err)
+	}
+	for _, name := range []string{"old", "dirty"} {
+		if mp := m.pkg(name); mp == nil || !mp.Orphan {
+			t.Errorf("Package %s left in place was not recorded as an orphan: %+v", name, mp)
+		}
+	}
+	if m.pkg("app").Orphan {
+		t.Errorf("Package app was recorded as an orphan")
+	}
+	if m.pkg("bad") != nil {
+		t.Errorf("Package bad failed but was recorded in the manifest")
+	}
+
+	// a package kept as is during an update (not dropped) is left alone
+	mr, _ = newManifestRecorder(root, pkgs[:1], nil)
+	mr.record(&pkgResult{Name: "app", Action: "kept"})
+	if m, _ = readManifest(root); m.pkg("app") == nil || m.pkg("app").Orphan {
+		t.Errorf("Package app kept as is during an update was changed in the manifest")
+	}
+}
@@ -0,0 +1,156 @@
+// Copyright © 2015 Erik Brady <brady@dvln.org>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package cmds prompt.go module handles asking the user (if --interact|-i is
+// on) what to do about a package when an operation would lose local work,
+// eg: updating or removing a package with local changes.  Without prompting
+// the safe thing is done (the package is left alone and flagged as a
+// failure) unless --force is on.
+package cmds
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/dvln/out"
+	globs "github.com/dvln/viper"
+)
+
+// pkgChoice is what to do about a package when local work would be lost
+type pkgChoice int
+
+const (
+	choiceFail  pkgChoice = iota // leave the package alone, it's a failure
+	choiceSkip                   // leave the package alone, not a failure
+	choiceStash                  // stash the local work, then carry on
+	choiceForce                  // carry on, the local work is lost
+	choiceAbort                  // stop working on all packages
+)
+
+// pkgChoiceKeys maps the answers to our prompt to the choice, the upper
+// case form of an answer applies it to all remaining packages
+var pkgChoiceKeys = map[string]pkgChoice{
+	"s": choiceSkip,
+	"t": choiceStash,
+	"f": choiceForce,
+	"a": choiceAbort,
+}
+
+// pkgPrompter asks the user what to do about packages, it's used from the
+// parallel package jobs (see jobs.go) so only one prompt is shown at a time
+// and results are held back while it's open (see reporter())
+type pkgPrompter struct {
+	mu       sync.Mutex
+	interact bool
+	force    bool
+	in       *bufio.Reader
+	all      pkgChoice // choice applied to all remaining pkgs (if allSet)
+	allSet   bool
+	aborted  bool
+}
+
+// newPkgPrompter returns a prompter based on the interact and force settings
+func newPkgPrompter() *pkgPrompter {
+	return &pkgPrompter{
+		interact: globs.GetBool("interact"),
+		force:    forced(),
+		in:       bufio.NewReader(os.Stdin),
+	}
+}
+
+// choose returns what to do about the named package given the problem
+// (eg: "has local changes that update would overwrite"), prompting the
+// user if interacting and no "apply to all" answer was given yet
+func (pp *pkgPrompter) choose(pkgName string, problem string) pkgChoice {
+	pp.mu.Lock()
+	defer pp.mu.Unlock()
+	switch {
+	case pp.aborted:
+		return choiceAbort
+	case pp.allSet:
+		return pp.all
+	case !pp.interact && pp.force:
+		return choiceForce
+	case !pp.interact:
+		return choiceFail
+	}
+	for {
+		out.Printf("Package %s: %s\n", pkgName, problem)
+		out.Print("  [s]kip, s[t]ash, [f]orce or [a]bort (upper case applies to all remaining)? ")
+		answer, err := pp.in.ReadString('\n')
+		answer = strings.TrimSpace(answer)
+		if err != nil && (err != io.EOF || answer == "") {
+			// no one to ask (closed stdin), play it safe
+			out.Println()
+			return choiceFail
+		}
+		choice, ok := pkgChoiceKeys[strings.ToLower(answer)]
+		if !ok {
+			out.Println("  Please answer s, t, f or a (or S, T, F or A)")
+			continue
+		}
+		if answer != strings.ToLower(answer) {
+			pp.all = choice
+			pp.allSet = true
+		}
+		if choice == choiceAbort {
+			pp.aborted = true
+		}
+		return choice
+	}
+}
+
+// reporter returns the given package result report func (see runPkgJobs())
+// wrapped so no result is shown while a prompt is open, otherwise results
+// of other packages get mixed in with the prompt and the users answer
+func (pp *pkgPrompter) reporter(report func(*pkgResult)) func(*pkgResult) {
+	return func(r *pkgResult) {
+		pp.mu.Lock()
+		defer pp.mu.Unlock()
+		report(r)
+	}
+}
+
+// isAborted returns true if the user chose to abort
+func (pp *pkgPrompter) isAborted() bool {
+	pp.mu.Lock()
+	defer pp.mu.Unlock()
+	return pp.aborted
+}
+
+// localWork asks (see choose()) what to do about a package with local work
+// (as described by problem, eg: "has local changes") that the given action
+// (eg: "update") would lose.  If the action should go ahead the choice
+// (choiceStash or choiceForce) is returned for the caller to deal with the
+// local work.  Otherwise the result is filled in, as a failure with the
+// given protections issue code if the safe default was used.
+func (pp *pkgPrompter) localWork(r *pkgResult, p *resolvedPkg, action string, problem string, pr *protection) pkgChoice {
+	choice := pp.choose(p.Name, fmt.Sprintf("%s that %s would lose", problem, action))
+	switch choice {
+	case choiceStash, choiceForce:
+		return choice
+	case choiceSkip:
+		r.Action = "kept"
+		r.Msgs = append(r.Msgs, fmt.Sprintf("%s, %s skipped", problem, action))
+	case choiceAbort:
+		r.Action = "aborted"
+		r.failed(2032, out.NewErr(fmt.Sprintf("Package %s: %s aborted by user", p.Name, action), 2032))
+	default:
+		r.failed(pr.code, pr.refuse(fmt.Sprintf("Package %s: %s, not doing %s (use --interact|-i to choose what to do)", p.Name, problem, action)))
+	}
+	return choice
+}
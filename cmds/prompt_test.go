@@ -0,0 +1,115 @@
+// Copyright © 2015 Erik Brady <brady@dvln.org>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmds
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testPrompter returns an interactive prompter with the given user input
+func testPrompter(input string) *pkgPrompter {
+	return &pkgPrompter{interact: true, in: bufio.NewReader(strings.NewReader(input))}
+}
+
+func TestPkgPrompterChoose(t *testing.T) {
+	tests := []struct {
+		desc    string
+		pp      *pkgPrompter
+		choices []pkgChoice
+	}{
+		{"not interacting", &pkgPrompter{}, []pkgChoice{choiceFail, choiceFail}},
+		{"forced", &pkgPrompter{force: true}, []pkgChoice{choiceForce, choiceForce}},
+		{"bad answer asked again", testPrompter("x\ns\nt\n"), []pkgChoice{choiceSkip, choiceStash}},
+		{"answer for all", testPrompter("f\nT\nf\n"), []pkgChoice{choiceForce, choiceStash, choiceStash}},
+		{"abort", testPrompter("a\ns\n"), []pkgChoice{choiceAbort, choiceAbort}},
+		{"no more input", testPrompter("s"), []pkgChoice{choiceSkip, choiceFail}},
+	}
+	for _, test := range tests {
+		for i, want := range test.choices {
+			if got := test.pp.choose("net", "has local changes"); got != want {
+				t.Errorf("%s: choice %d is %d, want %d", test.desc, i, got, want)
+			}
+		}
+	}
+}
+
+func TestPkgPrompterLocalWork(t *testing.T) {
+	p := &resolvedPkg{Name: "net"}
+	tests := []struct {
+		input  string
+		choice pkgChoice
+		action string
+		code   int
+	}{
+		{"s\n", choiceSkip, "kept", 0},
+		{"t\n", choiceStash, "", 0},
+		{"f\n", choiceForce, "", 0},
+		{"a\n", choiceAbort, "aborted", 2032},
+		{"", choiceFail, "", protectDirtyPkg.code},
+	}
+	for _, test := range tests {
+		r := &pkgResult{Name: p.Name}
+		choice := testPrompter(test.input).localWork(r, p, "update", "has local changes", protectDirtyPkg)
+		if choice != test.choice || r.Action != test.action || r.Code != test.code || (r.Err != nil) != (test.code != 0) {
+			t.Errorf("Answer %q: choice %d, result %+v, want choice %d, action %q, code %d", test.input, choice, r, test.choice, test.action, test.code)
+		}
+	}
+	r := &pkgResult{Name: p.Name}
+	testPrompter("").localWork(r, p, "update", "has local changes", protectDirtyPkg)
+	if r.Err == nil || !strings.Contains(r.Err.Error(), "use --interact|-i to choose") {
+		t.Errorf("Safe default error doesn't say how to choose: %v", r.Err)
+	}
+}
+
+// promptInput is user input that only comes in when the test sends it, it
+// says when the prompt is waiting on it
+type promptInput struct {
+	waiting chan struct{}
+	answer  chan string
+}
+
+func (pi *promptInput) Read(b []byte) (int, error) {
+	pi.waiting <- struct{}{}
+	return copy(b, <-pi.answer), nil
+}
+
+// TestPkgPrompterHoldsResults checks no result is reported while a prompt
+// is waiting on the users answer
+func TestPkgPrompterHoldsResults(t *testing.T) {
+	input := &promptInput{make(chan struct{}), make(chan string)}
+	pp := &pkgPrompter{interact: true, in: bufio.NewReader(input)}
+	chosen := make(chan pkgChoice)
+	go func() { chosen <- pp.choose("net", "has local changes") }()
+	<-input.waiting
+
+	reported := make(chan string, 1)
+	go pp.reporter(func(r *pkgResult) { reported <- r.Name })(&pkgResult{Name: "utils"})
+	select {
+	case name := <-reported:
+		t.Fatalf("Package %s reported while the prompt was open", name)
+	case <-time.After(50 * time.Millisecond):
+	}
+	input.answer <- "s\n"
+	if choice := <-chosen; choice != choiceSkip {
+		t.Errorf("Got choice %d, want skip", choice)
+	}
+	select {
+	case <-reported:
+	case <-time.After(5 * time.Second):
+		t.Errorf("Package result not reported once the prompt was answered")
+	}
+}
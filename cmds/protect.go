@@ -0,0 +1,83 @@
+// Copyright © 2015 Erik Brady <brady@dvln.org>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package cmds protect.go module defines the protections dvln has against
+// losing (or hiding) work, each can be bypassed with --force|-f.  Add any
+// new protection to the protections list so it shows up in 'dvln help'.
+package cmds
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/dvln/out"
+	globs "github.com/dvln/viper"
+)
+
+// protection is a check that refuses to do something dangerous unless
+// --force is used, each has it's own issue code
+type protection struct {
+	code int
+	desc string // what is refused, eg: "updating pkgs with local changes"
+}
+
+var (
+	protectDirtyPkg = &protection{2031, "updating (or removing) packages with local changes"}
+	protectUnpushed = &protection{2033, "removing packages with revisions not pushed to their remote"}
+	protectNesting  = &protection{2019, "creating a workspace within (or on top of) a workspace"}
+	protectSwitch   = &protection{2034, "switching devlines while packages have unpushed local branches"}
+	protectDevline  = &protection{2035, "overwriting an existing devline definition"}
+)
+
+// protections is the full list of protections, see protectionsHelp()
+var protections = []*protection{
+	protectDirtyPkg,
+	protectUnpushed,
+	protectNesting,
+	protectSwitch,
+	protectDevline,
+}
+
+// init adds the protections to the top level 'dvln' command help
+func init() {
+	dvlnCmd.Long += "\n\n" + protectionsHelp()
+}
+
+// protectionsHelp describes the protections --force bypasses
+func protectionsHelp() string {
+	lines := []string{"Protections (bypass with --force|-f):"}
+	for _, pr := range protections {
+		lines = append(lines, fmt.Sprintf("  %-60s (issue #%d)", pr.desc, pr.code))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// forced returns true if protections are being bypassed via --force, it
+// bypasses all of them
+func forced() bool {
+	return globs.GetBool("force")
+}
+
+// guard returns nil if --force is set, otherwise an error refusing to do what
+// the given message describes (with the protections issue code)
+func (pr *protection) guard(msg string) error {
+	if forced() {
+		return nil
+	}
+	return pr.refuse(msg)
+}
+
+// refuse returns an error refusing to do what the given message describes
+func (pr *protection) refuse(msg string) error {
+	return out.NewErr(fmt.Sprintf("%s, use --force to override", msg), pr.code)
+}
@@ -0,0 +1,255 @@
+// Copyright © 2015 Erik Brady <brady@dvln.org>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package cmds selector.go module handles the --pkg|-p package selector used
+// by subcommands to work on only some of the packages in a workspace.  A
+// selector is a comma separated list of terms, each of which is one of:
+//
+//	name                  a package name
+//	glob                  a package name or path glob, eg: net/*
+//	group                 a codebase package group name
+//	modified              packages with local changes in the workspace
+//	dependencies-of:name  packages the named package depends upon
+//	dependents-of:name    packages that depend upon the named package
+//
+// Any term can be negated with a leading '!' to exclude those packages, eg:
+// "net/*,!net/test" or "!docs" (if there are only negated terms then they
+// are excluded from all packages).
+package cmds
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/dvln/out"
+)
+
+const (
+	selModified     = "modified"
+	selDependencies = "dependencies-of:"
+	selDependents   = "dependents-of:"
+)
+
+// pkgSelector evaluates selector terms against a set of packages (from the
+// workspace manifest or the devline), the codebase (if available) supplies
+// groups and dependencies and the workspace (if any) the 'modified' state
+type pkgSelector struct {
+	pkgs         []*resolvedPkg
+	cb           *codebaseDef
+	wkspcRootDir string
+	modified     map[string]bool // lazily filled in, see isModified()
+}
+
+// selectPkgs returns the packages (in their original order) matching the
+// given package selector, an empty selector selects all packages.  The
+// codebase may be nil, in which case group and dependency terms can't be
+// used, and the workspace root dir may be empty (nothing is 'modified').
+func selectPkgs(pkgs []*resolvedPkg, selector string, cb *codebaseDef, wkspcRootDir string) ([]*resolvedPkg, error) {
+	if strings.TrimSpace(selector) == "" {
+		return pkgs, nil
+	}
+	sel := &pkgSelector{pkgs: pkgs, cb: cb, wkspcRootDir: wkspcRootDir}
+	included := make(map[string]bool)
+	excluded := make(map[string]bool)
+	onlyNegated := true
+	for _, term := range strings.Split(selector, ",") {
+		term = strings.TrimSpace(term)
+		if term == "" {
+			continue
+		}
+		matches := included
+		if strings.HasPrefix(term, "!") {
+			term = strings.TrimSpace(term[1:])
+			matches = excluded
+		} else {
+			onlyNegated = false
+		}
+		names, err := sel.match(term)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range names {
+			matches[name] = true
+		}
+	}
+	selected := make([]*resolvedPkg, 0, len(pkgs))
+	for _, p := range pkgs {
+		if (onlyNegated || included[p.Name]) && !excluded[p.Name] {
+			selected = append(selected, p)
+		}
+	}
+	out.Debugf("Package selector \"%s\" selected %d of %d packages\n", selector, len(selected), len(pkgs))
+	return selected, nil
+}
+
+// match returns the names of the packages matching a single selector term,
+// package names win over keywords which win over groups and then globs
+func (sel *pkgSelector) match(term string) ([]string, error) {
+	if term == "" {
+		return nil, out.NewErr("Package selector: empty negated term ('!')", 2026)
+	}
+	if p := sel.pkg(term); p != nil {
+		return []string{p.Name}, nil
+	}
+	switch {
+	case term == selModified:
+		return sel.matchModified()
+	case strings.HasPrefix(term, selDependencies):
+		return sel.matchDeps(strings.TrimPrefix(term, selDependencies), false)
+	case strings.HasPrefix(term, selDependents):
+		return sel.matchDeps(strings.TrimPrefix(term, selDependents), true)
+	}
+	var names []string
+	if sel.cb != nil {
+		for _, p := range sel.pkgs {
+			if def := sel.cb.pkg(p.Name); def != nil && stringInSlice(term, def.Groups) {
+				names = append(names, p.Name)
+			}
+		}
+		if names != nil {
+			return names, nil
+		}
+	}
+	if strings.ContainsAny(term, "*?[") {
+		for _, p := range sel.pkgs {
+			nameMatch, err := path.Match(term, p.Name)
+			if err != nil {
+				return nil, out.WrapErr(err, fmt.Sprintf("Package selector: bad glob \"%s\"", term), 2026)
+			}
+			pathMatch, _ := path.Match(term, filepath.ToSlash(p.Path))
+			if nameMatch || pathMatch {
+				names = append(names, p.Name)
+			}
+		}
+		if names == nil {
+			return nil, out.NewErr(fmt.Sprintf("Package selector: glob \"%s\" matches no packages", term), 2026)
+		}
+		return names, nil
+	}
+	if sel.cb == nil {
+		return nil, out.NewErr(fmt.Sprintf("Package selector: no package named \"%s\" (groups unavailable, no codebase)", term), 2026)
+	}
+	return nil, out.NewErr(fmt.Sprintf("Package selector: no package or group named \"%s\"", term), 2026)
+}
+
+// pkg returns the package with the given name from those being selected
+// from, nil if there is no such package
+func (sel *pkgSelector) pkg(name string) *resolvedPkg {
+	for _, p := range sel.pkgs {
+		if p.Name == name {
+			return p
+		}
+	}
+	return nil
+}
+
+// matchModified returns the packages with local changes in the workspace,
+// packages not (yet) in the workspace are not modified.  The packages are
+// checked in parallel (honoring --jobs), the first failure is returned.
+func (sel *pkgSelector) matchModified() ([]string, error) {
+	var names []string
+	if sel.wkspcRootDir == "" {
+		return names, nil
+	}
+	results, _ := runQuietPkgJobs(sel.pkgs, func(ctx context.Context, p *resolvedPkg) *pkgResult {
+		r := &pkgResult{Name: p.Name, Action: "unmodified"}
+		pkgDir, err := wkspcPkgDir(sel.wkspcRootDir, p.Path)
+		if err != nil {
+			return r.failed(2041, err)
+		}
+		if _, err := os.Stat(pkgDir); os.IsNotExist(err) {
+			r.Action = "absent"
+			return r
+		}
+		dirty, err := vcsIsDirty(ctx, p, pkgDir)
+		if err != nil {
+			return r.failed(2015, err)
+		}
+		if dirty {
+			r.Action = selModified
+		}
+		return r
+	})
+	for _, r := range results {
+		if r.Err != nil {
+			return nil, r.Err
+		}
+		if r.Action == selModified {
+			names = append(names, r.Name)
+		}
+	}
+	return names, nil
+}
+
+// matchDeps returns the packages the named package depends upon (or, if
+// dependents is set, the packages depending upon it), all the way down (or
+// up), the named package itself is not included
+func (sel *pkgSelector) matchDeps(name string, dependents bool) ([]string, error) {
+	if sel.cb == nil {
+		return nil, out.NewErr(fmt.Sprintf("Package selector: dependencies of \"%s\" unavailable, no codebase", name), 2026)
+	}
+	if sel.cb.pkg(name) == nil {
+		return nil, out.NewErr(fmt.Sprintf("Package selector: no package named \"%s\" in codebase %s", name, sel.cb.Name), 2026)
+	}
+	seen := map[string]bool{name: true}
+	todo := []string{name}
+	for len(todo) != 0 {
+		curr := todo[0]
+		todo = todo[1:]
+		var next []string
+		if dependents {
+			for _, p := range sel.cb.Packages {
+				if stringInSlice(curr, p.Deps) {
+					next = append(next, p.Name)
+				}
+			}
+		} else {
+			next = sel.cb.pkg(curr).Deps
+		}
+		for _, n := range next {
+			if !seen[n] {
+				seen[n] = true
+				todo = append(todo, n)
+			}
+		}
+	}
+	var names []string
+	for _, p := range sel.pkgs {
+		if p.Name != name && seen[p.Name] {
+			names = append(names, p.Name)
+		}
+	}
+	return names, nil
+}
+
+// selectWkspcPkgs applies the package selector to packages recorded for a
+// workspace, the workspace codebase is only loaded (for groups and
+// dependencies) if there is a selector and if it can't be we do without
+func selectWkspcPkgs(wkspcRootDir string, info *wkspcInfo, pkgs []*resolvedPkg, selector string) ([]*resolvedPkg, error) {
+	if strings.TrimSpace(selector) == "" {
+		return pkgs, nil
+	}
+	var cb *codebaseDef
+	if info != nil && info.Codebase != "" {
+		var err error
+		if cb, err = loadCodebase(info.Codebase); err != nil {
+			out.Debugln("Unable to load the codebase for the package selector, ignoring:", err)
+			cb = nil
+		}
+	}
+	return selectPkgs(pkgs, selector, cb, wkspcRootDir)
+}
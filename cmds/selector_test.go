@@ -0,0 +1,131 @@
+// Copyright © 2015 Erik Brady <brady@dvln.org>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmds
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testSelectorCodebase returns a small codebase (and it's packages) to
+// select from: app -> net -> util, net/test -> net, docs in group "doc"
+func testSelectorCodebase() (*codebaseDef, []*resolvedPkg) {
+	cb := &codebaseDef{Name: "cb", Packages: []*pkgDef{
+		{Name: "app", Deps: []string{"net"}},
+		{Name: "net", Deps: []string{"util"}, Groups: []string{"core"}},
+		{Name: "net/test", Deps: []string{"net"}},
+		{Name: "util", Path: "lib/util", Groups: []string{"core"}},
+		{Name: "docs", Groups: []string{"doc"}},
+	}}
+	var pkgs []*resolvedPkg
+	for _, p := range cb.Packages {
+		path := p.Path
+		if path == "" {
+			path = p.Name
+		}
+		pkgs = append(pkgs, &resolvedPkg{Name: p.Name, Path: path, VCS: "git"})
+	}
+	return cb, pkgs
+}
+
+func selectedNames(pkgs []*resolvedPkg) string {
+	var names []string
+	for _, p := range pkgs {
+		names = append(names, p.Name)
+	}
+	return strings.Join(names, ",")
+}
+
+func TestSelectPkgs(t *testing.T) {
+	cb, pkgs := testSelectorCodebase()
+	for _, tc := range []struct{ selector, want string }{
+		{"", "app,net,net/test,util,docs"},
+		{"net", "net"},
+		{"util,app", "app,util"},
+		{"net*", "net"}, // globs match a path element at a time
+		{"net/*", "net/test"},
+		{"lib/*", "util"},
+		{"net,net/*,!net/test", "net"},
+		{"!docs", "app,net,net/test,util"},
+		{"core", "net,util"},
+		{"core,!util", "net"},
+		{"dependencies-of:app", "net,util"},
+		{"dependents-of:net", "app,net/test"},
+		{"dependents-of:util,!app", "net,net/test"},
+		{"modified", ""}, // no workspace, nothing is modified
+	} {
+		got, err := selectPkgs(pkgs, tc.selector, cb, "")
+		if err != nil {
+			t.Errorf("selector %q failed: %s", tc.selector, err)
+			continue
+		}
+		if names := selectedNames(got); names != tc.want {
+			t.Errorf("selector %q selected %q, want %q", tc.selector, names, tc.want)
+		}
+	}
+	for _, selector := range []string{"nope", "nope*", "!", "[", "dependents-of:nope", "!nope*"} {
+		if _, err := selectPkgs(pkgs, selector, cb, ""); err == nil {
+			t.Errorf("bad selector %q accepted", selector)
+		}
+	}
+	// without a codebase names and globs still work, groups and deps don't
+	if got, err := selectPkgs(pkgs, "net/*", nil, ""); err != nil || selectedNames(got) != "net/test" {
+		t.Errorf("glob without a codebase selected %q (err: %v)", selectedNames(got), err)
+	}
+	for _, selector := range []string{"core", "dependencies-of:app"} {
+		if _, err := selectPkgs(pkgs, selector, nil, ""); err == nil {
+			t.Errorf("selector %q accepted without a codebase", selector)
+		}
+	}
+}
+
+func TestSelectModified(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	_, pkgs := testSelectorCodebase()
+	root, err := ioutil.TempDir("", "dvlnsel")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	// net and util are in the workspace, only net has local changes, the
+	// other packages aren't (yet) in the workspace
+	for _, p := range []string{"net", "lib/util"} {
+		dir := filepath.Join(root, p)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if out, err := exec.Command("git", "init", "-q", dir).CombinedOutput(); err != nil {
+			t.Fatalf("git init failed: %s: %s", err, out)
+		}
+	}
+	if err := ioutil.WriteFile(filepath.Join(root, "net", "new.go"), []byte("package net\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	got, err := selectPkgs(pkgs, "modified", nil, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names := selectedNames(got); names != "net" {
+		t.Errorf("modified selected %q, want \"net\"", names)
+	}
+	if got, err = selectPkgs(pkgs, "!modified", nil, root); err != nil || selectedNames(got) != "app,net/test,util,docs" {
+		t.Errorf("!modified selected %q (err: %v)", selectedNames(got), err)
+	}
+}
@@ -0,0 +1,243 @@
+// Copyright © 2015 Erik Brady <brady@dvln.org>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package cmds serve.go module implements the 'dvln --serve' REST API mode,
+// subcommands are exposed as REST endpoints that return the same JSON that
+// the subcommand would return if run with --look=json, eg:
+//
+//	% dvln --serve --port 3856 &
+//	% curl 'http://localhost:3856/status?verbose=true'
+//	% curl -X POST 'http://localhost:3856/update?devline=proj_x'
+//
+// The server listens on --servehost (127.0.0.1 by default, ie: only local
+// clients) and the workspaces requests work on (see the wkspcdir query
+// parameter) must be within --serveroot (default: the dir it started in).
+package cmds
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/dvln/api"
+	cli "github.com/dvln/cobra"
+	"github.com/dvln/out"
+	globs "github.com/dvln/viper"
+	"github.com/dvln/wkspc"
+)
+
+// restEndpoint describes a subcommand exposed via the REST API along with
+// the HTTP method it answers to and the settings a client may pass in as
+// query parameters (eg: /get?codebase=cb_x&devline=dl_z)
+type restEndpoint struct {
+	method   string
+	run      func(*cli.Command, []string)
+	cmd      *cli.Command
+	settings []string
+}
+
+// restEndpoints are the subcommands available in --serve mode, read-only
+// subcommands use GET while those that modify a workspace require POST
+var restEndpoints = map[string]*restEndpoint{
+	"/get":     {"POST", get, getCmd, []string{"codebase", "devline", "pkg", "wkspcdir"}},
+	"/update":  {"POST", update, updateCmd, []string{"devline", "pkg", "prune", "wkspcdir"}},
+	"/status":  {"GET", status, statusCmd, []string{"pkg", "wkspcdir"}},
+	"/version": {"GET", version, versionCmd, []string{}},
+}
+
+// restCommonSettings are query parameters allowed for every endpoint
+var restCommonSettings = []string{"debug", "fatalon", "force", "jobs", "terse", "verbose"}
+
+// outLevels are the 'out' pkg output levels that can have their own writer
+var outLevels = []out.Level{out.LevelTrace, out.LevelDebug, out.LevelVerbose, out.LevelInfo, out.LevelNote, out.LevelIssue, out.LevelError, out.LevelFatal}
+
+// restLock serializes REST requests, subcommands use package level state
+// (the 'globs' settings and 'out' writers) so only one can run at a time
+var restLock sync.Mutex
+
+// serveREST starts up the REST API server on the --port|-P port and serves
+// requests until the server fails (it doesn't return otherwise), returns
+// the exit value for the tool
+func serveREST() int {
+	errExit := int(out.ErrorExitVal())
+	// Subcommands exit via the 'out' pkg on errors, the server must survive
+	// that so tell the 'out' pkg not to exit and force JSON output mode
+	os.Setenv("PKG_OUT_NO_EXIT", "1")
+	setGlob("look", "json", "dvln --serve")
+	setGlob("interact", false, "dvln --serve")
+	var handleJSON handleLookJSONMsgs
+	out.SetFormatter(out.LevelIssue, handleJSON)
+	out.SetFormatter(out.LevelError, handleJSON)
+	out.SetFormatter(out.LevelFatal, handleJSON)
+
+	mux := http.NewServeMux()
+	for path, endpoint := range restEndpoints {
+		mux.Handle(path, endpoint)
+	}
+	addr := net.JoinHostPort(globs.GetString("servehost"), strconv.Itoa(globs.GetInt("port")))
+	out.Noteln("Serving the dvln REST API on", addr)
+	err := http.ListenAndServe(addr, mux)
+	os.Setenv("PKG_OUT_NO_EXIT", "0")
+	out.ErrorExit(errExit, out.WrapErr(err, "REST API server failed", 2020))
+	return errExit
+}
+
+// ServeHTTP runs the endpoints subcommand with any settings given via query
+// parameters and returns the subcommands JSON output as the response
+func (e *restEndpoint) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method != e.method {
+		restError(w, http.StatusMethodNotAllowed, fmt.Sprintf("Method %s not allowed for %s, use %s", r.Method, r.URL.Path, e.method), 2021)
+		return
+	}
+	restLock.Lock()
+	defer restLock.Unlock()
+
+	// Push query params into 'globs' so the subcommand sees them just as it
+	// would CLI options.  Every setting changed during the request (query
+	// params or, say, codebase settings) is put back the way it was after,
+	// with the jobs setting put back in effect (see settingValuesIssue()).
+	snap := snapshotGlobs()
+	defer func() {
+		snap.restore()
+		settingValuesIssue()
+	}()
+	allowed := append(append([]string{}, e.settings...), restCommonSettings...)
+	query := r.URL.Query()
+	for key := range query {
+		if !stringInSlice(key, allowed) {
+			restError(w, http.StatusBadRequest, fmt.Sprintf("Setting %s is not available for %s", key, r.URL.Path), 2021)
+			return
+		}
+	}
+	for _, key := range allowed {
+		if _, ok := query[key]; !ok {
+			continue
+		}
+		val := query.Get(key)
+		var setting interface{} = val
+		if _, isBool := globs.Get(key).(bool); isBool {
+			b, err := strconv.ParseBool(val)
+			if err != nil {
+				restError(w, http.StatusBadRequest, fmt.Sprintf("Setting %s must be true or false, found: %s", key, val), 2021)
+				return
+			}
+			setting = b
+		}
+		setGlob(key, setting, "rest:"+key)
+	}
+	if issueMsg, code := settingValuesIssue(); issueMsg != "" {
+		restError(w, http.StatusBadRequest, strings.TrimSpace(issueMsg), code)
+		return
+	}
+
+	// Find the workspace the request is for, just as dvlnFinalPrep() would,
+	// it must be within the --serveroot dir
+	wkspcDir, err := filepath.Abs(globs.GetString("wkspcdir"))
+	if err == nil {
+		err = checkServeRoot(wkspcDir)
+	}
+	if err != nil {
+		restError(w, http.StatusForbidden, err.Error(), 2021)
+		return
+	}
+	rootDir, err := wkspc.RootDir(wkspcDir)
+	if err == nil && rootDir != "" {
+		if err = checkServeRoot(rootDir); err != nil {
+			restError(w, http.StatusForbidden, err.Error(), 2021)
+			return
+		}
+	}
+	if err == nil {
+		err = wkspc.SetRootDir(rootDir)
+	}
+	if err != nil {
+		restError(w, http.StatusInternalServerError, fmt.Sprintf("Unexpected problem scanning for a workspace: %s", err), 2006)
+		return
+	}
+
+	// Grab all screen output for the response, restoring the writers after
+	for _, level := range outLevels {
+		defer out.SetWriter(level, out.Writer(level, out.ForScreen), out.ForScreen)
+	}
+	buf := new(bytes.Buffer)
+	out.SetWriter(out.LevelAll, buf, out.ForScreen)
+	out.Debugln("REST request:", r.Method, r.URL.String())
+	e.run(e.cmd, []string{})
+
+	// A subcommand failure comes back as a JSON "error" response
+	var response map[string]interface{}
+	if json.Unmarshal(buf.Bytes(), &response) == nil && response["error"] != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+	w.Write(buf.Bytes())
+}
+
+// checkServeRoot returns an error if the given (absolute) dir isn't within
+// the --serveroot dir (the dir the server was started in if not set)
+func checkServeRoot(dir string) error {
+	root := globs.GetString("serveroot")
+	var err error
+	if root == "" {
+		root, err = os.Getwd()
+	} else {
+		root, err = filepath.Abs(root)
+	}
+	if err != nil {
+		return fmt.Errorf("Unable to determine the --serveroot dir: %s", err)
+	}
+	// compare real paths (if they exist yet) so symlinks can't get out
+	realRoot, realDir := root, dir
+	if resolved, err := filepath.EvalSymlinks(root); err == nil {
+		realRoot = resolved
+	}
+	for check := dir; ; check = filepath.Dir(check) {
+		if resolved, err := filepath.EvalSymlinks(check); err == nil {
+			realDir = filepath.Join(resolved, strings.TrimPrefix(dir, check))
+			break
+		}
+		if filepath.Dir(check) == check {
+			break
+		}
+	}
+	rel, err := filepath.Rel(realRoot, realDir)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("Workspace dir %s is not within the --serveroot dir %s", dir, root)
+	}
+	return nil
+}
+
+// restError sends back a JSON error response (the same form as any other
+// fatal JSON error from dvln) with the given HTTP status
+func restError(w http.ResponseWriter, httpStatus int, msg string, code int) {
+	problemMsg := api.NewMsg(msg, code, fmt.Sprintf("%s", out.LevelIssue))
+	w.WriteHeader(httpStatus)
+	fmt.Fprint(w, api.FatalJSONMsg(globs.GetString("apiver"), problemMsg))
+}
+
+// stringInSlice returns true if the given string is in the given slice
+func stringInSlice(s string, list []string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
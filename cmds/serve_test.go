@@ -0,0 +1,133 @@
+// Copyright © 2015 Erik Brady <brady@dvln.org>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmds
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	globs "github.com/dvln/viper"
+)
+
+// restRequest runs the given REST request against our endpoints
+func restRequest(method string, target string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, nil)
+	w := httptest.NewRecorder()
+	mux := http.NewServeMux()
+	for path, endpoint := range restEndpoints {
+		mux.Handle(path, endpoint)
+	}
+	mux.ServeHTTP(w, req)
+	return w
+}
+
+func TestRESTRequestChecks(t *testing.T) {
+	os.Setenv("PKG_OUT_NO_EXIT", "1")
+	defer os.Setenv("PKG_OUT_NO_EXIT", "0")
+	tests := []struct {
+		method string
+		target string
+		status int
+	}{
+		{"GET", "/version", http.StatusOK},
+		{"GET", "/get", http.StatusMethodNotAllowed},
+		{"POST", "/status", http.StatusMethodNotAllowed},
+		{"GET", "/status?bogus=1", http.StatusBadRequest},
+		{"GET", "/version?wkspcdir=.", http.StatusBadRequest},
+		{"GET", "/version?verbose=maybe", http.StatusBadRequest},
+		{"GET", "/nosuchcmd", http.StatusNotFound},
+	}
+	for _, test := range tests {
+		if w := restRequest(test.method, test.target); w.Code != test.status {
+			t.Errorf("%s %s: got HTTP status %d, want %d", test.method, test.target, w.Code, test.status)
+		}
+	}
+}
+
+// TestRESTBadSettings checks bad setting values given as query params fail
+// the request with the issue code they'd get on the command line
+func TestRESTBadSettings(t *testing.T) {
+	os.Setenv("PKG_OUT_NO_EXIT", "1")
+	defer os.Setenv("PKG_OUT_NO_EXIT", "0")
+	tests := []struct {
+		target string
+		code   int
+	}{
+		{"/version?jobs=lots", 2003},
+		{"/version?jobs=-", 2003},
+		{"/version?fatalon=x", 2044},
+	}
+	for _, test := range tests {
+		w := restRequest("GET", test.target)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("GET %s: got HTTP status %d, want %d", test.target, w.Code, http.StatusBadRequest)
+		}
+		if body := w.Body.String(); !strings.Contains(body, strconv.Itoa(test.code)) {
+			t.Errorf("GET %s: response doesn't have issue code %d: %s", test.target, test.code, body)
+		}
+	}
+	if jobs := globs.GetString("jobs"); jobs == "lots" || jobs == "-" {
+		t.Errorf("Bad request setting was not restored, jobs: %s", jobs)
+	}
+}
+
+func TestRESTServeRoot(t *testing.T) {
+	os.Setenv("PKG_OUT_NO_EXIT", "1")
+	defer os.Setenv("PKG_OUT_NO_EXIT", "0")
+	root, err := ioutil.TempDir("", "dvln-serve-")
+	if err != nil {
+		t.Fatalf("Unable to create a temp serve root: %s", err)
+	}
+	defer os.RemoveAll(root)
+	snap := snapshotGlobs()
+	defer snap.restore()
+	setGlob("serveroot", root, "test")
+	outside := filepath.Dir(root)
+	for _, dir := range []string{outside, filepath.Join(root, ".."), "/"} {
+		if w := restRequest("GET", "/status?wkspcdir="+dir); w.Code != http.StatusForbidden {
+			t.Errorf("Workspace dir %s outside of the serve root: got HTTP status %d, want %d", dir, w.Code, http.StatusForbidden)
+		}
+	}
+	if err = checkServeRoot(filepath.Join(root, "ws", "sub")); err != nil {
+		t.Errorf("Workspace dir within the serve root refused: %s", err)
+	}
+	link := filepath.Join(root, "escape")
+	if os.Symlink(outside, link) == nil {
+		if err = checkServeRoot(filepath.Join(link, "ws")); err == nil {
+			t.Errorf("Workspace dir %s symlinked outside of the serve root accepted", link)
+		}
+	}
+}
+
+func TestRESTSettingsRestored(t *testing.T) {
+	os.Setenv("PKG_OUT_NO_EXIT", "1")
+	defer os.Setenv("PKG_OUT_NO_EXIT", "0")
+	verbose := globs.GetBool("verbose")
+	if w := restRequest("GET", "/version?verbose=true&jobs=3"); w.Code != http.StatusOK {
+		t.Fatalf("GET /version: got HTTP status %d, want %d", w.Code, http.StatusOK)
+	}
+	if globs.GetBool("verbose") != verbose || globs.GetString("jobs") == "3" {
+		t.Errorf("Request settings were not restored, verbose: %v, jobs: %s", globs.GetBool("verbose"), globs.GetString("jobs"))
+	}
+	_, _, scope := globs.Desc("jobs")
+	if source := globSource("jobs", scope); source == "rest:jobs" {
+		t.Errorf("Request setting source was not restored, jobs source: %s", source)
+	}
+}
@@ -0,0 +1,306 @@
+// Copyright © 2015 Erik Brady <brady@dvln.org>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package cmds status.go module implements the 'dvln status' subcommand
+// framework for the 'cli' (aka: cobra) package.  What's up in my workspace?
+package cmds
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	cli "github.com/dvln/cobra"
+	"github.com/dvln/out"
+	globs "github.com/dvln/viper"
+	"github.com/dvln/wkspc"
+)
+
+var statusCmd = &cli.Command{
+	Use:   "status",
+	Short: "show package status within a workspace",
+	Long: `Show the state of each package in a workspace (revision, local mods,
+ahead/behind the devline version) and any untracked packages, eg:
+  % dvln status
+  % dvln status --terse       (one line per package)
+  % dvln status -v -Ljson     (full details in JSON)
+  % dvln status -Ltable       (one row per package, in columns)
+Note: ahead/behind is relative to the last fetch of each package`,
+	Run: status,
+}
+
+// pkgStatus is the state of a single package within the workspace
+type pkgStatus struct {
+	Name     string
+	Path     string
+	State    string // clean, modified, missing, untracked or error
+	Revision string
+	Version  string
+	Ahead    int
+	Behind   int
+	Modified []string
+	Err      error
+	Code     int // the issue code of Err
+}
+
+// init bootstraps the options used for the status subcommand and descriptions
+// and initial defaults for those options and such.
+func init() {
+	reloadCLIFlags := false
+	setupStatusCmdCLIArgs(statusCmd, reloadCLIFlags)
+}
+
+// setupStatusCmdCLIArgs is used from init() to set up the 'globs' (viper) pkg
+// CLI options available to this subcommand (other options were already set up
+// in the "parent" dvln subcommand in a like-named method). Every subcommand
+// has a like named method "setup<subcmd>CmdCLIArgs()", called in init() above
+// and called from dvln.go
+func setupStatusCmdCLIArgs(c *cli.Command, reloadCLIFlags bool) {
+	var desc string
+	if reloadCLIFlags {
+		c.Flags().SetDefValueReparseOK(true)
+	}
+	desc, _, _ = globs.Desc("pkg")
+	c.Flags().StringP("pkg", "p", globs.GetString("pkg"), desc)
+	c.Run = status
+	// NewCLIOpts: if there were opts for the subcmd set them here and note that
+	// "persistent" opts are set in cmds/dvln.go, only opts specific to the
+	// 'dvln status' subcommand are set here
+	// Note that you'll need to modify cmds/global.go as well otherwise your
+	// globs.Desc() call and globs.GetBool("myopt") will not work.
+	if reloadCLIFlags {
+		c.Flags().SetDefValueReparseOK(false)
+	}
+}
+
+// status defines the 'dvln status' sub-command, it gathers the state of each
+// package in the workspace (in parallel, see jobs.go) and then reports it
+// based on the terse/verbose and text/json output settings
+func status(cmd *cli.Command, args []string) {
+	out.Debugln("Initialization done, firing up status()")
+	errExit := int(out.ErrorExitVal())
+	wkspcRootDir, err := wkspc.RootDir()
+	if err != nil {
+		out.ErrorExit(errExit, out.WrapErr(err, "Unexpected problem scanning for a workspace", 2006))
+		return
+	}
+	if wkspcRootDir == "" {
+		out.ErrorExit(errExit, out.NewErr("No workspace found, use 'dvln get' or 'dvln init' to create one", 2016))
+		return
+	}
+	info, allPkgs, err := wkspcRecordedPkgs(wkspcRootDir)
+	if err != nil {
+		out.ErrorExit(errExit, err)
+		return
+	}
+	selector := globs.GetString("pkg")
+	pkgs, err := selectWkspcPkgs(wkspcRootDir, info, allPkgs, selector)
+	if err != nil {
+		out.ErrorExit(errExit, err)
+		return
+	}
+
+	// Each job writes only to it's own slot so no locking is needed here
+	statuses := make([]*pkgStatus, len(pkgs))
+	pkgIdx := make(map[string]int, len(pkgs))
+	for i, p := range pkgs {
+		pkgIdx[p.Name] = i
+	}
+	results, budgetHit := runPkgJobs(pkgs, func(ctx context.Context, p *resolvedPkg) *pkgResult {
+		st := getPkgStatus(ctx, wkspcRootDir, p)
+		statuses[pkgIdx[p.Name]] = st
+		r := &pkgResult{Name: p.Name, Action: st.State}
+		if st.Err != nil {
+			return r.failed(st.Code, st.Err)
+		}
+		return r
+	}, func(r *pkgResult) {})
+	for i, st := range statuses {
+		if st == nil {
+			statuses[i] = &pkgStatus{Name: pkgs[i].Name, Path: pkgs[i].Path, State: "unknown", Version: pkgs[i].Version}
+		}
+	}
+	if selector == "" {
+		for _, path := range findUntrackedPkgs(wkspcRootDir, allPkgs) {
+			statuses = append(statuses, &pkgStatus{Name: path, Path: path, State: "untracked"})
+		}
+	}
+	showPkgStatus(statuses)
+	// Like the other package commands, any failed package (or reaching the
+	// fatalon limit) means a non-zero exit once the statuses are shown
+	if failErr := pkgResultsErr(results, budgetHit); failErr != nil {
+		if lookIsStructured() {
+			out.Exit(errExit)
+		} else {
+			out.ErrorExit(errExit, failErr)
+		}
+	}
+}
+
+// getPkgStatus gathers the state of a single package, it's run as one of the
+// parallel package jobs (see jobs.go) so it must not print anything itself
+func getPkgStatus(ctx context.Context, wkspcRootDir string, p *resolvedPkg) *pkgStatus {
+	st := &pkgStatus{Name: p.Name, Path: p.Path, Version: p.Version}
+	pkgDir, err := wkspcPkgDir(wkspcRootDir, p.Path)
+	if err != nil {
+		st.State = "error"
+		st.Err = err
+		st.Code = 2041
+		return st
+	}
+	if _, err := os.Stat(pkgDir); os.IsNotExist(err) {
+		st.State = "missing"
+		return st
+	}
+	if st.Revision, err = vcsRevision(ctx, p, pkgDir); err == nil {
+		if st.Modified, err = vcsModified(ctx, p, pkgDir); err == nil {
+			st.Ahead, st.Behind, err = vcsAheadBehind(ctx, p, pkgDir)
+		}
+	}
+	switch {
+	case err != nil:
+		st.State = "error"
+		st.Err = err
+		st.Code = 2015
+	case len(st.Modified) != 0:
+		st.State = "modified"
+	default:
+		st.State = "clean"
+	}
+	return st
+}
+
+// findUntrackedPkgs scans the workspace for VCS repos that aren't one of the
+// given (known) packages, returns their workspace relative paths.  Only the
+// workspace root and the dirs leading to known packages are scanned, so a
+// repo is found if it sits next to a known package (or at the top of the
+// workspace), we never descend into packages or unrelated dir trees.
+func findUntrackedPkgs(wkspcRootDir string, known []*resolvedPkg) []string {
+	knownPaths := make(map[string]bool, len(known)+1)
+	parentPaths := make(map[string]bool)
+	for _, p := range known {
+		pkgPath := filepath.Clean(p.Path)
+		knownPaths[pkgPath] = true
+		for dir := filepath.Dir(pkgPath); dir != "." && dir != string(filepath.Separator); dir = filepath.Dir(dir) {
+			parentPaths[dir] = true
+		}
+	}
+	knownPaths[globs.GetString("wkspcMetaDir")] = true
+	var untracked []string
+	var scan func(relDir string)
+	scan = func(relDir string) {
+		entries, err := ioutil.ReadDir(filepath.Join(wkspcRootDir, relDir))
+		if err != nil {
+			return
+		}
+		for _, entry := range entries {
+			relPath := filepath.Join(relDir, entry.Name())
+			switch {
+			case !entry.IsDir() || knownPaths[relPath]:
+			case isVCSRepo(filepath.Join(wkspcRootDir, relPath)):
+				untracked = append(untracked, relPath)
+			case parentPaths[relPath]:
+				scan(relPath)
+			}
+		}
+	}
+	scan("")
+	return untracked
+}
+
+// isVCSRepo returns true if the given dir is the top of a VCS repo (of any
+// of the VCS types dvln supports)
+func isVCSRepo(dir string) bool {
+	for _, vcsDir := range []string{".git", ".hg", ".svn", ".bzr"} {
+		if _, err := os.Stat(filepath.Join(dir, vcsDir)); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// showPkgStatus dumps the given package statuses in text or structured form, the
+// amount of detail depends upon the terse and verbose settings
+func showPkgStatus(statuses []*pkgStatus) {
+	verbosity := lookVerbosity()
+	if lookIsStructured() {
+		fields, items := statusItems(statuses, verbosity)
+		output, fatalProblem := renderItems("dvlnStatus", "status", verbosity, fields, items)
+		out.Print(output)
+		if fatalProblem {
+			out.Exit(-1)
+		}
+		return
+	}
+	for _, st := range statuses {
+		if st.Err != nil {
+			out.Issueln(st.Err)
+		}
+		switch verbosity {
+		case "terse":
+			out.Printf("%s: %s\n", st.Name, st.State)
+		case "verbose":
+			out.Printf("%s:\n", st.Name)
+			out.Printf("  Path:     %s\n", st.Path)
+			out.Printf("  State:    %s\n", st.State)
+			out.Printf("  Revision: %s\n", st.Revision)
+			out.Printf("  Version:  %s\n", st.Version)
+			out.Printf("  Ahead:    %d\n", st.Ahead)
+			out.Printf("  Behind:   %d\n", st.Behind)
+			for _, mod := range st.Modified {
+				out.Printf("  Modified: %s\n", strings.TrimSpace(mod))
+			}
+		default:
+			rev := st.Revision
+			if len(rev) > 10 {
+				rev = rev[:10]
+			}
+			out.Printf("%-24s %-10s %-10s ahead %d, behind %d (version: %s)\n", st.Name, rev, st.State, st.Ahead, st.Behind, st.Version)
+		}
+	}
+}
+
+// statusItems returns the fields and items for the structured (json, yaml,
+// table) form of the given package statuses at the given verbosity
+func statusItems(statuses []*pkgStatus, verbosity string) ([]string, []interface{}) {
+	fields := []string{"name", "state"}
+	if verbosity != "terse" {
+		fields = append(fields, "revision", "version", "ahead", "behind")
+	}
+	if verbosity == "verbose" {
+		fields = append(fields, "path", "modified")
+	}
+	fields = append(fields, "errCode", "errMsg")
+	items := make([]interface{}, 0, len(statuses))
+	for _, st := range statuses {
+		item := map[string]interface{}{"name": st.Name, "state": st.State}
+		if verbosity != "terse" {
+			item["revision"] = st.Revision
+			item["version"] = st.Version
+			item["ahead"] = st.Ahead
+			item["behind"] = st.Behind
+		}
+		if verbosity == "verbose" {
+			item["path"] = st.Path
+			item["modified"] = st.Modified
+		}
+		if st.Err != nil {
+			item["errCode"] = st.Code
+			item["errMsg"] = st.Err.Error()
+		}
+		items = append(items, item)
+	}
+	return fields, items
+}
@@ -0,0 +1,97 @@
+// Copyright © 2015 Erik Brady <brady@dvln.org>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmds
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/dvln/yaml"
+)
+
+// mkTestDirs creates the given workspace relative dirs under root
+func mkTestDirs(t *testing.T, root string, dirs ...string) {
+	for _, dir := range dirs {
+		if err := os.MkdirAll(filepath.Join(root, filepath.FromSlash(dir)), 0755); err != nil {
+			t.Fatalf("Unable to create test dir %s: %s", dir, err)
+		}
+	}
+}
+
+func TestFindUntrackedPkgs(t *testing.T) {
+	root, err := ioutil.TempDir("", "dvln-status-")
+	if err != nil {
+		t.Fatalf("Unable to create a temp workspace: %s", err)
+	}
+	defer os.RemoveAll(root)
+	mkTestDirs(t, root,
+		".dvln/stash/old/.git", // metadata dir, never scanned
+		"app/.git",             // known
+		"app/vendor/dep/.git",  // within a known package, not scanned
+		"lib/net/.git",         // known
+		"lib/extra/.git",       // next to a known package: untracked
+		"tools/.hg",            // at the top of the workspace: untracked
+		"docs/site/.git",       // in an unrelated tree, not scanned
+		"lib/net-old/src/.git") // below a dir that's not a package parent
+	known := []*resolvedPkg{{Name: "app", Path: "app"}, {Name: "net", Path: "lib/net"}}
+	got := findUntrackedPkgs(root, known)
+	want := []string{filepath.Join("lib", "extra"), "tools"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Untracked packages: got %v, want %v", got, want)
+	}
+	if got = findUntrackedPkgs(root, nil); !reflect.DeepEqual(got, []string{"app", "tools"}) {
+		t.Fatalf("Untracked packages with none known: got %v, want [app tools]", got)
+	}
+}
+
+// TestStatusItems checks a package that failed has it's error in the
+// structured status output, at every verbosity
+func TestStatusItems(t *testing.T) {
+	snap := snapshotGlobs()
+	defer snap.restore()
+	setGlob("look", "yaml", "test")
+	statuses := []*pkgStatus{
+		{Name: "net", Path: "lib/net", State: "clean", Revision: "4f2a9c1", Version: "main"},
+		{Name: "utils", Path: "utils", State: "error", Err: errors.New("exit status 128"), Code: 2015},
+	}
+	for _, verbosity := range []string{"terse", "regular", "verbose"} {
+		fields, items := statusItems(statuses, verbosity)
+		output, fatal := renderItems("dvlnStatus", "status", verbosity, fields, items)
+		var resp struct {
+			Data struct {
+				Items []map[string]interface{} `yaml:"items"`
+			} `yaml:"data"`
+		}
+		if err := yaml.Unmarshal([]byte(output), &resp); fatal || err != nil || len(resp.Data.Items) != 2 {
+			t.Errorf("%s: bad status output (fatal: %v, err: %v):\n%s", verbosity, fatal, err, output)
+			continue
+		}
+		if _, ok := resp.Data.Items[0]["errMsg"]; ok {
+			t.Errorf("%s: clean package has an error: %v", verbosity, resp.Data.Items[0])
+		}
+		if item := resp.Data.Items[1]; item["errMsg"] != "exit status 128" || item["errCode"] != 2015 {
+			t.Errorf("%s: failed package error not shown: %v", verbosity, item)
+		}
+	}
+	setGlob("look", "table", "test")
+	fields, items := statusItems(statuses, "terse")
+	if output, _ := renderItems("dvlnStatus", "status", "terse", fields, items); !strings.Contains(output, "utils  error  2015     exit status 128") {
+		t.Errorf("Table status output doesn't have the error:\n%s", output)
+	}
+}
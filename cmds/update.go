@@ -16,18 +16,31 @@
 package cmds
 
 import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
 	cli "github.com/dvln/cobra"
 	"github.com/dvln/out"
 	globs "github.com/dvln/viper"
+	"github.com/dvln/wkspc"
 )
 
 var updateCmd = &cli.Command{
 	Use:   "update",
 	Short: "update/add/remove packages (dynamically or based on a devline)",
-	Long: `Update/add/remove packages in a workspace dynamically or based ona devline, eg:
+	Long: `Update/add/remove packages in a workspace dynamically or based on a devline, eg:
   % dvln update --devline=proj_x
   % dvln update -d proj_x
-  % dvln u    (will update using versions from the workspaces current base devline)`,
+  % dvln update -d proj_x --prune  (remove pkgs no longer in the devline)
+  % dvln u    (will update using versions from the workspaces current base devline)
+  % dvln update -i   (ask what to do about pkgs with local changes)
+Packages dropped from the devline are left in place (orphaned) unless --prune is used,
+packages with local changes are not updated or removed unless --interact|-i is used
+to choose (skip, stash, force or abort) or --force is used`,
 	Run: update,
 }
 
@@ -52,6 +65,8 @@ func setupUpdateCmdCLIArgs(c *cli.Command, reloadCLIFlags bool) {
 	c.Flags().StringP("devline", "d", globs.GetString("devline"), desc)
 	desc, _, _ = globs.Desc("pkg")
 	c.Flags().StringP("pkg", "p", globs.GetString("pkg"), desc)
+	desc, _, _ = globs.Desc("prune")
+	c.Flags().Bool("prune", globs.GetBool("prune"), desc)
 	c.Run = update
 	// NewCLIOpts: if there were opts for the subcmd set them here and note that
 	// "persistent" opts are set in cmds/dvln.go, only opts specific to the
@@ -65,11 +80,272 @@ func setupUpdateCmdCLIArgs(c *cli.Command, reloadCLIFlags bool) {
 
 // update defines the 'dvln update' sub-command in terms of it's options and making
 // sure global config is setup correctly with all settings/controls the user
-// requsted via the CLI
+// requsted via the CLI.  It compares the packages in the workspace to those
+// in the target devline (--devline or the workspaces recorded base devline)
+// and then adds new packages, updates existing ones and removes (--prune) or
+// orphans packages that have been dropped from the devline.
 func update(cmd *cli.Command, args []string) {
 	out.Debugln("Initialization done, firing up update()")
-	out.Println("Look up devline")
-	//devline := cmd.Flags().Lookup("devline").Value.String()
+	errExit := int(out.ErrorExitVal())
+	wkspcRootDir, err := wkspc.RootDir()
+	if err != nil {
+		out.ErrorExit(errExit, out.WrapErr(err, "Unexpected problem scanning for a workspace", 2006))
+		return
+	}
+	if wkspcRootDir == "" {
+		out.ErrorExit(errExit, out.NewErr("No workspace found to update, use 'dvln get' or 'dvln init' to create one", 2016))
+		return
+	}
+	out.Debugln("Workspace root:", wkspcRootDir)
+	info, err := readWkspcInfo(wkspcRootDir)
+	if err != nil {
+		out.ErrorExit(errExit, err)
+		return
+	}
+	codebase := info.Codebase
+	if codebase == "" {
+		codebase = globs.GetString("codebase")
+	}
 	devline := globs.GetString("devline")
-	out.Printf("Updateing packages based on devline %s\n", devline)
+	if devline == "" {
+		devline = info.Devline
+	}
+	out.Debugf("Updating packages based on codebase %s, devline %s\n", codebase, devline)
+	cb, err := loadCodebase(codebase)
+	if err != nil {
+		out.ErrorExit(errExit, err)
+		return
+	}
+	// What the workspace has now comes from the workspace manifest, that's
+	// read first so the target devline settings are the ones merged last
+	_, current, err := wkspcRecordedPkgs(wkspcRootDir)
+	if err != nil {
+		out.ErrorExit(errExit, err)
+		return
+	}
+	target, origins, err := resolveDevlineChain(cb, devline)
+	if err != nil {
+		out.ErrorExit(errExit, err)
+		return
+	}
+	showPkgOrigins(target, origins)
+	if info.Devline != "" && devline != info.Devline {
+		if err = checkLocalBranches(wkspcRootDir, current, info.Devline, devline); err != nil {
+			out.ErrorExit(errExit, err)
+			return
+		}
+	}
+	diff := diffPkgs(current, target)
+	out.Debugf("Devline diff: %d added, %d changed, %d same, %d dropped\n", len(diff.Added), len(diff.Changed), len(diff.Same), len(diff.Removed))
+
+	// Packages already left in place as orphans by an earlier update are
+	// only worked on again if pruning
+	prune := globs.GetBool("prune")
+	m, err := readManifest(wkspcRootDir)
+	if err != nil {
+		out.ErrorExit(errExit, err)
+		return
+	}
+	dropped := make(map[string]bool, len(diff.Removed))
+	pkgs := append([]*resolvedPkg{}, target...)
+	for _, p := range diff.Removed {
+		if mp := m.pkg(p.Name); mp != nil && mp.Orphan && !prune {
+			out.Debugf("Package %s: already an orphan, left in place\n", p.Name)
+			continue
+		}
+		dropped[p.Name] = true
+		pkgs = append(pkgs, p)
+	}
+	selector := globs.GetString("pkg")
+	if pkgs, err = selectPkgs(pkgs, selector, cb, wkspcRootDir); err != nil {
+		out.ErrorExit(errExit, err)
+		return
+	}
+	mr, err := newManifestRecorder(wkspcRootDir, pkgs, dropped)
+	if err != nil {
+		out.ErrorExit(errExit, err)
+		return
+	}
+	pp := newPkgPrompter()
+	results, budgetHit := runPkgJobs(pkgs, func(ctx context.Context, p *resolvedPkg) *pkgResult {
+		if pp.isAborted() {
+			return &pkgResult{Name: p.Name, Action: "aborted"}
+		}
+		if dropped[p.Name] {
+			return dropPkg(ctx, wkspcRootDir, p, prune, pp)
+		}
+		return updatePkg(ctx, wkspcRootDir, p, pp)
+	}, mr.reporter(pp.reporter(reportPkgResult)))
+	if mr.err != nil {
+		out.ErrorExit(errExit, mr.err)
+		return
+	}
+	if exitVal := finishPkgJobs("dvlnUpdate", results, budgetHit); exitVal != 0 {
+		return
+	}
+	if pp.isAborted() {
+		out.ErrorExit(errExit, out.NewErr("Update aborted, the workspace may be partially updated", 2032))
+		return
+	}
+	// only a full update moves the workspace to the new devline/codebase,
+	// packages left alone (kept) mean the workspace isn't fully there yet
+	if selector == "" && (devline != info.Devline || cb.Name != info.Codebase) {
+		for _, r := range results {
+			if r.Action == "kept" {
+				out.Notef("Package %s was kept as is, the workspace stays on devline %s until it's updated\n", r.Name, info.Devline)
+				return
+			}
+		}
+		if err = writeWkspcInfo(wkspcRootDir, &wkspcInfo{Codebase: cb.Name, Devline: devline}); err != nil {
+			out.ErrorExit(errExit, err)
+		}
+	}
+}
+
+// updatePkg brings a single package in the workspace in line with the
+// devline, cloning it if it's not there yet.  If the package has local
+// changes the prompter decides what to do about them.  It's run as one of
+// the parallel package jobs (see jobs.go) so it must not print anything
+// itself (other than prompting).
+func updatePkg(ctx context.Context, wkspcRootDir string, p *resolvedPkg, pp *pkgPrompter) *pkgResult {
+	pkgDir, err := wkspcPkgDir(wkspcRootDir, p.Path)
+	if err != nil {
+		return (&pkgResult{Name: p.Name}).failed(2041, err)
+	}
+	if _, err := os.Stat(pkgDir); os.IsNotExist(err) {
+		r := getPkg(ctx, wkspcRootDir, p)
+		if r.Err == nil {
+			r.Action = "added"
+		}
+		return r
+	}
+	r := &pkgResult{Name: p.Name, Action: "current"}
+	dirty, err := vcsIsDirty(ctx, p, pkgDir)
+	if err != nil {
+		return r.failed(2015, err)
+	}
+	if dirty {
+		switch pp.localWork(r, p, "update", "has local changes", protectDirtyPkg) {
+		case choiceStash:
+			if err = vcsStash(ctx, p, pkgDir); err != nil {
+				return r.failed(2013, err)
+			}
+			r.Msgs = append(r.Msgs, "local changes stashed")
+		case choiceForce:
+			if err = vcsRevert(ctx, p, pkgDir); err != nil {
+				return r.failed(2013, err)
+			}
+			r.Msgs = append(r.Msgs, "local changes discarded (forced)")
+		default:
+			r.Revision, _ = vcsRevision(ctx, p, pkgDir)
+			return r
+		}
+	}
+	changed, err := vcsUpdate(ctx, p, pkgDir)
+	if err != nil {
+		return r.failed(2013, err)
+	}
+	if changed {
+		r.Action = "updated"
+		r.Msgs = append(r.Msgs, fmt.Sprintf("now at version \"%s\"", p.Version))
+	}
+	r.Revision, _ = vcsRevision(ctx, p, pkgDir)
+	return r
+}
+
+// dropPkg deals with a package that is no longer in the devline, if pruning
+// it is removed from the workspace (if it has local changes or unpushed
+// revisions the prompter decides what to do), otherwise it's left in place
+// as an orphan.  It's run as one of the parallel package jobs (see jobs.go)
+// so it must not print anything itself (other than prompting).
+func dropPkg(ctx context.Context, wkspcRootDir string, p *resolvedPkg, prune bool, pp *pkgPrompter) *pkgResult {
+	r := &pkgResult{Name: p.Name, Action: "orphaned"}
+	pkgDir, err := wkspcPkgDir(wkspcRootDir, p.Path)
+	if err != nil {
+		return r.failed(2041, err)
+	}
+	if _, err := os.Stat(pkgDir); os.IsNotExist(err) {
+		r.Action = "gone"
+		return r
+	}
+	if !prune {
+		r.Msgs = append(r.Msgs, "no longer in the devline, left in place (use --prune to remove)")
+		return r
+	}
+	dirty, err := vcsIsDirty(ctx, p, pkgDir)
+	if err != nil {
+		return r.failed(2015, err)
+	}
+	unpushed, err := vcsUnpushed(ctx, p, pkgDir)
+	if err != nil {
+		return r.failed(2015, err)
+	}
+	choice := choiceForce
+	switch {
+	case dirty:
+		choice = pp.localWork(r, p, "removal", "has local changes", protectDirtyPkg)
+	case unpushed != 0:
+		problem := fmt.Sprintf("has %d revision(s) not pushed to it's remote", unpushed)
+		choice = pp.localWork(r, p, "removal", problem, protectUnpushed)
+	}
+	if choice == choiceStash {
+		// stashing within the package would be removed with it, so the
+		// package is moved aside into the workspace metadata dir instead
+		stashDir := filepath.Join(wkspcMetaDirPath(wkspcRootDir), "stash", fmt.Sprintf("%s.%d", p.Path, time.Now().Unix()))
+		if err = os.MkdirAll(filepath.Dir(stashDir), 0755); err == nil {
+			err = os.Rename(pkgDir, stashDir)
+		}
+		if err != nil {
+			return r.failed(2017, out.WrapErr(err, fmt.Sprintf("Package %s: unable to move it aside", p.Name), 2017))
+		}
+		r.Action = "removed"
+		r.Msgs = append(r.Msgs, "moved aside to "+stashDir)
+		return r
+	}
+	if choice != choiceForce {
+		return r
+	}
+	if err = os.RemoveAll(pkgDir); err != nil {
+		return r.failed(2017, out.WrapErr(err, fmt.Sprintf("Package %s: removal failed", p.Name), 2017))
+	}
+	r.Action = "removed"
+	return r
+}
+
+// checkLocalBranches refuses (unless forced) to switch the workspace from
+// one devline to another if any package has local branches with revisions
+// not on the remote, as that work is easily forgotten once switched away
+func checkLocalBranches(wkspcRootDir string, pkgs []*resolvedPkg, from string, to string) error {
+	if forced() {
+		return nil
+	}
+	results, _ := runQuietPkgJobs(pkgs, func(ctx context.Context, p *resolvedPkg) *pkgResult {
+		r := &pkgResult{Name: p.Name, Action: "checked"}
+		pkgDir, err := wkspcPkgDir(wkspcRootDir, p.Path)
+		if err != nil {
+			return r.failed(2041, err)
+		}
+		if _, err := os.Stat(pkgDir); os.IsNotExist(err) {
+			return r
+		}
+		branches, err := vcsLocalBranches(ctx, p, pkgDir)
+		if err != nil {
+			return r.failed(2015, err)
+		}
+		r.Msgs = branches
+		return r
+	})
+	var stranded []string
+	for _, r := range results {
+		if r.Err != nil {
+			return r.Err
+		}
+		if len(r.Msgs) != 0 {
+			stranded = append(stranded, fmt.Sprintf("%s (%s)", r.Name, strings.Join(r.Msgs, ", ")))
+		}
+	}
+	if len(stranded) == 0 {
+		return nil
+	}
+	return protectSwitch.refuse(fmt.Sprintf("Switching from devline %s to %s but these packages have local branches not on their remote: %s", from, to, strings.Join(stranded, "; ")))
 }
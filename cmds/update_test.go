@@ -0,0 +1,184 @@
+// Copyright © 2015 Erik Brady <brady@dvln.org>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmds
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestCheckLocalBranches checks a package with a local only branch stops a
+// devline switch and that the check emits no events of its own
+func TestCheckLocalBranches(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	root, err := ioutil.TempDir("", "dvlnbranches")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	remote := filepath.Join(root, "remote")
+	testGit(t, root, "init", "-q", "-b", "main", remote)
+	testGit(t, remote, "commit", "-q", "--allow-empty", "-m", "one")
+	wkspcRootDir := filepath.Join(root, "ws")
+	testGit(t, root, "clone", "-q", remote, filepath.Join(wkspcRootDir, "net"))
+	testGit(t, root, "clone", "-q", remote, filepath.Join(wkspcRootDir, "utils"))
+	netDir := filepath.Join(wkspcRootDir, "net")
+	testGit(t, netDir, "checkout", "-q", "-b", "wip")
+	testGit(t, netDir, "commit", "-q", "--allow-empty", "-m", "local")
+
+	pkgs := []*resolvedPkg{
+		{Name: "net", Path: "net", VCS: "git", Remote: remote, Version: "main"},
+		{Name: "utils", Path: "utils", VCS: "git", Remote: remote, Version: "main"},
+		{Name: "zlib", Path: "zlib", VCS: "git", Remote: remote, Version: "main"},
+	}
+	done := captureEvents(t)
+	err = checkLocalBranches(wkspcRootDir, pkgs, "proj_a", "proj_b")
+	events := done()
+	if err == nil || !strings.Contains(err.Error(), "local branches not on their remote: net (wip)") {
+		t.Errorf("Got error %v, want the switch refused for net (wip)", err)
+	}
+	if len(events) != 0 {
+		t.Errorf("Got %d events from the local branch check, want none: %+v", len(events), events[0])
+	}
+
+	snap := snapshotGlobs()
+	defer snap.restore()
+	setGlob("force", true, "test")
+	if err = checkLocalBranches(wkspcRootDir, pkgs, "proj_a", "proj_b"); err != nil {
+		t.Errorf("Forced switch refused: %s", err)
+	}
+}
+
+// TestUpdate updates a workspace from one devline to another that adds a
+// package (docs), drops one (net) and moves one to another revision (util),
+// then prunes the dropped package.  Not knowing what's in the workspace
+// stops the update before anything is done.
+func TestUpdate(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	os.Setenv("PKG_OUT_NO_EXIT", "1")
+	defer os.Setenv("PKG_OUT_NO_EXIT", "0")
+	root, err := ioutil.TempDir("", "dvlnupdate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	remotes := make(map[string]string)
+	for _, name := range []string{"net", "util", "docs"} {
+		remotes[name] = filepath.Join(root, "remotes", name)
+		testGit(t, root, "init", "-q", "-b", "main", remotes[name])
+		testGit(t, remotes[name], "commit", "-q", "--allow-empty", "-m", "one")
+	}
+	testGit(t, remotes["util"], "checkout", "-q", "-b", "v2")
+	testGit(t, remotes["util"], "commit", "-q", "--allow-empty", "-m", "two")
+	v2 := testGit(t, remotes["util"], "rev-parse", "HEAD")
+	testGit(t, remotes["util"], "checkout", "-q", "main")
+	defs := map[string]string{
+		"cb/cb.json": fmt.Sprintf(`{"name": "cb", "packages": [
+  {"name": "net", "remote": %q, "branch": "main"},
+  {"name": "util", "remote": %q, "branch": "main"},
+  {"name": "docs", "remote": %q, "branch": "main"}]}`, remotes["net"], remotes["util"], remotes["docs"]),
+		"dl/dl1.json": `{"name": "dl1", "packages": [{"name": "net"}, {"name": "util"}]}`,
+		"dl/dl2.json": `{"name": "dl2", "packages": [{"name": "util", "version": "v2"}, {"name": "docs"}]}`,
+	}
+	for file, def := range defs {
+		file = filepath.Join(root, filepath.FromSlash(file))
+		if err = os.MkdirAll(filepath.Dir(file), 0755); err == nil {
+			err = ioutil.WriteFile(file, []byte(def), 0644)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// a workspace on devline dl1 (recorded once the manifest is written)
+	wkspcRootDir := filepath.Join(root, "ws")
+	m := &wkspcManifest{}
+	revs := make(map[string]string)
+	for _, name := range []string{"net", "util", "docs"} {
+		revs[name] = testGit(t, remotes[name], "rev-parse", "main")
+		if name != "docs" {
+			testGit(t, root, "clone", "-q", remotes[name], filepath.Join(wkspcRootDir, name))
+			m.setPkg(&resolvedPkg{Name: name, Path: name, VCS: "git", Remote: remotes[name], Version: "main"}, revs[name])
+		}
+	}
+	if err = createWkspcMetaDir(wkspcRootDir); err == nil {
+		err = writeWkspcInfo(wkspcRootDir, &wkspcInfo{Codebase: "cb", Devline: "gone"})
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(cwd)
+	if err = os.Chdir(wkspcRootDir); err != nil {
+		t.Fatal(err)
+	}
+	snap := snapshotGlobs()
+	defer snap.restore()
+	setGlob("codebasedir", filepath.Join(root, "cb"), "test")
+	setGlob("devlinedir", filepath.Join(root, "dl"), "test")
+	setGlob("look", "text", "test")
+	setGlob("devline", "dl2", "test")
+
+	// without a manifest the workspace packages come from it's recorded
+	// devline, which is gone, so what's in the workspace isn't known
+	update(updateCmd, nil)
+	if _, err = os.Stat(filepath.Join(wkspcRootDir, "docs")); !os.IsNotExist(err) {
+		t.Fatalf("Update went ahead without knowing the workspace packages")
+	}
+
+	if err = writeManifest(wkspcRootDir, m); err == nil {
+		err = writeWkspcInfo(wkspcRootDir, &wkspcInfo{Codebase: "cb", Devline: "dl1"})
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	update(updateCmd, nil)
+	if m, err = readManifest(wkspcRootDir); err != nil {
+		t.Fatal(err)
+	}
+	// docs is added, util moves to the v2 revision and net, dropped, is
+	// left in place as an orphan
+	for name, want := range map[string]string{"docs": revs["docs"], "util": v2, "net": revs["net"]} {
+		if rev := testGit(t, filepath.Join(wkspcRootDir, name), "rev-parse", "HEAD"); rev != want {
+			t.Errorf("Package %s at %s after the update, want %s", name, rev, want)
+		}
+		if mp := m.pkg(name); mp == nil || mp.Revision != want || mp.Orphan != (name == "net") {
+			t.Errorf("Package %s recorded in the manifest as %+v, want revision %s", name, mp, want)
+		}
+	}
+	if info, err := readWkspcInfo(wkspcRootDir); err != nil || info.Devline != "dl2" {
+		t.Errorf("Workspace info %+v (err: %v) after the update, want devline dl2", info, err)
+	}
+
+	setGlob("prune", true, "test")
+	update(updateCmd, nil)
+	if _, err = os.Stat(filepath.Join(wkspcRootDir, "net")); !os.IsNotExist(err) {
+		t.Errorf("Dropped package net not removed by --prune")
+	}
+	if m, err = readManifest(wkspcRootDir); err != nil || m.pkg("net") != nil {
+		t.Errorf("Dropped package net still in the manifest after --prune (err: %v)", err)
+	}
+}
@@ -0,0 +1,400 @@
+// Copyright © 2015 Erik Brady <brady@dvln.org>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package cmds vcs.go module wraps the VCS operations the dvln subcommands
+// need to run on the packages within a workspace.  Each VCS type (git, hg,
+// svn, bzr) has a driver implementing the vcsDriver interface (see the
+// vcs<type>.go files), the driver used for a package comes from the 'vcs'
+// setting for that package in the codebase definition.
+//
+// Rather than using github.com/dvln/vcs (see the Makefile) the drivers shell
+// out via runVCSCmd() here as package jobs need VCS commands that can be
+// killed when the job is cancelled (see runPkgJobs()) and that report what
+// they're running as job progress (see jobProgress()), the vcsDriver
+// interface keeps all of that in one spot should it move into that package.
+//
+// Remotes and versions come from definition files so they're checked (see
+// checkVCSArg()) before use and, where the VCS allows it, given after a "--"
+// so they can never be taken as VCS options.
+package cmds
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strings"
+
+	"github.com/dvln/out"
+)
+
+// vcsDriver is the set of VCS operations dvln needs for a package, all
+// operations take the package dir (except Clone, which creates it)
+type vcsDriver interface {
+	// Clone brings the package at remote into the given (new) dir
+	Clone(ctx context.Context, remote string, dir string) error
+	// Fetch grabs the latest changes from the remote without altering the
+	// checked out files (if the VCS can do that, else it's a no-op)
+	Fetch(ctx context.Context, dir string) error
+	// Checkout moves the package to the given version (branch, tag or
+	// revision), branches are brought up to date with the remote.  If no
+	// version is given the current branch is brought up to date.
+	Checkout(ctx context.Context, dir string, version string) error
+	// Revision returns the currently checked out revision
+	Revision(ctx context.Context, dir string) (string, error)
+	// HasRevision returns true if the given revision is in the package (as
+	// of the last Fetch)
+	HasRevision(ctx context.Context, dir string, rev string) (bool, error)
+	// Modified returns the locally modified (or untracked) files in VCS
+	// status form (eg: " M file.go"), empty if the package is clean
+	Modified(ctx context.Context, dir string) ([]string, error)
+	// AheadBehind returns the # of revisions the checked out revision is
+	// ahead of and behind the given version (as of the last Fetch)
+	AheadBehind(ctx context.Context, dir string, version string) (int, int, error)
+	// Tags returns the tags available for the package
+	Tags(ctx context.Context, dir string) ([]string, error)
+	// Branches returns the (remote) branches available for the package
+	Branches(ctx context.Context, dir string) ([]string, error)
+	// LocalBranches returns the local branches with revisions that are not
+	// on the remote (as of the last Fetch)
+	LocalBranches(ctx context.Context, dir string) ([]string, error)
+	// Unpushed returns the # of local revisions (on any branch) that are
+	// not on the remote (as of the last Fetch)
+	Unpushed(ctx context.Context, dir string) (int, error)
+	// Stash sets aside local modifications (including untracked files) so
+	// they can be brought back later, leaving the package clean
+	Stash(ctx context.Context, dir string) error
+	// Revert throws away local modifications (including untracked files)
+	Revert(ctx context.Context, dir string) error
+	// RemoteRefs returns the tags and branches (mapped to the revision each
+	// refers to) available from the remote, without needing a local clone,
+	// the remote's default branch (if known) is included as "HEAD"
+	RemoteRefs(ctx context.Context, remote string) (map[string]string, map[string]string, error)
+}
+
+// errVCSUnsupported is returned by drivers for operations their VCS has no
+// reasonable way of doing
+var errVCSUnsupported = errors.New("operation not supported by this VCS")
+
+// vcsDrivers are the available VCS drivers, keyed on the codebase VCS type
+var vcsDrivers = map[string]vcsDriver{
+	"bzr": bzrDriver{},
+	"git": gitDriver{},
+	"hg":  hgDriver{},
+	"svn": svnDriver{},
+}
+
+// vcsTypes returns the supported VCS types, sorted
+func vcsTypes() []string {
+	types := make([]string, 0, len(vcsDrivers))
+	for vcsType := range vcsDrivers {
+		types = append(types, vcsType)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// checkVCSArg returns an error if the given value (a remote or a version,
+// tag or branch) could be taken as an option by a VCS command
+func checkVCSArg(value string) error {
+	if strings.HasPrefix(strings.TrimSpace(value), "-") {
+		return fmt.Errorf("\"%s\" starts with \"-\" so it would be taken as a VCS option", value)
+	}
+	return nil
+}
+
+// vcsDriverFor returns the VCS driver for the given package, the package
+// remote and version are checked as they're passed to the VCS commands
+func vcsDriverFor(p *resolvedPkg) (vcsDriver, error) {
+	drv, ok := vcsDrivers[p.VCS]
+	if !ok {
+		return nil, out.NewErr(fmt.Sprintf("Package %s: VCS type \"%s\" is not supported (supported: %s)", p.Name, p.VCS, strings.Join(vcsTypes(), ", ")), 2013)
+	}
+	for _, arg := range []string{p.Remote, p.Version} {
+		if err := checkVCSArg(arg); err != nil {
+			return nil, out.NewErr(fmt.Sprintf("Package %s: %s", p.Name, err), 2013)
+		}
+	}
+	return drv, nil
+}
+
+// runVCSCmd runs the given VCS command in the given dir, on failure the
+// returned error includes whatever the VCS command had to say about it.  If
+// the context is cancelled the VCS command is killed and the error returned
+// wraps the context error (so it can be told apart from a real failure).
+func runVCSCmd(ctx context.Context, dir string, name string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Dir = dir
+	out.Tracef("Running VCS cmd in %s: %s %s\n", dir, name, strings.Join(args, " "))
+	jobProgress(ctx, "%s %s", name, strings.Join(args, " "))
+	output, err := cmd.CombinedOutput()
+	if err != nil && ctx.Err() != nil {
+		return string(output), fmt.Errorf("%s %s: %w", name, strings.Join(args, " "), ctx.Err())
+	}
+	if err != nil {
+		return string(output), fmt.Errorf("%s %s: %s\n%s", name, strings.Join(args, " "), err, strings.TrimSpace(string(output)))
+	}
+	return string(output), nil
+}
+
+// vcsWrapErr wraps a VCS error with the given message and issue code, errors
+// due to the package job being cancelled are returned as is so runPkgJobs()
+// can tell them apart from real failures
+func vcsWrapErr(err error, msg string, code int) error {
+	if errors.Is(err, context.Canceled) {
+		return err
+	}
+	return out.WrapErr(err, msg, code)
+}
+
+// vcsLines runs the given VCS command and returns the non-empty lines of
+// output it produces (trimmed of surrounding whitespace if trim is set)
+func vcsLines(ctx context.Context, dir string, trim bool, name string, args ...string) ([]string, error) {
+	output, err := runVCSCmd(ctx, dir, name, args...)
+	if err != nil {
+		return nil, err
+	}
+	var lines []string
+	for _, line := range strings.Split(output, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if trim {
+			line = strings.TrimSpace(line)
+		}
+		lines = append(lines, line)
+	}
+	return lines, nil
+}
+
+// vcsClone clones the given package into the given wkspc dir and checks out
+// the version (branch, tag or revision) the package was resolved to
+func vcsClone(ctx context.Context, p *resolvedPkg, dir string) error {
+	drv, err := vcsDriverFor(p)
+	if err != nil {
+		return err
+	}
+	if err = drv.Clone(ctx, p.Remote, dir); err != nil {
+		return vcsWrapErr(err, fmt.Sprintf("Package %s: clone failed", p.Name), 2013)
+	}
+	if p.Version == "" {
+		return nil
+	}
+	if err = drv.Checkout(ctx, dir, p.Version); err != nil {
+		return vcsWrapErr(err, fmt.Sprintf("Package %s: checkout of version %s failed", p.Name, p.Version), 2013)
+	}
+	return nil
+}
+
+// vcsRevision returns the revision currently checked out in the given dir
+func vcsRevision(ctx context.Context, p *resolvedPkg, dir string) (string, error) {
+	drv, err := vcsDriverFor(p)
+	if err != nil {
+		return "", err
+	}
+	rev, err := drv.Revision(ctx, dir)
+	if err != nil {
+		return "", vcsWrapErr(err, fmt.Sprintf("Package %s: unable to determine revision", p.Name), 2015)
+	}
+	return rev, nil
+}
+
+// vcsHasRevision returns true if the package in the given dir has the given
+// revision (as of the last fetch)
+func vcsHasRevision(ctx context.Context, p *resolvedPkg, dir string, rev string) (bool, error) {
+	drv, err := vcsDriverFor(p)
+	if err != nil {
+		return false, err
+	}
+	if err = checkVCSArg(rev); err != nil {
+		return false, out.NewErr(fmt.Sprintf("Package %s: %s", p.Name, err), 2013)
+	}
+	found, err := drv.HasRevision(ctx, dir, rev)
+	if err != nil {
+		return false, vcsWrapErr(err, fmt.Sprintf("Package %s: unable to look for revision \"%s\"", p.Name, rev), 2015)
+	}
+	return found, nil
+}
+
+// vcsModified returns the locally modified (or untracked) files within the
+// package in the given dir, in VCS status form (eg: " M file.go")
+func vcsModified(ctx context.Context, p *resolvedPkg, dir string) ([]string, error) {
+	drv, err := vcsDriverFor(p)
+	if err != nil {
+		return nil, err
+	}
+	modified, err := drv.Modified(ctx, dir)
+	if err != nil {
+		return nil, vcsWrapErr(err, fmt.Sprintf("Package %s: unable to determine status", p.Name), 2015)
+	}
+	return modified, nil
+}
+
+// vcsIsDirty returns true if the package in the given dir has local
+// modifications (including untracked files)
+func vcsIsDirty(ctx context.Context, p *resolvedPkg, dir string) (bool, error) {
+	modified, err := vcsModified(ctx, p, dir)
+	return len(modified) != 0, err
+}
+
+// vcsAheadBehind returns how many revisions the package in the given dir is
+// ahead of and behind the version it was resolved to (as of the last fetch),
+// if the packages VCS can't tell us that then 0, 0 is returned
+func vcsAheadBehind(ctx context.Context, p *resolvedPkg, dir string) (int, int, error) {
+	drv, err := vcsDriverFor(p)
+	if err != nil {
+		return 0, 0, err
+	}
+	ahead, behind, err := drv.AheadBehind(ctx, dir, p.Version)
+	if err == errVCSUnsupported {
+		return 0, 0, nil
+	} else if err != nil {
+		return 0, 0, vcsWrapErr(err, fmt.Sprintf("Package %s: unable to compare to version \"%s\"", p.Name, p.Version), 2015)
+	}
+	return ahead, behind, nil
+}
+
+// vcsTags returns the tags available for the package in the given dir
+func vcsTags(ctx context.Context, p *resolvedPkg, dir string) ([]string, error) {
+	drv, err := vcsDriverFor(p)
+	if err != nil {
+		return nil, err
+	}
+	tags, err := drv.Tags(ctx, dir)
+	if err != nil {
+		return nil, vcsWrapErr(err, fmt.Sprintf("Package %s: unable to list tags", p.Name), 2015)
+	}
+	return tags, nil
+}
+
+// vcsBranches returns the branches available for the package in the given
+// dir, VCS types without branches (within a package) return no branches
+func vcsBranches(ctx context.Context, p *resolvedPkg, dir string) ([]string, error) {
+	drv, err := vcsDriverFor(p)
+	if err != nil {
+		return nil, err
+	}
+	branches, err := drv.Branches(ctx, dir)
+	if err == errVCSUnsupported {
+		return []string{}, nil
+	} else if err != nil {
+		return nil, vcsWrapErr(err, fmt.Sprintf("Package %s: unable to list branches", p.Name), 2015)
+	}
+	return branches, nil
+}
+
+// vcsRemoteRefs returns the tags and branches available from the packages
+// remote (each mapped to the revision it refers to)
+func vcsRemoteRefs(ctx context.Context, p *resolvedPkg) (map[string]string, map[string]string, error) {
+	drv, err := vcsDriverFor(p)
+	if err != nil {
+		return nil, nil, err
+	}
+	tags, branches, err := drv.RemoteRefs(ctx, p.Remote)
+	if err == errVCSUnsupported {
+		return nil, nil, out.NewErr(fmt.Sprintf("Package %s: %s can't list the tags and branches of a remote", p.Name, p.VCS), 2015)
+	} else if err != nil {
+		return nil, nil, vcsWrapErr(err, fmt.Sprintf("Package %s: unable to list tags and branches of remote %s", p.Name, p.Remote), 2015)
+	}
+	return tags, branches, nil
+}
+
+// vcsLocalBranches returns the branches of the package in the given dir that
+// have revisions not on the remote, VCS types that can't tell us that (or
+// without local branches) return no branches
+func vcsLocalBranches(ctx context.Context, p *resolvedPkg, dir string) ([]string, error) {
+	drv, err := vcsDriverFor(p)
+	if err != nil {
+		return nil, err
+	}
+	branches, err := drv.LocalBranches(ctx, dir)
+	if err == errVCSUnsupported {
+		return []string{}, nil
+	} else if err != nil {
+		return nil, vcsWrapErr(err, fmt.Sprintf("Package %s: unable to list local branches", p.Name), 2015)
+	}
+	return branches, nil
+}
+
+// vcsUnpushed returns the # of revisions in the package in the given dir,
+// on any local branch, that are not on the remote, VCS types that can't
+// tell us that (or without local revisions) return 0
+func vcsUnpushed(ctx context.Context, p *resolvedPkg, dir string) (int, error) {
+	drv, err := vcsDriverFor(p)
+	if err != nil {
+		return 0, err
+	}
+	unpushed, err := drv.Unpushed(ctx, dir)
+	if err == errVCSUnsupported {
+		return 0, nil
+	} else if err != nil {
+		return 0, vcsWrapErr(err, fmt.Sprintf("Package %s: unable to count unpushed revisions", p.Name), 2015)
+	}
+	return unpushed, nil
+}
+
+// vcsStash sets aside the local modifications in the package in the given
+// dir (see the VCS's stash/shelve command to get them back)
+func vcsStash(ctx context.Context, p *resolvedPkg, dir string) error {
+	drv, err := vcsDriverFor(p)
+	if err != nil {
+		return err
+	}
+	err = drv.Stash(ctx, dir)
+	if err == errVCSUnsupported {
+		return out.NewErr(fmt.Sprintf("Package %s: %s has no way to stash local changes", p.Name, p.VCS), 2013)
+	} else if err != nil {
+		return vcsWrapErr(err, fmt.Sprintf("Package %s: stash of local changes failed", p.Name), 2013)
+	}
+	return nil
+}
+
+// vcsRevert throws away the local modifications in the package in the
+// given dir, there's no getting them back
+func vcsRevert(ctx context.Context, p *resolvedPkg, dir string) error {
+	drv, err := vcsDriverFor(p)
+	if err != nil {
+		return err
+	}
+	if err = drv.Revert(ctx, dir); err != nil {
+		return vcsWrapErr(err, fmt.Sprintf("Package %s: revert of local changes failed", p.Name), 2013)
+	}
+	return nil
+}
+
+// vcsUpdate fetches the latest from the packages remote and moves the
+// package in the given dir to the version (branch, tag or revision) it was
+// resolved to, branches are brought up to date with the remote.  Returns
+// true if the checked out revision changed.
+func vcsUpdate(ctx context.Context, p *resolvedPkg, dir string) (bool, error) {
+	drv, err := vcsDriverFor(p)
+	if err != nil {
+		return false, err
+	}
+	before, err := vcsRevision(ctx, p, dir)
+	if err != nil {
+		return false, err
+	}
+	if err = drv.Fetch(ctx, dir); err != nil {
+		return false, vcsWrapErr(err, fmt.Sprintf("Package %s: fetch failed", p.Name), 2013)
+	}
+	if err = drv.Checkout(ctx, dir, p.Version); err != nil {
+		return false, vcsWrapErr(err, fmt.Sprintf("Package %s: update to version \"%s\" failed", p.Name, p.Version), 2013)
+	}
+	after, err := vcsRevision(ctx, p, dir)
+	if err != nil {
+		return false, err
+	}
+	return before != after, nil
+}
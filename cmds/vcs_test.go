@@ -0,0 +1,88 @@
+// Copyright © 2015 Erik Brady <brady@dvln.org>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmds
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestVCSArgs(t *testing.T) {
+	for _, arg := range []string{"https://example.com/x.git", "main", "v1.0", "", "a-b"} {
+		if err := checkVCSArg(arg); err != nil {
+			t.Errorf("VCS arg %q refused: %s", arg, err)
+		}
+	}
+	for _, arg := range []string{"--upload-pack=touch /tmp/x", "-b", " -x"} {
+		if err := checkVCSArg(arg); err == nil {
+			t.Errorf("VCS arg %q that looks like an option accepted", arg)
+		}
+	}
+	p := &resolvedPkg{Name: "x", VCS: "git", Remote: "--upload-pack=evil", Version: "main"}
+	if _, err := vcsDriverFor(p); err == nil {
+		t.Errorf("Package with a remote that looks like an option accepted")
+	}
+}
+
+func TestHgRevsetString(t *testing.T) {
+	tests := map[string]string{
+		"default":            `'default'`,
+		"it's":               `'it\'s'`,
+		`a\b`:                `'a\\b'`,
+		"x') or all() or ('": `'x\') or all() or (\''`,
+	}
+	for version, want := range tests {
+		if got := hgRevsetString(version); got != want {
+			t.Errorf("hgRevsetString(%q): got %s, want %s", version, got, want)
+		}
+	}
+}
+
+func TestGitUnpushed(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	root, err := ioutil.TempDir("", "dvlnunpushed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	remote := filepath.Join(root, "remote")
+	testGit(t, root, "init", "-q", "-b", "main", remote)
+	testGit(t, remote, "commit", "-q", "--allow-empty", "-m", "one")
+	dir := filepath.Join(root, "ws", "net")
+	testGit(t, root, "clone", "-q", remote, dir)
+	p := &resolvedPkg{Name: "net", Path: "net", VCS: "git", Remote: remote, Version: "main"}
+	ctx := context.Background()
+	// commits on a branch other than the one checked out are unpushed too
+	for i, step := range [][]string{
+		nil,
+		{"commit", "-q", "--allow-empty", "-m", "two"},
+		{"checkout", "-q", "-b", "side"},
+		{"commit", "-q", "--allow-empty", "-m", "three"},
+		{"checkout", "-q", "main"},
+	} {
+		if step != nil {
+			testGit(t, dir, step...)
+		}
+		want := []int{0, 1, 1, 2, 2}[i]
+		if got, err := vcsUnpushed(ctx, p, dir); err != nil || got != want {
+			t.Errorf("after git %v: %d unpushed (err: %v), want %d", step, got, err, want)
+		}
+	}
+}
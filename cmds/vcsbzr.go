@@ -0,0 +1,134 @@
+// Copyright © 2015 Erik Brady <brady@dvln.org>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package cmds vcsbzr.go module implements the vcsDriver interface for
+// bazaar (bzr).  Versions are bzr revision specs, eg: "42", "tag:v1.0" or
+// "revid:<id>" (the form Revision() returns, so frozen devlines work).
+package cmds
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// bzrDriver runs bazaar operations via the 'bzr' command
+type bzrDriver struct{}
+
+// Clone runs 'bzr branch'
+func (bzrDriver) Clone(ctx context.Context, remote string, dir string) error {
+	_, err := runVCSCmd(ctx, "", "bzr", "branch", "--", remote, dir)
+	return err
+}
+
+// Fetch runs 'bzr pull', bzr has no way to fetch without updating the tree
+func (bzrDriver) Fetch(ctx context.Context, dir string) error {
+	_, err := runVCSCmd(ctx, dir, "bzr", "pull")
+	return err
+}
+
+// Checkout runs 'bzr update' to the version (or to the branch tip), a bare
+// revision id (eg: from a manifest written before revids were prefixed) is
+// turned into a "revid:" revision spec
+func (bzrDriver) Checkout(ctx context.Context, dir string, version string) error {
+	args := []string{"update"}
+	if version != "" {
+		if !strings.Contains(version, ":") && strings.Contains(version, "@") {
+			version = "revid:" + version
+		}
+		args = append(args, "-r", version)
+	}
+	_, err := runVCSCmd(ctx, dir, "bzr", args...)
+	return err
+}
+
+// Revision returns the revision id of the tree as a revision spec (ie:
+// "revid:<id>") so it can be handed back to Checkout() as a version
+func (bzrDriver) Revision(ctx context.Context, dir string) (string, error) {
+	rev, err := runVCSCmd(ctx, dir, "bzr", "revision-info", "--tree")
+	if err != nil {
+		return "", err
+	}
+	// output is "<revno> <revid>", the revid is the unique bit
+	fields := strings.Fields(rev)
+	if len(fields) != 2 {
+		return "", fmt.Errorf("unexpected revision info: %s", strings.TrimSpace(rev))
+	}
+	return "revid:" + fields[1], nil
+}
+
+// HasRevision uses 'bzr revision-info' to see if the revision is in the
+// branch
+func (bzrDriver) HasRevision(ctx context.Context, dir string, rev string) (bool, error) {
+	_, err := runVCSCmd(ctx, dir, "bzr", "revision-info", "-r", rev)
+	return err == nil, ctx.Err()
+}
+
+// Modified uses 'bzr status --short' to find modified/untracked files
+func (bzrDriver) Modified(ctx context.Context, dir string) ([]string, error) {
+	return vcsLines(ctx, dir, false, "bzr", "status", "--short")
+}
+
+// AheadBehind isn't supported for bzr (yet)
+func (bzrDriver) AheadBehind(ctx context.Context, dir string, version string) (int, int, error) {
+	return 0, 0, errVCSUnsupported
+}
+
+// Tags lists the tags in the branch
+func (bzrDriver) Tags(ctx context.Context, dir string) ([]string, error) {
+	lines, err := vcsLines(ctx, dir, true, "bzr", "tags")
+	if err != nil {
+		return nil, err
+	}
+	// output is "<tag> <revno>" per line
+	tags := make([]string, 0, len(lines))
+	for _, line := range lines {
+		tags = append(tags, strings.Fields(line)[0])
+	}
+	return tags, nil
+}
+
+// Branches isn't supported for bzr, a bzr branch is a separate dir
+func (bzrDriver) Branches(ctx context.Context, dir string) ([]string, error) {
+	return nil, errVCSUnsupported
+}
+
+// RemoteRefs isn't supported for bzr (yet)
+func (bzrDriver) RemoteRefs(ctx context.Context, remote string) (map[string]string, map[string]string, error) {
+	return nil, nil, errVCSUnsupported
+}
+
+// Stash runs 'bzr shelve' on all changes
+func (bzrDriver) Stash(ctx context.Context, dir string) error {
+	_, err := runVCSCmd(ctx, dir, "bzr", "shelve", "--all")
+	return err
+}
+
+// Revert reverts tracked files and removes unknown files
+func (bzrDriver) Revert(ctx context.Context, dir string) error {
+	if _, err := runVCSCmd(ctx, dir, "bzr", "revert", "--no-backup"); err != nil {
+		return err
+	}
+	_, err := runVCSCmd(ctx, dir, "bzr", "clean-tree", "--unknown", "--force")
+	return err
+}
+
+// LocalBranches isn't supported for bzr, a bzr branch is a separate dir
+func (bzrDriver) LocalBranches(ctx context.Context, dir string) ([]string, error) {
+	return nil, errVCSUnsupported
+}
+
+// Unpushed isn't supported for bzr (yet)
+func (bzrDriver) Unpushed(ctx context.Context, dir string) (int, error) {
+	return 0, errVCSUnsupported
+}
@@ -0,0 +1,191 @@
+// Copyright © 2015 Erik Brady <brady@dvln.org>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package cmds vcsgit.go module implements the vcsDriver interface for git.
+package cmds
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// gitDriver runs git operations via the 'git' command
+type gitDriver struct{}
+
+// Clone runs 'git clone'
+func (gitDriver) Clone(ctx context.Context, remote string, dir string) error {
+	_, err := runVCSCmd(ctx, "", "git", "clone", "--", remote, dir)
+	return err
+}
+
+// Fetch runs 'git fetch' on origin, including tags
+func (gitDriver) Fetch(ctx context.Context, dir string) error {
+	_, err := runVCSCmd(ctx, dir, "git", "fetch", "--tags", "origin")
+	return err
+}
+
+// Checkout checks out the version and, if that leaves us on a branch that
+// tracks a remote branch, fast-forwards it to match the remote
+func (gitDriver) Checkout(ctx context.Context, dir string, version string) error {
+	if version != "" {
+		// the "--" says version is a branch, tag or revision, not a file
+		if _, err := runVCSCmd(ctx, dir, "git", "checkout", version, "--"); err != nil {
+			return err
+		}
+	}
+	if _, err := runVCSCmd(ctx, dir, "git", "rev-parse", "--abbrev-ref", "@{u}"); err != nil {
+		return nil // tag, revision or untracked branch: nothing to catch up
+	}
+	_, err := runVCSCmd(ctx, dir, "git", "merge", "--ff-only")
+	return err
+}
+
+// Revision returns the full sha1 of HEAD
+func (gitDriver) Revision(ctx context.Context, dir string) (string, error) {
+	rev, err := runVCSCmd(ctx, dir, "git", "rev-parse", "HEAD")
+	return strings.TrimSpace(rev), err
+}
+
+// HasRevision uses 'git cat-file' to see if the revision is a commit we have
+func (gitDriver) HasRevision(ctx context.Context, dir string, rev string) (bool, error) {
+	_, err := runVCSCmd(ctx, dir, "git", "cat-file", "-e", rev+"^{commit}")
+	return err == nil, ctx.Err()
+}
+
+// Modified uses 'git status --porcelain' to find modified/untracked files
+func (gitDriver) Modified(ctx context.Context, dir string) ([]string, error) {
+	return vcsLines(ctx, dir, false, "git", "status", "--porcelain")
+}
+
+// AheadBehind compares HEAD to the version, for branches the remote branch
+// is used, if no version given then the upstream of the current branch
+func (gitDriver) AheadBehind(ctx context.Context, dir string, version string) (int, int, error) {
+	ref := "@{u}"
+	if version != "" {
+		ref = version
+		if _, err := runVCSCmd(ctx, dir, "git", "rev-parse", "--verify", "-q", "refs/remotes/origin/"+version); err == nil {
+			ref = "origin/" + version
+		}
+	}
+	counts, err := runVCSCmd(ctx, dir, "git", "rev-list", "--left-right", "--count", "HEAD..."+ref, "--")
+	if err != nil {
+		return 0, 0, err
+	}
+	var ahead, behind int
+	if _, err = fmt.Sscan(counts, &ahead, &behind); err != nil {
+		return 0, 0, fmt.Errorf("unexpected revision counts: %s", counts)
+	}
+	return ahead, behind, nil
+}
+
+// Tags lists the tags in the local clone (up to date as of the last Fetch)
+func (gitDriver) Tags(ctx context.Context, dir string) ([]string, error) {
+	return vcsLines(ctx, dir, true, "git", "tag", "-l")
+}
+
+// Branches lists the branches on origin (as of the last Fetch)
+func (gitDriver) Branches(ctx context.Context, dir string) ([]string, error) {
+	refs, err := vcsLines(ctx, dir, true, "git", "for-each-ref", "--format=%(refname:short)", "refs/remotes/origin")
+	if err != nil {
+		return nil, err
+	}
+	branches := make([]string, 0, len(refs))
+	for _, ref := range refs {
+		branch := strings.TrimPrefix(ref, "origin/")
+		if branch != "HEAD" && branch != "origin" {
+			branches = append(branches, branch)
+		}
+	}
+	return branches, nil
+}
+
+// RemoteRefs uses 'git ls-remote' to list the remote tags and branches (the
+// remote's default branch is "HEAD"), the revision of an annotated tag is
+// the commit it refers to
+func (gitDriver) RemoteRefs(ctx context.Context, remote string) (map[string]string, map[string]string, error) {
+	refs, err := vcsLines(ctx, "", true, "git", "ls-remote", "--", remote)
+	if err != nil {
+		return nil, nil, err
+	}
+	tags := make(map[string]string)
+	branches := make(map[string]string)
+	for _, ref := range refs {
+		fields := strings.Fields(ref)
+		if len(fields) != 2 {
+			continue
+		}
+		rev, name := fields[0], fields[1]
+		switch {
+		case name == "HEAD":
+			branches[name] = rev
+		case strings.HasPrefix(name, "refs/heads/"):
+			branches[strings.TrimPrefix(name, "refs/heads/")] = rev
+		case strings.HasSuffix(name, "^{}"):
+			tags[strings.TrimSuffix(strings.TrimPrefix(name, "refs/tags/"), "^{}")] = rev
+		case strings.HasPrefix(name, "refs/tags/"):
+			tag := strings.TrimPrefix(name, "refs/tags/")
+			if _, ok := tags[tag]; !ok {
+				tags[tag] = rev
+			}
+		}
+	}
+	return tags, branches, nil
+}
+
+// Stash runs 'git stash', including untracked files
+func (gitDriver) Stash(ctx context.Context, dir string) error {
+	_, err := runVCSCmd(ctx, dir, "git", "stash", "push", "--include-untracked", "-m", "stashed by dvln")
+	return err
+}
+
+// Revert resets tracked files to HEAD and removes untracked files
+func (gitDriver) Revert(ctx context.Context, dir string) error {
+	if _, err := runVCSCmd(ctx, dir, "git", "reset", "--hard", "HEAD"); err != nil {
+		return err
+	}
+	_, err := runVCSCmd(ctx, dir, "git", "clean", "-fd")
+	return err
+}
+
+// LocalBranches lists the local branches with commits not on any remote
+func (gitDriver) LocalBranches(ctx context.Context, dir string) ([]string, error) {
+	heads, err := vcsLines(ctx, dir, true, "git", "for-each-ref", "--format=%(refname:short)", "refs/heads")
+	if err != nil {
+		return nil, err
+	}
+	var branches []string
+	for _, head := range heads {
+		count, err := runVCSCmd(ctx, dir, "git", "rev-list", "--count", head, "--not", "--remotes")
+		if err != nil {
+			return nil, err
+		}
+		if strings.TrimSpace(count) != "0" {
+			branches = append(branches, head)
+		}
+	}
+	return branches, nil
+}
+
+// Unpushed counts the commits on HEAD or any local branch not on any remote
+func (gitDriver) Unpushed(ctx context.Context, dir string) (int, error) {
+	count, err := runVCSCmd(ctx, dir, "git", "rev-list", "--count", "HEAD", "--branches", "--not", "--remotes")
+	if err != nil {
+		return 0, err
+	}
+	var unpushed int
+	if _, err = fmt.Sscan(count, &unpushed); err != nil {
+		return 0, fmt.Errorf("unexpected revision count: %s", count)
+	}
+	return unpushed, nil
+}
@@ -0,0 +1,142 @@
+// Copyright © 2015 Erik Brady <brady@dvln.org>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package cmds vcshg.go module implements the vcsDriver interface for
+// mercurial (hg).
+package cmds
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// hgDriver runs mercurial operations via the 'hg' command
+type hgDriver struct{}
+
+// Clone runs 'hg clone'
+func (hgDriver) Clone(ctx context.Context, remote string, dir string) error {
+	_, err := runVCSCmd(ctx, "", "hg", "clone", "--", remote, dir)
+	return err
+}
+
+// Fetch runs 'hg pull' which, without -u, leaves the working copy alone
+func (hgDriver) Fetch(ctx context.Context, dir string) error {
+	_, err := runVCSCmd(ctx, dir, "hg", "pull")
+	return err
+}
+
+// Checkout runs 'hg update' to the version, a branch name takes us to the
+// tip of that branch, if no version given we go to the tip of our branch
+func (hgDriver) Checkout(ctx context.Context, dir string, version string) error {
+	args := []string{"update"}
+	if version != "" {
+		args = append(args, "-r", version)
+	}
+	_, err := runVCSCmd(ctx, dir, "hg", args...)
+	return err
+}
+
+// Revision returns the full changeset id of the working copy parent
+func (hgDriver) Revision(ctx context.Context, dir string) (string, error) {
+	rev, err := runVCSCmd(ctx, dir, "hg", "log", "-r", ".", "--template", "{node}")
+	return strings.TrimSpace(rev), err
+}
+
+// HasRevision uses 'hg log' to see if the revision is a changeset we have
+func (hgDriver) HasRevision(ctx context.Context, dir string, rev string) (bool, error) {
+	_, err := runVCSCmd(ctx, dir, "hg", "log", "-r", hgRevsetString(rev), "--template", "{node}")
+	return err == nil, ctx.Err()
+}
+
+// Modified uses 'hg status' to find modified/untracked files
+func (hgDriver) Modified(ctx context.Context, dir string) ([]string, error) {
+	return vcsLines(ctx, dir, false, "hg", "status")
+}
+
+// AheadBehind uses revsets to count changesets only in the working copy
+// parent vs only in the version (the 'default' branch if none given)
+func (hgDriver) AheadBehind(ctx context.Context, dir string, version string) (int, int, error) {
+	if version == "" {
+		version = "default"
+	}
+	ahead, err := vcsLines(ctx, dir, true, "hg", "log", "-r", fmt.Sprintf("only(., %s)", hgRevsetString(version)), "--template", "{node}\n")
+	if err != nil {
+		return 0, 0, err
+	}
+	behind, err := vcsLines(ctx, dir, true, "hg", "log", "-r", fmt.Sprintf("only(%s, .)", hgRevsetString(version)), "--template", "{node}\n")
+	if err != nil {
+		return 0, 0, err
+	}
+	return len(ahead), len(behind), nil
+}
+
+// hgRevsetString quotes the given version (branch, tag or revision) for use
+// in a revset, so it's always taken as a name and never as revset syntax
+func hgRevsetString(version string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(version) + "'"
+}
+
+// Tags lists the tags in the local clone (up to date as of the last Fetch)
+func (hgDriver) Tags(ctx context.Context, dir string) ([]string, error) {
+	return vcsLines(ctx, dir, true, "hg", "tags", "-q")
+}
+
+// Branches lists the named branches in the local clone
+func (hgDriver) Branches(ctx context.Context, dir string) ([]string, error) {
+	return vcsLines(ctx, dir, true, "hg", "branches", "-q")
+}
+
+// RemoteRefs isn't supported for hg, there's no way to list remote tags
+// without pulling them into a local clone
+func (hgDriver) RemoteRefs(ctx context.Context, remote string) (map[string]string, map[string]string, error) {
+	return nil, nil, errVCSUnsupported
+}
+
+// Stash runs 'hg shelve' (enabling the bundled extension), including
+// untracked files
+func (hgDriver) Stash(ctx context.Context, dir string) error {
+	_, err := runVCSCmd(ctx, dir, "hg", "--config", "extensions.shelve=", "shelve", "--unknown", "--name", "dvln")
+	return err
+}
+
+// Revert reverts tracked files and purges untracked files (enabling the
+// bundled purge extension)
+func (hgDriver) Revert(ctx context.Context, dir string) error {
+	if _, err := runVCSCmd(ctx, dir, "hg", "revert", "--all", "--no-backup"); err != nil {
+		return err
+	}
+	_, err := runVCSCmd(ctx, dir, "hg", "--config", "extensions.purge=", "purge")
+	return err
+}
+
+// LocalBranches lists the branches with draft (unpublished) heads
+func (hgDriver) LocalBranches(ctx context.Context, dir string) ([]string, error) {
+	heads, err := vcsLines(ctx, dir, true, "hg", "log", "-r", "head() and draft()", "--template", "{branch}\n")
+	if err != nil {
+		return nil, err
+	}
+	var branches []string
+	for _, branch := range heads {
+		if !stringInSlice(branch, branches) {
+			branches = append(branches, branch)
+		}
+	}
+	return branches, nil
+}
+
+// Unpushed counts the draft (unpublished) changesets
+func (hgDriver) Unpushed(ctx context.Context, dir string) (int, error) {
+	drafts, err := vcsLines(ctx, dir, true, "hg", "log", "-r", "draft()", "--template", "{node}\n")
+	return len(drafts), err
+}
@@ -0,0 +1,132 @@
+// Copyright © 2015 Erik Brady <brady@dvln.org>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package cmds vcssvn.go module implements the vcsDriver interface for
+// subversion (svn).  Versions are either revision numbers (or HEAD) or a
+// repository relative path to switch to, eg: "branches/foo" or "tags/v1.0".
+package cmds
+
+import (
+	"context"
+	"strconv"
+	"strings"
+)
+
+// svnDriver runs subversion operations via the 'svn' command
+type svnDriver struct{}
+
+// svnIsRevision returns true if the version is a revision (not a path)
+func svnIsRevision(version string) bool {
+	_, err := strconv.Atoi(version)
+	return err == nil || version == "HEAD"
+}
+
+// Clone runs 'svn checkout'
+func (svnDriver) Clone(ctx context.Context, remote string, dir string) error {
+	_, err := runVCSCmd(ctx, "", "svn", "checkout", "--", remote, dir)
+	return err
+}
+
+// Fetch is a no-op, svn has no local repository to fetch into
+func (svnDriver) Fetch(ctx context.Context, dir string) error {
+	return nil
+}
+
+// Checkout runs 'svn update' to a revision or 'svn switch' to a path within
+// the repository, with no version we update to HEAD of the current path
+func (svnDriver) Checkout(ctx context.Context, dir string, version string) error {
+	var err error
+	switch {
+	case version == "":
+		_, err = runVCSCmd(ctx, dir, "svn", "update")
+	case svnIsRevision(version):
+		_, err = runVCSCmd(ctx, dir, "svn", "update", "-r", version)
+	default:
+		_, err = runVCSCmd(ctx, dir, "svn", "switch", "--", "^/"+strings.TrimPrefix(version, "/"))
+	}
+	return err
+}
+
+// Revision returns the revision of the working copy
+func (svnDriver) Revision(ctx context.Context, dir string) (string, error) {
+	rev, err := runVCSCmd(ctx, dir, "svn", "info", "--show-item", "revision")
+	return strings.TrimSpace(rev), err
+}
+
+// HasRevision uses 'svn info' to see if the revision is in the repository
+func (svnDriver) HasRevision(ctx context.Context, dir string, rev string) (bool, error) {
+	_, err := runVCSCmd(ctx, dir, "svn", "info", "-r", rev)
+	return err == nil, ctx.Err()
+}
+
+// Modified uses 'svn status' to find modified/untracked files
+func (svnDriver) Modified(ctx context.Context, dir string) ([]string, error) {
+	return vcsLines(ctx, dir, false, "svn", "status")
+}
+
+// AheadBehind isn't something svn can do, there are no local commits
+func (svnDriver) AheadBehind(ctx context.Context, dir string, version string) (int, int, error) {
+	return 0, 0, errVCSUnsupported
+}
+
+// Tags lists the entries in the repository 'tags' dir
+func (svnDriver) Tags(ctx context.Context, dir string) ([]string, error) {
+	return svnList(ctx, dir, "^/tags")
+}
+
+// Branches lists the entries in the repository 'branches' dir
+func (svnDriver) Branches(ctx context.Context, dir string) ([]string, error) {
+	return svnList(ctx, dir, "^/branches")
+}
+
+// svnList lists the dirs within the given repository path (sans the '/')
+func svnList(ctx context.Context, dir string, repoPath string) ([]string, error) {
+	entries, err := vcsLines(ctx, dir, true, "svn", "ls", repoPath)
+	if err != nil {
+		return nil, err
+	}
+	for i, entry := range entries {
+		entries[i] = strings.TrimSuffix(entry, "/")
+	}
+	return entries, nil
+}
+
+// RemoteRefs isn't supported for svn, where tags and branches live in the
+// repository depends on the repository layout
+func (svnDriver) RemoteRefs(ctx context.Context, remote string) (map[string]string, map[string]string, error) {
+	return nil, nil, errVCSUnsupported
+}
+
+// Stash isn't supported for svn (before 1.10 there's no shelving)
+func (svnDriver) Stash(ctx context.Context, dir string) error {
+	return errVCSUnsupported
+}
+
+// Revert reverts tracked files and removes unversioned files
+func (svnDriver) Revert(ctx context.Context, dir string) error {
+	if _, err := runVCSCmd(ctx, dir, "svn", "revert", "-R", "."); err != nil {
+		return err
+	}
+	_, err := runVCSCmd(ctx, dir, "svn", "cleanup", "--remove-unversioned")
+	return err
+}
+
+// LocalBranches isn't something svn has, all branches are in the repository
+func (svnDriver) LocalBranches(ctx context.Context, dir string) ([]string, error) {
+	return nil, errVCSUnsupported
+}
+
+// Unpushed isn't something svn has, commits go straight to the repository
+func (svnDriver) Unpushed(ctx context.Context, dir string) (int, error) {
+	return 0, errVCSUnsupported
+}
@@ -0,0 +1,125 @@
+// Copyright © 2015 Erik Brady <brady@dvln.org>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package cmds wkspccfg.go module reads the workspace config file, if any,
+// which lets a team pin settings for everyone using a workspace (eg: jobs,
+// fatalon, logfilelevel or the default devline).  It lives in the workspace
+// metadata dir as cfg.json|toml|yaml|yml, eg: .dvln/cfg.toml:
+//
+//	jobs = 4
+//	fatalon = 0
+//	devline = "proj_x"
+//
+// Workspace settings are layered above the users config file settings and
+// below env and CLI settings, ie: priority is (highest to lowest) CLI opts,
+// env vars, the workspace config, the users config, devline and codebase
+// settings (see defsettings.go) and then the defaults.
+// Use 'dvln --globs=src' to see which layer each setting came from.
+package cmds
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/dvln/out"
+	globs "github.com/dvln/viper"
+	"github.com/dvln/wkspc"
+)
+
+// findWkspcRootDir finds the workspace root dir, via the --wkspcdir option
+// if given otherwise by scanning up from the current dir.  If there is no
+// workspace the root dir is "" (that's normal, not an error)
+func findWkspcRootDir() (string, error) {
+	wkspcdir := globs.GetString("wkspcdir") // CLI option --workspace/-w
+	if wkspcdir != "." && wkspcdir != "" {
+		out.Traceln("Workspace dir passed in:", wkspcdir)
+		return wkspc.RootDir(wkspcdir) // handle a CLI given dir/subdir
+	}
+	out.Traceln("No workspace dir passed in, driving off of cwd")
+	return wkspc.RootDir() // scan from CWD for a wkspc root dir
+}
+
+// wkspcCfgFile returns the workspace config file in the given workspace
+// root dir, "" if there isn't one
+func wkspcCfgFile(rootDir string) string {
+	for _, ext := range defExts {
+		file := filepath.Join(wkspcMetaDirPath(rootDir), "cfg"+ext)
+		if _, err := os.Stat(file); err == nil {
+			return file
+		}
+	}
+	return ""
+}
+
+// fileSettable returns an error if the given setting can't be set in a
+// config file (or a codebase or devline definition), ie: it's unknown,
+// can't be changed or can only be given on the CLI
+func fileSettable(key string) error {
+	desc, _, scope := globs.Desc(key)
+	switch {
+	case desc == "":
+		return fmt.Errorf("unknown setting \"%s\" (see 'dvln --globs=cfg')", key)
+	case scope == globs.ConstGlobal || scope == globs.CLIOnlyGlobal:
+		return fmt.Errorf("setting \"%s\" can't be set in a config file", key)
+	case key == "config":
+		return fmt.Errorf("setting \"config\" says where the users config is, it can only be set via env or the CLI")
+	}
+	return nil
+}
+
+// scanWkspcConfigFile reads the workspace config file (if in a workspace
+// that has one) and layers its settings above the users config settings,
+// settings given via env or CLI are left alone as they take priority.  Bad
+// settings are warned about and skipped, they shouldn't stop every command
+// (including the 'dvln config unset' that would fix them).
+func scanWkspcConfigFile() error {
+	rootDir, err := findWkspcRootDir()
+	if err != nil || rootDir == "" {
+		return nil // workspace scan problems are reported in dvlnFinalPrep()
+	}
+	file := wkspcCfgFile(rootDir)
+	if file == "" {
+		return nil
+	}
+	out.Debugln("Reading workspace config file:", file)
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return out.WrapErr(err, "Unable to read the workspace config file", 2036)
+	}
+	settings := make(map[string]interface{})
+	if err = decodeDef(file, data, &settings); err != nil {
+		return out.WrapErr(err, fmt.Sprintf("Unable to parse the workspace config file: %s", file), 2036)
+	}
+	keys := make([]string, 0, len(settings))
+	for key := range settings {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		lkey := strings.ToLower(key)
+		if err := fileSettable(lkey); err != nil {
+			out.Issueln(out.NewErr(fmt.Sprintf("Workspace config file %s: %s, ignoring it", file, err), 2036))
+			continue
+		}
+		if _, ok := os.LookupEnv(globsEnvVar(lkey)); ok || cliGlobs[lkey] {
+			out.Debugf("Workspace config setting %s overridden by env or CLI\n", lkey)
+			continue
+		}
+		setGlob(lkey, settings[key], "workspace:"+file)
+	}
+	return nil
+}
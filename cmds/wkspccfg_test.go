@@ -0,0 +1,73 @@
+// Copyright © 2015 Erik Brady <brady@dvln.org>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmds
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	globs "github.com/dvln/viper"
+)
+
+// TestWkspcConfigLayers checks the workspace config settings override the
+// users config (and defaults) but not env or CLI settings, and that a bad
+// setting is skipped rather than failing the scan
+func TestWkspcConfigLayers(t *testing.T) {
+	root, err := ioutil.TempDir("", "dvlnwkspccfg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	metaDir := filepath.Join(root, ".dvln")
+	if err = os.Mkdir(metaDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(metaDir, "cfg.json")
+	cfg := `{"jobs": "2", "fatalon": 2, "devline": "wkspc_dl", "bogus": 1, "globs": "cfg"}`
+	if err = ioutil.WriteFile(file, []byte(cfg), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	snap := snapshotGlobs()
+	defer snap.restore()
+	setGlob("wkspcdir", root, "test")
+	setGlob("jobs", "1", "user") // stands in for the users config
+	os.Setenv(globsEnvVar("fatalon"), "3")
+	defer os.Unsetenv(globsEnvVar("fatalon"))
+	cliGlobs["devline"] = true
+	defer delete(cliGlobs, "devline")
+
+	if err = scanWkspcConfigFile(); err != nil {
+		t.Fatalf("Bad workspace config settings failed the scan: %s", err)
+	}
+	for key, want := range map[string]string{
+		"jobs":    "workspace:" + file,
+		"fatalon": "env:DVLN_FATALON",
+		"devline": "cli:--devline",
+		"globs":   "default",
+	} {
+		_, _, scope := globs.Desc(key)
+		if got := globSource(key, scope); got != want {
+			t.Errorf("Setting %s: source %s, want %s", key, got, want)
+		}
+	}
+	if jobs := globs.GetString("jobs"); jobs != "2" {
+		t.Errorf("Setting jobs: got %s, want the workspace config value 2", jobs)
+	}
+	if globs.IsSet("bogus") {
+		t.Errorf("Unknown workspace config setting bogus was set")
+	}
+}
@@ -0,0 +1,172 @@
+// Copyright © 2015 Erik Brady <brady@dvln.org>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package cmds wkspcmeta.go module manages the dvln metadata stored within a
+// workspace (ie: within the wkspcMetaDir directory, '.dvln' by default).
+package cmds
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/dvln/out"
+	globs "github.com/dvln/viper"
+)
+
+// wkspcInfo is what we record about a workspace in the workspace metadata
+// dir, namely the codebase and base devline the workspace was populated from
+type wkspcInfo struct {
+	Codebase string `json:"codebase"`
+	Devline  string `json:"devline,omitempty"`
+}
+
+// wkspcMetaDirPath returns the path to the dvln metadata dir for the given
+// workspace root directory
+func wkspcMetaDirPath(rootDir string) string {
+	return filepath.Join(rootDir, globs.GetString("wkspcMetaDir"))
+}
+
+// wkspcInfoPath returns the path to the workspace info file for the given
+// workspace root directory
+func wkspcInfoPath(rootDir string) string {
+	return filepath.Join(wkspcMetaDirPath(rootDir), "wkspc.json")
+}
+
+// checkPkgPath returns an error if the given package path can't be used as
+// a workspace relative path, ie: it's empty or absolute, it has ".." in it
+// (so it could escape the workspace) or it's in the workspace metadata dir
+func checkPkgPath(pkgPath string) error {
+	slashPath := filepath.ToSlash(pkgPath)
+	switch {
+	case strings.TrimSpace(pkgPath) == "":
+		return fmt.Errorf("it's empty")
+	case filepath.IsAbs(pkgPath) || strings.HasPrefix(slashPath, "/") || filepath.VolumeName(pkgPath) != "":
+		return fmt.Errorf("it's absolute, it must be relative to the workspace root")
+	}
+	for _, elem := range strings.Split(slashPath, "/") {
+		if elem == ".." {
+			return fmt.Errorf("it has \"..\" in it, it must be within the workspace")
+		}
+	}
+	cleanPath := filepath.ToSlash(filepath.Clean(pkgPath))
+	if cleanPath == "." {
+		return fmt.Errorf("it's the workspace root")
+	}
+	if top := strings.Split(cleanPath, "/")[0]; strings.EqualFold(top, globs.GetString("wkspcMetaDir")) {
+		return fmt.Errorf("it's in the workspace metadata dir (%s)", top)
+	}
+	return nil
+}
+
+// wkspcPkgDir returns the dir the package with the given (workspace relative)
+// path lives in within the given workspace, paths that could land outside of
+// the workspace (or in it's metadata dir) are refused as we clone into, and
+// may remove, the dir returned
+func wkspcPkgDir(rootDir string, pkgPath string) (string, error) {
+	if err := checkPkgPath(pkgPath); err != nil {
+		return "", out.NewErr(fmt.Sprintf("Package path \"%s\" can't be used: %s", pkgPath, err), 2041)
+	}
+	return filepath.Join(rootDir, filepath.Clean(filepath.FromSlash(pkgPath))), nil
+}
+
+// createWkspcMetaDir creates the dvln metadata dir in the given workspace
+// root dir, if it's already there that's fine
+func createWkspcMetaDir(rootDir string) error {
+	if err := os.MkdirAll(wkspcMetaDirPath(rootDir), 0755); err != nil {
+		return out.WrapErr(err, "Unable to create the workspace metadata dir", 2012)
+	}
+	return nil
+}
+
+// readWkspcInfo reads the workspace info recorded in the given workspace, if
+// nothing has been recorded yet an empty wkspcInfo is returned
+func readWkspcInfo(rootDir string) (*wkspcInfo, error) {
+	info := &wkspcInfo{}
+	data, err := ioutil.ReadFile(wkspcInfoPath(rootDir))
+	if os.IsNotExist(err) {
+		return info, nil
+	}
+	if err == nil {
+		err = json.Unmarshal(data, info)
+	}
+	if err != nil {
+		return nil, out.WrapErr(err, "Unable to read the workspace info file", 2012)
+	}
+	return info, nil
+}
+
+// writeWkspcInfo records the given workspace info in the given workspace
+func writeWkspcInfo(rootDir string, info *wkspcInfo) error {
+	data, err := json.MarshalIndent(info, "", "  ")
+	if err == nil {
+		err = ioutil.WriteFile(wkspcInfoPath(rootDir), append(data, '\n'), 0644)
+	}
+	if err != nil {
+		return out.WrapErr(err, "Unable to write the workspace info file", 2012)
+	}
+	return nil
+}
+
+// wkspcRecordedPkgs returns the packages in the given workspace as recorded
+// in the workspace manifest.  Workspaces without a manifest fall back to
+// what the recorded codebase and base devline resolve to.  Either way the
+// codebase and devline settings are merged in (see defsettings.go).
+func wkspcRecordedPkgs(rootDir string) (*wkspcInfo, []*resolvedPkg, error) {
+	info, err := readWkspcInfo(rootDir)
+	if err != nil {
+		return nil, nil, err
+	}
+	m, err := readManifest(rootDir)
+	if err != nil {
+		return nil, nil, err
+	}
+	if info.Codebase == "" {
+		return info, m.resolvedPkgs(), nil
+	}
+	if len(m.Packages) != 0 {
+		if err = mergeWkspcSettings(info); err != nil {
+			return nil, nil, err
+		}
+		return info, m.resolvedPkgs(), nil
+	}
+	cb, err := loadCodebase(info.Codebase)
+	if err != nil {
+		return nil, nil, err
+	}
+	pkgs, err := resolveDevline(cb, info.Devline)
+	if err != nil {
+		return nil, nil, err
+	}
+	return info, pkgs, nil
+}
+
+// mergeWkspcSettings merges the settings of the workspace codebase and base
+// devline (see defsettings.go) when the packages come from the manifest, if
+// they can't be loaded (eg: offline) the workspace is still usable so that
+// is only noted
+func mergeWkspcSettings(info *wkspcInfo) error {
+	cb, err := loadCodebase(info.Codebase)
+	var chain []*devlineDef
+	if err == nil {
+		chain, err = loadDevlineChain(info.Devline)
+	}
+	if err != nil {
+		out.Debugln("Unable to load the workspace codebase and devline for their settings, skipping them:", err)
+		return nil
+	}
+	return mergeSettings(cb, chain)
+}